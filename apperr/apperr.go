@@ -0,0 +1,175 @@
+// Package apperr defines the domain errors shared by the repositories, the service and the
+// handlers. Each error has a Kind, which decides the http status code, and a stable Code clients
+// can match on instead of the message.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Kind string
+
+const (
+	KindNotFound            Kind = "not_found"
+	KindAlreadyExists       Kind = "already_exists"
+	KindInvalidTransition   Kind = "invalid_transition"
+	KindConflict            Kind = "conflict"
+	KindPreconditionFailed  Kind = "precondition_failed"
+	KindPreconditionMissing Kind = "precondition_required"
+	KindValidation          Kind = "validation"
+	KindUpstreamUnavailable Kind = "upstream_unavailable"
+	KindInternal            Kind = "internal"
+)
+
+const (
+	CodeSubscriptionNotFound = "subscription_not_found"
+	CodeSubscriptionExists   = "subscription_already_exists"
+	CodeInvalidTransition    = "invalid_status_transition"
+	CodeValidationFailed     = "validation_failed"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeIdempotencyKeyInUse  = "idempotency_key_in_progress"
+	CodeVersionMismatch      = "version_mismatch"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodeIfMatchRequired      = "if_match_required"
+	CodeImportRowSkipped     = "import_row_skipped"
+	CodeDatabaseUnavailable  = "database_unavailable"
+	CodePtsUnavailable       = "pts_unavailable"
+	CodeTimeout              = "request_timeout"
+	CodeBadRequest           = "bad_request"
+	CodeNotFound             = "not_found"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeInternal             = "internal_error"
+)
+
+// Error is a domain error. Err is the underlying cause when there is one, it is kept for
+// errors.Is and errors.As but left out of the message, which is safe to show to clients.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError is a validation failure of one field, Pointer is a JSON pointer (RFC 6901) to the
+// field in the request body, e.g. /msisdn
+type FieldError struct {
+	Pointer string
+	Detail  string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) ErrorKind() Kind {
+	return e.Kind
+}
+
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// Is makes errors.Is(err, apperr.ErrNotFound) and the like match any error of the same kind
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == "" && t.Kind == e.Kind
+}
+
+// Sentinels to compare with errors.Is, they match every error of their kind
+var (
+	ErrNotFound            = &Error{Kind: KindNotFound}
+	ErrAlreadyExists       = &Error{Kind: KindAlreadyExists}
+	ErrInvalidTransition   = &Error{Kind: KindInvalidTransition}
+	ErrConflict            = &Error{Kind: KindConflict}
+	ErrPreconditionFailed  = &Error{Kind: KindPreconditionFailed}
+	ErrValidation          = &Error{Kind: KindValidation}
+	ErrUpstreamUnavailable = &Error{Kind: KindUpstreamUnavailable}
+)
+
+// Kinded is implemented by errors which carry their own kind and code, like *Error.
+// Errors with more details, like service.InvalidTransitionError, implement it to be mapped
+// the same way.
+type Kinded interface {
+	error
+	ErrorKind() Kind
+	ErrorCode() string
+}
+
+func NotFound(code string, cause error, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: fmt.Sprintf(format, args...), Err: cause}
+}
+
+func AlreadyExists(code string, cause error, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindAlreadyExists, Code: code, Message: fmt.Sprintf(format, args...), Err: cause}
+}
+
+func Validation(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidationFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+// Conflict is returned when a request clashes with another request, rather than with the state of a subscription
+func Conflict(code string, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// VersionMismatch is returned when a subscription is updated based on an older version than the stored one
+func VersionMismatch(msisdn string, expected, actual int64) *Error {
+	return PreconditionFailed("subscription with msisdn %v has version %d, not %d", msisdn, actual, expected)
+}
+
+func PreconditionFailed(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindPreconditionFailed, Code: CodeVersionMismatch, Message: fmt.Sprintf(format, args...)}
+}
+
+// PreconditionRequired is returned when an update does not say which version it is based on
+func PreconditionRequired(format string, args ...interface{}) *Error {
+	return &Error{Kind: KindPreconditionMissing, Code: CodeIfMatchRequired, Message: fmt.Sprintf(format, args...)}
+}
+
+// InvalidFields returns a validation error for all the given field errors at once
+func InvalidFields(fields []FieldError) *Error {
+	details := make([]string, 0, len(fields))
+	for _, field := range fields {
+		details = append(details, field.Detail)
+	}
+	return &Error{Kind: KindValidation, Code: CodeValidationFailed, Message: strings.Join(details, "; "), Fields: fields}
+}
+
+func UpstreamUnavailable(code string, cause error, format string, args ...interface{}) *Error {
+	return &Error{Kind: KindUpstreamUnavailable, Code: code, Message: fmt.Sprintf(format, args...), Err: cause}
+}
+
+// KindOf returns the kind of the first domain error in the chain of err, or KindInternal
+func KindOf(err error) Kind {
+	var kinded Kinded
+	if errors.As(err, &kinded) {
+		return kinded.ErrorKind()
+	}
+	return KindInternal
+}
+
+// FieldsOf returns the field errors of the first domain error in the chain of err
+func FieldsOf(err error) []FieldError {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
+
+// CodeOf returns the code of the first domain error in the chain of err, or CodeInternal
+func CodeOf(err error) string {
+	var kinded Kinded
+	if errors.As(err, &kinded) {
+		return kinded.ErrorCode()
+	}
+	return CodeInternal
+}
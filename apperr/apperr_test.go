@@ -0,0 +1,45 @@
+package apperr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKindOf(t *testing.T) {
+	cause := errors.New("sql: no rows in result set")
+	err := fmt.Errorf("could not update: %w", NotFound(CodeSubscriptionNotFound, cause, "subscription with msisdn %v not found", "+46107500500"))
+
+	assert.EqualValues(t, KindNotFound, KindOf(err))
+	assert.EqualValues(t, CodeSubscriptionNotFound, CodeOf(err))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrAlreadyExists))
+	assert.True(t, errors.Is(err, cause))
+}
+
+func TestKindOf_UnknownError(t *testing.T) {
+	err := errors.New("connection reset by peer")
+
+	assert.EqualValues(t, KindInternal, KindOf(err))
+	assert.EqualValues(t, CodeInternal, CodeOf(err))
+}
+
+func TestError_HidesCause(t *testing.T) {
+	err := AlreadyExists(CodeSubscriptionExists, errors.New(`pq: duplicate key value violates unique constraint "subscription_pkey"`), "subscription with msisdn %v already exists", "+46107500500")
+
+	assert.EqualValues(t, "subscription with msisdn +46107500500 already exists", err.Error())
+}
+
+func TestInvalidFields(t *testing.T) {
+	err := fmt.Errorf("create: %w", InvalidFields([]FieldError{
+		{Pointer: "/msisdn", Detail: "msisdn cannot be nil"},
+		{Pointer: "/status", Detail: "status cannot be empty"},
+	}))
+
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.EqualValues(t, "create: msisdn cannot be nil; status cannot be empty", err.Error())
+	assert.Len(t, FieldsOf(err), 2)
+	assert.EqualValues(t, "/status", FieldsOf(err)[1].Pointer)
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned without calling PTS while the circuit breaker is open
+var ErrCircuitOpen = apperr.UpstreamUnavailable(apperr.CodePtsUnavailable, nil, "pts circuit breaker is open")
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// BreakingClient stops calling the wrapped client after a number of consecutive failures.
+// Once the cooldown has passed one trial call is let through, it closes the breaker again
+// when it succeeds and reopens it when it fails.
+type BreakingClient struct {
+	next      OperatorLookup
+	log       *log.Logger
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	rejected uint64
+}
+
+func NewBreakingClient(log *log.Logger, next OperatorLookup, threshold int, cooldown time.Duration) *BreakingClient {
+	return &BreakingClient{
+		next:      next,
+		log:       log,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     BreakerClosed,
+	}
+}
+
+func (b *BreakingClient) GetOperatorDetails(ctx context.Context, msisdn string) (model.PtsResponse, error) {
+	if !b.allow() {
+		return model.PtsResponse{}, ErrCircuitOpen
+	}
+	response, err := b.next.GetOperatorDetails(ctx, msisdn)
+	if err != nil && ctx.Err() != nil {
+		// the caller gave up, which says nothing about PTS
+		b.release()
+		return response, err
+	}
+	b.record(err)
+	return response, err
+}
+
+// allow reports whether a call may go through, moving an open breaker to half-open after the cooldown
+func (b *BreakingClient) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			b.rejected++
+			return false
+		}
+		b.log.Info("pts circuit breaker cooldown passed, letting a trial call through")
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// only the trial call is let through until it has finished
+		b.rejected++
+		return false
+	}
+	return true
+}
+
+func (b *BreakingClient) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.state != BreakerClosed {
+			b.log.Info("pts circuit breaker closed, pts is answering again")
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			b.log.Errorf("pts circuit breaker opened after %d consecutive failures, last error: %v", b.failures, err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release lets the next trial call through when a half-open trial was cancelled by its caller
+func (b *BreakingClient) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+		// the cooldown has passed already, so the next call is a new trial
+		b.openedAt = b.now().Add(-b.cooldown)
+	}
+}
+
+// Stats returns the current state of the breaker
+func (b *BreakingClient) Stats() model.PtsBreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := model.PtsBreakerStats{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Rejected:            b.rejected,
+		Threshold:           b.threshold,
+		Cooldown:            b.cooldown.String(),
+	}
+	if b.state != BreakerClosed {
+		stats.OpenedAt = b.openedAt.Format(time.RFC3339)
+	}
+	return stats
+}
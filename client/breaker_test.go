@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupBreakingClient(now *time.Time) (*BreakingClient, *mock.ClientMock) {
+	log := logrus.New()
+	log.SetOutput(os.Stdout)
+	pts := &mock.ClientMock{}
+	b := NewBreakingClient(log, pts, 3, 30*time.Second)
+	b.now = func() time.Time { return *now }
+	return b, pts
+}
+
+func TestBreakingClient_OpensAfterConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	b, pts := setupBreakingClient(&now)
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts timeout")
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := b.GetOperatorDetails(ctx, "+46107500500")
+		assert.NotNil(t, err)
+	}
+	assert.EqualValues(t, BreakerOpen, b.Stats().State)
+
+	_, err := b.GetOperatorDetails(ctx, "+46107500500")
+	assert.Equal(t, ErrCircuitOpen, err)
+	pts.AssertCallCount(t, "GetOperatorDetails", 3)
+	assert.EqualValues(t, 1, b.Stats().Rejected)
+}
+
+func TestBreakingClient_ClosesAfterSuccessfulTrial(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	b, pts := setupBreakingClient(&now)
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts timeout")
+	}
+	for i := 0; i < 3; i++ {
+		b.GetOperatorDetails(ctx, "+46107500500")
+	}
+
+	now = now.Add(31 * time.Second)
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+	resp, err := b.GetOperatorDetails(ctx, "+46107500500")
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "Telness AB", resp.D.Name)
+	assert.EqualValues(t, BreakerClosed, b.Stats().State)
+	assert.EqualValues(t, 0, b.Stats().ConsecutiveFailures)
+}
+
+func TestBreakingClient_ReopensAfterFailedTrial(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	b, pts := setupBreakingClient(&now)
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts timeout")
+	}
+	for i := 0; i < 3; i++ {
+		b.GetOperatorDetails(ctx, "+46107500500")
+	}
+
+	now = now.Add(31 * time.Second)
+	_, err := b.GetOperatorDetails(ctx, "+46107500500")
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrCircuitOpen, err)
+	assert.EqualValues(t, BreakerOpen, b.Stats().State)
+
+	_, err = b.GetOperatorDetails(ctx, "+46107500500")
+	assert.Equal(t, ErrCircuitOpen, err)
+}
+
+func TestBreakingClient_IgnoresCancelledCalls(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	b, pts := setupBreakingClient(&now)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, context.Canceled
+	}
+
+	for i := 0; i < 5; i++ {
+		_, err := b.GetOperatorDetails(cancelled, "+46107500500")
+		assert.Equal(t, context.Canceled, err)
+	}
+	assert.EqualValues(t, BreakerClosed, b.Stats().State)
+	assert.EqualValues(t, 0, b.Stats().ConsecutiveFailures)
+}
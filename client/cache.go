@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// OperatorMissing is the operator name PTS answers with when a number has no operator
+const OperatorMissing = "Operatör saknas"
+
+// maxCacheEntries bounds the cache, expired entries are removed once it grows beyond it
+const maxCacheEntries = 10000
+
+// OperatorLookup is implemented by Client and the decorators wrapping it
+type OperatorLookup interface {
+	GetOperatorDetails(ctx context.Context, msisdn string) (model.PtsResponse, error)
+}
+
+type cacheEntry struct {
+	response  model.PtsResponse
+	expiresAt time.Time
+}
+
+// call is a lookup in flight which concurrent callers for the same number wait for
+type call struct {
+	done     chan struct{}
+	response model.PtsResponse
+	err      error
+}
+
+// CachingClient caches operator lookups of the wrapped client. Numbers without operator are cached
+// for the negative ttl, failed lookups are not cached at all. Concurrent lookups of the same
+// number share one call to the wrapped client, made with the context of the first caller.
+type CachingClient struct {
+	// counters are accessed atomically and kept first for 64-bit alignment
+	hits         uint64
+	negativeHits uint64
+	misses       uint64
+	sharedCalls  uint64
+
+	next        OperatorLookup
+	log         *log.Logger
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+	inflight map[string]*call
+}
+
+func NewCachingClient(log *log.Logger, next OperatorLookup, ttl, negativeTTL time.Duration) *CachingClient {
+	return &CachingClient{
+		next:        next,
+		log:         log,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		entries:     make(map[string]cacheEntry),
+		inflight:    make(map[string]*call),
+	}
+}
+
+func (c *CachingClient) GetOperatorDetails(ctx context.Context, msisdn string) (model.PtsResponse, error) {
+	// +46107500500 and 0107500500 are the same number for PTS
+	key := string(formatMsisdn(msisdn))
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok && c.now().Before(entry.expiresAt) {
+		c.mu.Unlock()
+		if entry.response.D.Name == OperatorMissing {
+			atomic.AddUint64(&c.negativeHits, 1)
+		} else {
+			atomic.AddUint64(&c.hits, 1)
+		}
+		return entry.response, nil
+	}
+	if inflight, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		atomic.AddUint64(&c.sharedCalls, 1)
+		select {
+		case <-inflight.done:
+			return inflight.response, inflight.err
+		case <-ctx.Done():
+			return model.PtsResponse{}, ctx.Err()
+		}
+	}
+	current := &call{done: make(chan struct{})}
+	c.inflight[key] = current
+	c.mu.Unlock()
+	atomic.AddUint64(&c.misses, 1)
+
+	current.response, current.err = c.next.GetOperatorDetails(ctx, msisdn)
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if current.err == nil {
+		c.store(key, current.response)
+	}
+	c.mu.Unlock()
+	close(current.done)
+
+	if current.err != nil {
+		c.log.Errorf("could not look up operator for %v, result is not cached: %v", msisdn, current.err)
+	}
+	return current.response, current.err
+}
+
+// store caches the response, the caller must hold c.mu
+func (c *CachingClient) store(key string, response model.PtsResponse) {
+	ttl := c.ttl
+	if response.D.Name == OperatorMissing {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	now := c.now()
+	if len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		c.log.Warnf("pts cache is full with %d entries, not caching %v", len(c.entries), key)
+		return
+	}
+	c.entries[key] = cacheEntry{response: response, expiresAt: now.Add(ttl)}
+}
+
+// Stats returns the cache counters
+func (c *CachingClient) Stats() model.PtsCacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+	return model.PtsCacheStats{
+		Hits:         atomic.LoadUint64(&c.hits),
+		NegativeHits: atomic.LoadUint64(&c.negativeHits),
+		Misses:       atomic.LoadUint64(&c.misses),
+		SharedCalls:  atomic.LoadUint64(&c.sharedCalls),
+		Entries:      entries,
+		TTL:          c.ttl.String(),
+		NegativeTTL:  c.negativeTTL.String(),
+	}
+}
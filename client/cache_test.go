@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func setupCachingClient(now *time.Time) (*CachingClient, *mock.ClientMock) {
+	log := logrus.New()
+	log.SetOutput(os.Stdout)
+	pts := &mock.ClientMock{}
+	c := NewCachingClient(log, pts, time.Hour, time.Minute)
+	c.now = func() time.Time { return *now }
+	return c, pts
+}
+
+func TestCachingClient_CachesOperator(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	c, pts := setupCachingClient(&now)
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+
+	first, err := c.GetOperatorDetails(ctx, "+46107500500")
+	assert.Nil(t, err)
+	second, err := c.GetOperatorDetails(ctx, "0107500500")
+	assert.Nil(t, err)
+
+	assert.EqualValues(t, "Telness AB", first.D.Name)
+	assert.EqualValues(t, "Telness AB", second.D.Name)
+	pts.AssertCallCount(t, "GetOperatorDetails", 1)
+	stats := c.Stats()
+	assert.EqualValues(t, 1, stats.Hits)
+	assert.EqualValues(t, 1, stats.Misses)
+	assert.EqualValues(t, 1, stats.Entries)
+
+	now = now.Add(time.Hour)
+	_, err = c.GetOperatorDetails(ctx, "+46107500500")
+	assert.Nil(t, err)
+	pts.AssertCallCount(t, "GetOperatorDetails", 2)
+}
+
+func TestCachingClient_NegativeCaching(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	c, pts := setupCachingClient(&now)
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: OperatorMissing}}, nil
+	}
+
+	c.GetOperatorDetails(ctx, "+46107500500")
+	resp, err := c.GetOperatorDetails(ctx, "+46107500500")
+	assert.Nil(t, err)
+	assert.EqualValues(t, OperatorMissing, resp.D.Name)
+	pts.AssertCallCount(t, "GetOperatorDetails", 1)
+	assert.EqualValues(t, 1, c.Stats().NegativeHits)
+
+	// numbers without operator expire after the shorter negative ttl
+	now = now.Add(2 * time.Minute)
+	c.GetOperatorDetails(ctx, "+46107500500")
+	pts.AssertCallCount(t, "GetOperatorDetails", 2)
+}
+
+func TestCachingClient_DoesNotCacheErrors(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	c, pts := setupCachingClient(&now)
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts timeout")
+	}
+
+	_, err := c.GetOperatorDetails(ctx, "+46107500500")
+	assert.NotNil(t, err)
+	_, err = c.GetOperatorDetails(ctx, "+46107500500")
+	assert.NotNil(t, err)
+	pts.AssertCallCount(t, "GetOperatorDetails", 2)
+	assert.EqualValues(t, 0, c.Stats().Entries)
+}
+
+func TestCachingClient_CollapsesConcurrentLookups(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	c, pts := setupCachingClient(&now)
+	release := make(chan struct{})
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		<-release
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.GetOperatorDetails(ctx, "+46107500500")
+			assert.Nil(t, err)
+			assert.EqualValues(t, "Telness AB", resp.D.Name)
+		}()
+	}
+	// wait until every caller is either the lookup or waiting for it
+	for {
+		stats := c.Stats()
+		if stats.Misses+stats.SharedCalls == 10 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	pts.AssertCallCount(t, "GetOperatorDetails", 1)
+	assert.EqualValues(t, 9, c.Stats().SharedCalls)
+}
+
+func TestCachingClient_WaiterStopsWhenContextIsDone(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	c, pts := setupCachingClient(&now)
+	release := make(chan struct{})
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		<-release
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+	lookupDone := make(chan struct{})
+	go func() {
+		defer close(lookupDone)
+		c.GetOperatorDetails(ctx, "+46107500500")
+	}()
+	defer func() {
+		close(release)
+		<-lookupDone
+	}()
+	for c.Stats().Misses == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waiterCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.GetOperatorDetails(waiterCtx, "+46107500500")
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -1,12 +1,14 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/pmadhvi/telness-manager/apperr"
 	"github.com/pmadhvi/telness-manager/model"
 	log "github.com/sirupsen/logrus"
 )
@@ -23,12 +25,12 @@ func NewClient(log *log.Logger, host string) *Client {
 	}
 }
 
-func (c *Client) GetOperatorDetails(msisdn string) (model.PtsResponse, error) {
+func (c *Client) GetOperatorDetails(ctx context.Context, msisdn string) (model.PtsResponse, error) {
 	// format msisdn number in this format: 010-7500500
 	formattedMsisdn := formatMsisdn(msisdn)
 
 	// construct http request to send to pts
-	req, err := http.NewRequest(http.MethodGet, c.host, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.host, nil)
 	if err != nil {
 		msg := fmt.Sprintf("could not create http request: %v", err)
 		c.log.Errorf(msg)
@@ -50,14 +52,20 @@ func (c *Client) GetOperatorDetails(msisdn string) (model.PtsResponse, error) {
 	if err != nil {
 		msg := fmt.Sprintf("could not get response from PTS: %v", err)
 		c.log.Errorf(msg)
-		return model.PtsResponse{}, err
+		return model.PtsResponse{}, apperr.UpstreamUnavailable(apperr.CodePtsUnavailable, err, "could not get response from PTS")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err := fmt.Errorf("pts answered with status %v", response.StatusCode)
+		c.log.Error(err)
+		return model.PtsResponse{}, apperr.UpstreamUnavailable(apperr.CodePtsUnavailable, err, "could not get response from PTS")
 	}
 	// decode response from PTS to telness model
 	err = json.NewDecoder(response.Body).Decode(&ptsResponse)
 	if err != nil {
 		msg := fmt.Sprintf("could not decode pts response into PtsResponse: %v", err)
 		c.log.Error(msg)
-		return model.PtsResponse{}, err
+		return model.PtsResponse{}, apperr.UpstreamUnavailable(apperr.CodePtsUnavailable, err, "could not decode response from PTS")
 	}
 	return ptsResponse, nil
 }
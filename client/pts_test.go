@@ -1,54 +1,112 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
-	"github.com/pmadhvi/telness-manager/mock"
-	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/ptsfake"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
-var client = &mock.ClientMock{}
-
-func GetOperatorSuccess() {
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
-		return model.PtsResponse{
-			D: model.OperatorDetails{Name: "Telness AB"},
-		}, nil
-	}
-}
-
-func GetOperatorFail() {
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
-		return model.PtsResponse{
-			D: model.OperatorDetails{Name: "Operatör saknas"},
-		}, nil
-	}
+// setupClient returns a client calling a fake PTS of its own
+func setupClient(t *testing.T) (*Client, *ptsfake.Server) {
+	log := logrus.New()
+	log.SetOutput(os.Stdout)
+	pts := ptsfake.New(map[string]string{
+		"+46107500500": "Telness AB",
+		"+46701234567": "Tele2 Sverige AB",
+	})
+	ts := httptest.NewServer(pts)
+	t.Cleanup(ts.Close)
+	return NewClient(log, ts.URL+ptsfake.Path), pts
 }
 
 func TestGetOperatorDetailsSuccessWithoutCountryCode(t *testing.T) {
-	msisdn := "0107500500"
-	GetOperatorSuccess()
-	resp, err := client.GetOperatorDetails(msisdn)
-	assert.NotNil(t, resp)
+	t.Parallel()
+	client, pts := setupClient(t)
+
+	resp, err := client.GetOperatorDetails(ctx, "0107500500")
+
 	assert.Nil(t, err)
 	assert.EqualValues(t, "Telness AB", resp.D.Name)
+	assert.EqualValues(t, []string{"010-7500500"}, pts.Requested())
 }
 
 func TestGetOperatorDetailsSuccessWithCountryCode(t *testing.T) {
-	msisdn := "+46107500500"
-	GetOperatorSuccess()
-	resp, err := client.GetOperatorDetails(msisdn)
-	assert.NotNil(t, resp)
+	t.Parallel()
+	client, pts := setupClient(t)
+
+	resp, err := client.GetOperatorDetails(ctx, "+46701234567")
+
 	assert.Nil(t, err)
-	assert.EqualValues(t, "Telness AB", resp.D.Name)
+	assert.EqualValues(t, "Tele2 Sverige AB", resp.D.Name)
+	assert.EqualValues(t, "070-1234567", resp.D.Number)
+	assert.EqualValues(t, []string{"070-1234567"}, pts.Requested())
 }
 
 func TestGetOperatorDetailsWithWrongFormat(t *testing.T) {
-	msisdn := "0107500500000"
-	GetOperatorFail()
-	resp, err := client.GetOperatorDetails(msisdn)
-	assert.NotNil(t, resp)
+	t.Parallel()
+	client, _ := setupClient(t)
+
+	resp, err := client.GetOperatorDetails(ctx, "0107500500000")
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, OperatorMissing, resp.D.Name)
+}
+
+func TestGetOperatorDetailsServerError(t *testing.T) {
+	t.Parallel()
+	client, pts := setupClient(t)
+	pts.FailNext(http.StatusInternalServerError)
+
+	_, err := client.GetOperatorDetails(ctx, "+46107500500")
+
+	assert.True(t, errors.Is(err, apperr.ErrUpstreamUnavailable))
+	assert.EqualValues(t, apperr.CodePtsUnavailable, apperr.CodeOf(err))
+	resp, err := client.GetOperatorDetails(ctx, "+46107500500")
 	assert.Nil(t, err)
-	assert.EqualValues(t, "Operatör saknas", resp.D.Name)
+	assert.EqualValues(t, "Telness AB", resp.D.Name)
+}
+
+func TestGetOperatorDetailsMalformedResponse(t *testing.T) {
+	t.Parallel()
+	client, pts := setupClient(t)
+	pts.SetFaults(ptsfake.Faults{MalformedRate: 1})
+
+	_, err := client.GetOperatorDetails(ctx, "+46107500500")
+
+	assert.True(t, errors.Is(err, apperr.ErrUpstreamUnavailable))
+}
+
+func TestGetOperatorDetailsSlowResponse(t *testing.T) {
+	t.Parallel()
+	client, pts := setupClient(t)
+	pts.SetFaults(ptsfake.Faults{Latency: time.Second})
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetOperatorDetails(timeout, "+46107500500")
+
+	assert.True(t, errors.Is(err, apperr.ErrUpstreamUnavailable))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestFormatMsisdn(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"+46107500500": "010-7500500",
+		"0107500500":   "010-7500500",
+		"+46701234567": "070-1234567",
+		"08123456":     "081-23456",
+	}
+	for msisdn, formatted := range tests {
+		assert.EqualValues(t, formatted, string(formatMsisdn(msisdn)), msisdn)
+	}
 }
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// Webhook posts ported out events as json to a configured url
+type Webhook struct {
+	url        string
+	log        *log.Logger
+	httpClient *http.Client
+}
+
+func NewWebhook(log *log.Logger, url string) *Webhook {
+	return &Webhook{
+		url: url,
+		log: log,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+func (w *Webhook) NotifyPortedOut(ctx context.Context, event model.PortabilityEvent) error {
+	body, err := json.Marshal(struct {
+		Type  string                 `json:"type"`
+		Event model.PortabilityEvent `json:"event"`
+	}{
+		Type:  "subscription.ported_out",
+		Event: event,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		w.log.Errorf("could not create webhook request: %v", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, err := w.httpClient.Do(req)
+	if err != nil {
+		w.log.Errorf("could not call webhook: %v", err)
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %v", response.StatusCode)
+	}
+	return nil
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 	"github.com/pmadhvi/telness-manager/client"
 	"github.com/pmadhvi/telness-manager/handlers"
+	"github.com/pmadhvi/telness-manager/model"
 	"github.com/pmadhvi/telness-manager/postgres"
 	"github.com/pmadhvi/telness-manager/service"
+	"github.com/pmadhvi/telness-manager/storage"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,42 +29,144 @@ func main() {
 	if err != nil {
 		log.Errorf("Error loading .env file %v", err)
 	}
+	migrate := flag.Bool("migrate", os.Getenv("MIGRATE_ON_START") == "true", "apply pending database migrations before starting")
+	flag.Parse()
 	// read the env variables from .env file
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Info("port env variable not set, so using default port 8080")
 		port = "8080"
 	}
-	dbname := os.Getenv("POSTGRES_DB")
-	dbuser := os.Getenv("POSTGRES_USER")
-	dbpass := os.Getenv("POSTGRES_PASSWORD")
-	dbhost := os.Getenv("POSTGRES_HOST")
-	dbport := os.Getenv("POSTGRES_PORT")
 	ptsHost := os.Getenv("PTS_HOST")
+	ptsCacheTTL, err := time.ParseDuration(os.Getenv("PTS_CACHE_TTL"))
+	if err != nil {
+		log.Info("pts cache ttl env variable not set or invalid, so using default ttl 1h")
+		ptsCacheTTL = time.Hour
+	}
+	ptsNegativeCacheTTL, err := time.ParseDuration(os.Getenv("PTS_NEGATIVE_CACHE_TTL"))
+	if err != nil {
+		log.Info("pts negative cache ttl env variable not set or invalid, so using default ttl 5m")
+		ptsNegativeCacheTTL = 5 * time.Minute
+	}
+	requestTimeout, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT"))
+	if err != nil {
+		log.Info("request timeout env variable not set or invalid, so using default timeout 10s")
+		requestTimeout = 10 * time.Second
+	}
+	activationInterval, err := time.ParseDuration(os.Getenv("ACTIVATION_INTERVAL"))
+	if err != nil {
+		log.Info("activation interval env variable not set or invalid, so using default interval 1m")
+		activationInterval = time.Minute
+	}
+	operatorRefreshInterval, err := time.ParseDuration(os.Getenv("OPERATOR_REFRESH_INTERVAL"))
+	if err != nil {
+		log.Info("operator refresh interval env variable not set or invalid, so using default interval 10m")
+		operatorRefreshInterval = 10 * time.Minute
+	}
+	operatorMaxAge, err := time.ParseDuration(os.Getenv("OPERATOR_MAX_AGE"))
+	if err != nil {
+		log.Info("operator max age env variable not set or invalid, so using default max age 24h")
+		operatorMaxAge = 24 * time.Hour
+	}
+	portabilityInterval, err := time.ParseDuration(os.Getenv("PORTABILITY_INTERVAL"))
+	if err != nil {
+		log.Info("portability interval env variable not set or invalid, so using default interval 6h")
+		portabilityInterval = 6 * time.Hour
+	}
+	idempotencyKeyTTL, err := time.ParseDuration(os.Getenv("IDEMPOTENCY_KEY_TTL"))
+	if err != nil {
+		log.Info("idempotency key ttl env variable not set or invalid, so using default ttl 24h")
+		idempotencyKeyTTL = 24 * time.Hour
+	}
+	v1Deprecation, err := time.Parse("2006-01-02", os.Getenv("API_V1_DEPRECATION"))
+	if err != nil {
+		log.Info("api v1 deprecation env variable not set or invalid, so using default deprecation 2026-10-18")
+		v1Deprecation = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	}
+	v1Sunset, err := time.Parse("2006-01-02", os.Getenv("API_V1_SUNSET"))
+	if err != nil {
+		log.Info("api v1 sunset env variable not set or invalid, so using default sunset 2027-04-18")
+		v1Sunset = time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+	}
+	validateRequests := os.Getenv("VALIDATE_REQUESTS") == "true"
+	expectedOperator := os.Getenv("EXPECTED_OPERATOR")
+	if expectedOperator == "" {
+		expectedOperator = "Telness AB"
+	}
+	portedOutStatus := model.SubStatus(os.Getenv("PORTED_OUT_STATUS"))
+	if portedOutStatus != "" && portedOutStatus != model.StatusPaused && portedOutStatus != model.StatusCancelled {
+		log.Errorf("ported out status %v is not paused or cancelled, so ported out subscriptions keep their status", portedOutStatus)
+		portedOutStatus = ""
+	}
+	portedOutWebhook := os.Getenv("PORTED_OUT_WEBHOOK_URL")
 
-	//Open db connection
-	dbinfo := fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=disable",
-		dbuser,
-		dbpass,
-		dbhost,
-		dbport,
-		dbname)
-
-	db, err := sql.Open("postgres", dbinfo)
+	// open the storage backend configured by STORAGE
+	store, err := storage.Open(storage.ConfigFromEnv(), log)
 	if err != nil {
-		log.Errorf("error connecting database %v", err)
+		log.Errorf("could not open storage: %v", err)
+		os.Exit(1)
 	}
+	defer store.Close()
+	log.Infof("storing subscriptions in %v", store.Backend)
 
-	defer db.Close()
+	migrator, err := store.Migrator()
+	if err != nil {
+		log.Errorf("could not read database migrations: %v", err)
+		os.Exit(1)
+	}
+	// telness-manager migrate up|down|status only migrates the database
+	if flag.Arg(0) == "migrate" {
+		if migrator == nil {
+			log.Errorf("the %v storage has no schema to migrate", store.Backend)
+			os.Exit(1)
+		}
+		if err := runMigrate(context.Background(), log, migrator, flag.Args()[1:]); err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *migrate && migrator == nil {
+		log.Infof("the %v storage has no schema to migrate, skipping migrations", store.Backend)
+	} else if *migrate {
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Errorf("could not migrate database: %v", err)
+			os.Exit(1)
+		}
+		log.Infof("database is migrated, applied %d migrations", applied)
+	}
 
 	var (
-		subscriptionRepo = postgres.NewSubscriptionRepo(db, log)
-		client           = client.NewClient(log, ptsHost)
-		subsvc           = service.SubscriptionSvc{Log: log, SubscriptionRepo: subscriptionRepo, PtsClient: client}
+		subscriptionRepo = store.Repo
+		ptsBreaker       = client.NewBreakingClient(log, client.NewClient(log, ptsHost), 5, 30*time.Second)
+		ptsClient        = client.NewCachingClient(log, ptsBreaker, ptsCacheTTL, ptsNegativeCacheTTL)
+		subsvc           = service.SubscriptionSvc{Log: log, SubscriptionRepo: subscriptionRepo, PtsClient: ptsClient, OperatorMaxAge: operatorMaxAge}
+		activationLock   = store.Lock(postgres.ActivationLockKey)
+		scheduler        = service.NewScheduler(log, subsvc, subscriptionRepo, activationLock, activationInterval)
+		refreshLock      = store.Lock(postgres.OperatorRefreshLockKey)
+		refresher        = service.NewOperatorRefresher(log, subscriptionRepo, ptsClient, refreshLock, operatorRefreshInterval, operatorMaxAge)
+		portabilityLock  = store.Lock(postgres.PortabilityLockKey)
+		reconciler       = service.NewPortabilityReconciler(log, subsvc, subscriptionRepo, portabilityLock, portabilityInterval, expectedOperator)
 	)
+	reconciler.PortedOutStatus = portedOutStatus
+	if portedOutWebhook != "" {
+		reconciler.Notifier = client.NewWebhook(log, portedOutWebhook)
+	}
+
+	// start the scheduler which activates pending subscriptions once activate_at is reached
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go scheduler.Run(jobsCtx)
+	// start the refresher which keeps the stored operators up to date
+	go refresher.Run(jobsCtx)
+	// start the reconciler which detects numbers ported away from the expected operator
+	go reconciler.Run(jobsCtx)
+	// remove idempotency keys once they have expired
+	go purgeIdempotencyKeys(jobsCtx, log, subscriptionRepo, time.Hour)
 
 	// setup server and routes
-	server := handlers.Server{Log: log, Port: port, SubscriptionService: subsvc}
+	server := handlers.Server{Log: log, Port: port, RequestTimeout: requestTimeout, SubscriptionService: subsvc, Scheduler: scheduler, PtsCache: ptsClient, PtsBreaker: ptsBreaker, OperatorRefresher: refresher, Portability: reconciler, Idempotency: subscriptionRepo, IdempotencyTTL: idempotencyKeyTTL, V1Deprecation: v1Deprecation, V1Sunset: v1Sunset, ValidateRequests: validateRequests}
 
 	errorChan := make(chan error)
 	quit := make(chan os.Signal, 1)
@@ -83,3 +188,28 @@ func main() {
 	}
 
 }
+
+type idempotencyKeyPurger interface {
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// purgeIdempotencyKeys deletes expired idempotency keys every interval until ctx is done
+func purgeIdempotencyKeys(ctx context.Context, log *logrus.Logger, repo idempotencyKeyPurger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+			if err != nil {
+				log.Errorf("could not delete expired idempotency keys: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				log.Infof("deleted %d expired idempotency keys", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = "usage: telness-manager migrate up | down [steps] | status"
+
+// runMigrate runs the migrate subcommand: up applies all pending migrations, down reverts the last
+// steps migrations (one by default) and status lists which migrations are applied
+func runMigrate(ctx context.Context, log *logrus.Logger, migrator storage.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Infof("applied %d migrations", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, not %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		log.Infof("reverted %d migrations", reverted)
+	case "status":
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, state := range states {
+			appliedAt := "pending"
+			if !state.AppliedAt.IsZero() {
+				appliedAt = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%v\t%v\n", state.Version, state.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// ptsfake serves a fake PTS number service for development, so the app does not call api.pts.se.
+// Point PTS_HOST at http://localhost:8090/PTSNumberService/Pts_Number_Service.svc/json/SearchByNumber.
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/ptsfake"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	var log = logrus.New()
+	log.SetOutput(os.Stdout)
+
+	addr := flag.String("addr", ":8090", "address to listen on")
+	data := flag.String("data", "", "json file of numbers and their operators, e.g. {\"+46107500500\": \"Telness AB\"}, by default the numbers of the examples")
+	latency := flag.Duration("latency", 0, "delay every answer by this long")
+	errorRate := flag.Float64("error-rate", 0, "share of requests failing with -error-status, between 0 and 1")
+	errorStatus := flag.Int("error-status", http.StatusServiceUnavailable, "status of failing requests")
+	malformedRate := flag.Float64("malformed-rate", 0, "share of requests answered with invalid json, between 0 and 1")
+	flag.Parse()
+
+	server := ptsfake.Default()
+	if *data != "" {
+		file, err := os.Open(*data)
+		if err != nil {
+			log.Fatalf("could not open dataset: %v", err)
+		}
+		operators, err := ptsfake.LoadDataset(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("could not load dataset %v: %v", *data, err)
+		}
+		server = ptsfake.New(operators)
+	}
+	server.SetFaults(ptsfake.Faults{
+		Latency:       *latency,
+		ErrorRate:     *errorRate,
+		ErrorStatus:   *errorStatus,
+		MalformedRate: *malformedRate,
+	})
+
+	log.Infof("fake PTS is listening on %v%v", *addr, ptsfake.Path)
+	httpServer := &http.Server{Addr: *addr, Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	if err := httpServer.ListenAndServe(); err != nil {
+		log.Fatalf("fake PTS stopped: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/sdk"
+)
+
+func commands() map[string]command {
+	cmds := []command{
+		createCommand(),
+		findCommand(),
+		statusCommand(),
+		rescheduleCommand(),
+		listCommand(),
+		importCommand(),
+		exportCommand(),
+		completionCommand(),
+	}
+	byName := make(map[string]command, len(cmds))
+	for _, cmd := range cmds {
+		byName[cmd.name] = cmd
+	}
+	return byName
+}
+
+func createCommand() command {
+	var sub model.CreateSubscription
+	return command{
+		name:    "create",
+		usage:   "--msisdn +46107500500 --activate-at 2027-01-01 --sub-type pbx [--status pending]",
+		summary: "create a subscription",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&sub.Msisdn, "msisdn", "", "msisdn of the subscription")
+			fs.StringVar(&sub.ActivateAt, "activate-at", "", "activation date, format 2006-01-02")
+			fs.StringVar(&sub.SubType, "sub-type", "", "subscription type, e.g. pbx or cell")
+			fs.StringVar((*string)(&sub.Status), "status", string(model.StatusPending), "status of the new subscription")
+		},
+		run: func(ctx context.Context, env *environment, args []string) error {
+			created, err := env.client.Create(ctx, sub)
+			if err != nil {
+				return err
+			}
+			return env.printSubscriptions(created)
+		},
+	}
+}
+
+func findCommand() command {
+	return command{
+		name:    "find",
+		usage:   "<msisdn>",
+		summary: "show a subscription",
+		run: func(ctx context.Context, env *environment, args []string) error {
+			if len(args) != 1 {
+				return errors.New("find needs the msisdn of the subscription")
+			}
+			sub, err := env.client.Get(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			return env.printSubscriptions(sub)
+		},
+	}
+}
+
+func statusCommand() command {
+	var (
+		version int64
+		force   bool
+	)
+	return command{
+		name:    "status",
+		usage:   "<msisdn> <pending|activated|paused|cancelled>",
+		summary: "change the status of a subscription",
+		flags: func(fs *flag.FlagSet) {
+			fs.Int64Var(&version, "expect-version", 0, "only change the subscription when it still has this version, required unless -force")
+			fs.BoolVar(&force, "force", false, "change the subscription whatever its version, overwriting changes made by others")
+		},
+		run: func(ctx context.Context, env *environment, args []string) error {
+			if len(args) != 2 {
+				return errors.New("status needs the msisdn and the new status")
+			}
+			msisdn, status := args[0], model.SubStatus(args[1])
+			expected, err := changeVersion(version, force, env.opts.dryRun)
+			if err != nil {
+				return err
+			}
+			sub, err := env.client.SetStatus(ctx, msisdn, status, expected)
+			if err != nil {
+				return err
+			}
+			return env.printSubscriptions(sub)
+		},
+	}
+}
+
+func rescheduleCommand() command {
+	var (
+		version int64
+		force   bool
+	)
+	return command{
+		name:    "reschedule",
+		usage:   "<msisdn> <date>",
+		summary: "change the activation date of a pending subscription",
+		flags: func(fs *flag.FlagSet) {
+			fs.Int64Var(&version, "expect-version", 0, "only change the subscription when it still has this version, required unless -force")
+			fs.BoolVar(&force, "force", false, "change the subscription whatever its version, overwriting changes made by others")
+		},
+		run: func(ctx context.Context, env *environment, args []string) error {
+			if len(args) != 2 {
+				return errors.New("reschedule needs the msisdn and the new activation date")
+			}
+			msisdn, date := args[0], args[1]
+			expected, err := changeVersion(version, force, env.opts.dryRun)
+			if err != nil {
+				return err
+			}
+			sub, err := env.client.SetActivationDate(ctx, msisdn, date, expected)
+			if err != nil {
+				return err
+			}
+			return env.printSubscriptions(sub)
+		},
+	}
+}
+
+// changeVersion is the version a change is sent with, a change without -expect-version must be
+// forced explicitly so it never overwrites someone else's change by accident. A dry run changes
+// nothing, without -expect-version it is checked against the current version.
+func changeVersion(version int64, force, dryRun bool) (int64, error) {
+	switch {
+	case force && version != 0:
+		return 0, errors.New("use either -expect-version or -force")
+	case force, dryRun && version <= 0:
+		return sdk.Force(), nil
+	case version <= 0:
+		return 0, errors.New("-expect-version is required, it is the version shown by find; use -force to change any version")
+	}
+	return version, nil
+}
+
+// listFlags registers the filter flags shared by list and export
+func listFlags(fs *flag.FlagSet, list *sdk.ListOptions, status, subType *string) {
+	fs.StringVar(status, "status", "", "only subscriptions with these statuses, comma separated")
+	fs.StringVar(subType, "sub-type", "", "only subscriptions with these types, comma separated")
+	fs.StringVar(&list.MsisdnPrefix, "prefix", "", "only msisdns starting with this prefix, e.g. +46107")
+	fs.StringVar(&list.Sort, "sort", "", "sort by msisdn, activate_at, created_at or modified_at")
+	fs.StringVar(&list.Order, "order", "", "asc or desc")
+}
+
+// listOptions adds the comma separated status and sub type flags to the list options
+func listOptions(list sdk.ListOptions, status, subType string) sdk.ListOptions {
+	for _, s := range splitList(status) {
+		list.Status = append(list.Status, model.SubStatus(s))
+	}
+	list.SubType = splitList(subType)
+	return list
+}
+
+func listCommand() command {
+	var (
+		list            sdk.ListOptions
+		status, subType string
+	)
+	return command{
+		name:    "list",
+		usage:   "[--status pending,paused] [--limit 50] [--cursor <next cursor>]",
+		summary: "list one page of subscriptions",
+		flags: func(fs *flag.FlagSet) {
+			listFlags(fs, &list, &status, &subType)
+			fs.IntVar(&list.Limit, "limit", 50, "page size, at most 500")
+			fs.StringVar(&list.Cursor, "cursor", "", "next cursor printed by the previous page")
+		},
+		run: func(ctx context.Context, env *environment, args []string) error {
+			page, err := env.client.List(ctx, listOptions(list, status, subType))
+			if err != nil {
+				return err
+			}
+			if err := env.printSubscriptions(page.Subscriptions...); err != nil {
+				return err
+			}
+			if page.NextCursor != "" && env.opts.output == "table" {
+				fmt.Fprintf(env.out, "\nnext page: --cursor %v\n", page.NextCursor)
+			}
+			return nil
+		},
+	}
+}
+
+func exportCommand() command {
+	var (
+		list            sdk.ListOptions
+		status, subType string
+	)
+	return command{
+		name:    "export",
+		usage:   "[--status activated] [-o csv]",
+		summary: "print every subscription matching the filter as the api streams them",
+		flags: func(fs *flag.FlagSet) {
+			listFlags(fs, &list, &status, &subType)
+		},
+		run: func(ctx context.Context, env *environment, args []string) error {
+			out := env.newRowPrinter(subscriptionColumns)
+			err := env.client.Export(ctx, listOptions(list, status, subType), true, func(sub model.Subscription) error {
+				return out.print(sub, subscriptionRow(sub))
+			})
+			if err != nil {
+				return err
+			}
+			return out.close()
+		},
+	}
+}
+
+func importCommand() command {
+	var (
+		format string
+		atomic bool
+	)
+	return command{
+		name:    "import",
+		usage:   "[--atomic] <file.csv|file.ndjson|->",
+		summary: "create the subscriptions of a csv or ndjson file in one request",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&format, "format", "", "csv or ndjson, by default taken from the file extension")
+			fs.BoolVar(&atomic, "atomic", false, "create every row or none of them")
+		},
+		run: func(ctx context.Context, env *environment, args []string) error {
+			if len(args) != 1 {
+				return errors.New("import needs a file, or - for stdin")
+			}
+			var in io.Reader = os.Stdin
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+				if format == "" {
+					format = strings.TrimPrefix(filepath.Ext(args[0]), ".")
+				}
+			}
+			var contentType string
+			switch format {
+			case "csv":
+				contentType = "text/csv"
+			case "ndjson", "jsonl":
+				contentType = "application/x-ndjson"
+			default:
+				return fmt.Errorf("format %q is not csv or ndjson", format)
+			}
+			// a dry run lets the api validate every row without creating any
+			result, err := env.client.Import(ctx, in, contentType, sdk.ImportOptions{ValidateOnly: env.opts.dryRun, Atomic: atomic})
+			if err != nil {
+				return err
+			}
+			if err := env.printImportResults(result.Rows); err != nil {
+				return err
+			}
+			if result.Failed > 0 {
+				return fmt.Errorf("%d of %d rows failed", result.Failed, result.Total)
+			}
+			return nil
+		},
+	}
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+func completionCommand() command {
+	return command{
+		name:    "completion",
+		usage:   "<bash|zsh>",
+		summary: "print a shell completion script, e.g. source <(telness-ctl completion bash)",
+		run: func(ctx context.Context, env *environment, args []string) error {
+			if len(args) != 1 {
+				return errors.New("completion needs the shell, bash or zsh")
+			}
+			switch args[0] {
+			case "bash":
+				fmt.Fprint(env.out, bashCompletion())
+			case "zsh":
+				// zsh understands bash completion scripts once bashcompinit is loaded
+				fmt.Fprint(env.out, "autoload -U +X bashcompinit && bashcompinit\n"+bashCompletion())
+			default:
+				return fmt.Errorf("shell %q is not bash or zsh", args[0])
+			}
+			return nil
+		},
+	}
+}
+
+// bashCompletion completes the commands and the flags of each command, taken from the
+// commands themselves so the script does not go out of date
+func bashCompletion() string {
+	cmds := commands()
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var cases strings.Builder
+	for _, name := range names {
+		cmd := cmds[name]
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		commonFlags(fs, &options{})
+		if cmd.flags != nil {
+			cmd.flags(fs)
+		}
+		var flags []string
+		fs.VisitAll(func(f *flag.Flag) {
+			flags = append(flags, "-"+f.Name)
+		})
+		fmt.Fprintf(&cases, "    %v) words=%q ;;\n", name, strings.Join(flags, " "))
+	}
+
+	return fmt.Sprintf(`_telness_ctl() {
+  local cur words
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  if [ "$COMP_CWORD" -eq 1 ]; then
+    COMPREPLY=($(compgen -W %q -- "$cur"))
+    return
+  fi
+  case "${COMP_WORDS[1]}" in
+%v    *) words="" ;;
+  esac
+  case "$cur" in
+    -*) COMPREPLY=($(compgen -W "$words" -- "$cur")) ;;
+    *) COMPREPLY=($(compgen -f -- "$cur")) ;;
+  esac
+}
+complete -F _telness_ctl telness-ctl
+`, strings.Join(names, " "), cases.String())
+}
@@ -0,0 +1,233 @@
+// telness-ctl is the command line tool for support staff to look at and change subscriptions,
+// either through the REST api or straight against the database.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pmadhvi/telness-manager/client"
+	"github.com/pmadhvi/telness-manager/handlers"
+	"github.com/pmadhvi/telness-manager/sdk"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/pmadhvi/telness-manager/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// options are the flags every command accepts
+type options struct {
+	api     string
+	token   string
+	db      bool
+	output  string
+	dryRun  bool
+	actor   string
+	timeout time.Duration
+}
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	// flags registers the flags of the command besides the common ones
+	flags func(fs *flag.FlagSet)
+	run   func(ctx context.Context, env *environment, args []string) error
+}
+
+// environment is what a command runs with
+type environment struct {
+	opts   options
+	client *sdk.Client
+	out    io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		return 2
+	}
+	cmd, ok := commands()[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+
+	var opts options
+	fs := flag.NewFlagSet("telness-ctl "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	commonFlags(fs, &opts)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: telness-ctl %v %v\n\n%v\n\nflags:\n", cmd.name, cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if opts.output != "table" && opts.output != "json" && opts.output != "csv" {
+		fmt.Fprintf(stderr, "output %q is not table, json or csv\n", opts.output)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	env := &environment{opts: opts, out: stdout}
+	if cmd.name != "completion" {
+		apiClient, closeClient, err := newClient(opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return 1
+		}
+		defer closeClient()
+		env.client = apiClient
+	}
+	if err := cmd.run(ctx, env, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func commonFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.api, "api", envOr("TELNESS_API_URL", "http://localhost:8080"), "url of the api, env TELNESS_API_URL")
+	fs.StringVar(&opts.token, "token", os.Getenv("TELNESS_API_TOKEN"), "bearer token for the api, env TELNESS_API_TOKEN")
+	fs.BoolVar(&opts.db, "db", false, "go straight to the storage configured by the STORAGE, POSTGRES_* and SQLITE_PATH env variables instead of the api")
+	fs.StringVar(&opts.output, "o", "table", "output format: table, json or csv")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "let the api check the change and show what it would be, without changing anything")
+	fs.StringVar(&opts.actor, "actor", envOr("USER", "telness-ctl"), "who makes the change, recorded in the subscription history")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "timeout of every request")
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: telness-ctl <command> [flags] [args]\n\ncommands:\n")
+	cmds := commands()
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-12v %v\n", name, cmds[name].summary)
+	}
+	fmt.Fprintf(w, "\nrun telness-ctl <command> -h for the flags of a command\n")
+}
+
+// newClient returns a client for the api, or with --db a client running the api handlers in
+// process against the database, so the same validation and status rules apply either way
+func newClient(opts options) (*sdk.Client, func(), error) {
+	clientOptions := []sdk.Option{sdk.WithActor(opts.actor), sdk.WithHTTPClient(&http.Client{Timeout: opts.timeout})}
+	if opts.token != "" {
+		clientOptions = append(clientOptions, sdk.WithAuth(sdk.BearerToken(opts.token)))
+	}
+	if opts.dryRun {
+		// the api checks every change as if it made it, but changes nothing
+		clientOptions = append(clientOptions, sdk.WithValidateOnly())
+	}
+	if !opts.db {
+		return sdk.NewClient(opts.api, clientOptions...), func() {}, nil
+	}
+
+	godotenv.Load()
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	store, err := storage.Open(storage.ConfigFromEnv(), log)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		subscriptionRepo = store.Repo
+		ptsClient        = client.NewClient(log, os.Getenv("PTS_HOST"))
+		subsvc           = service.SubscriptionSvc{Log: log, SubscriptionRepo: subscriptionRepo, PtsClient: ptsClient}
+		server           = handlers.Server{Log: log, SubscriptionService: subsvc, Idempotency: subscriptionRepo}
+	)
+	clientOptions = append(clientOptions,
+		sdk.WithHTTPClient(&http.Client{Timeout: opts.timeout, Transport: handlerTransport{handler: server.Router()}}),
+		// a failed request did not get lost on the way, so there is nothing to retry
+		sdk.WithRetries(0, 0))
+	return sdk.NewClient("http://telness-ctl", clientOptions...), func() { store.Close() }, nil
+}
+
+// handlerTransport serves requests with the api handlers in process instead of sending them. The
+// response body is passed on while the handler writes it, so an export is not held in memory.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, out := io.Pipe()
+	rw := &pipeResponseWriter{header: http.Header{}, out: out, started: make(chan struct{})}
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				// the handler aborted the response, e.g. an export failing half way
+				rw.WriteHeader(http.StatusInternalServerError)
+				out.CloseWithError(fmt.Errorf("the api aborted the response: %v", recovered))
+			}
+		}()
+		t.handler.ServeHTTP(rw, req)
+		rw.WriteHeader(http.StatusOK)
+		out.Close()
+	}()
+	<-rw.started
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %v", rw.status, http.StatusText(rw.status)),
+		StatusCode: rw.status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     rw.sent,
+		Body:       body,
+		Request:    req,
+	}, nil
+}
+
+// pipeResponseWriter is the response of a handler served by handlerTransport, started is closed
+// once the status and headers are sent
+type pipeResponseWriter struct {
+	header  http.Header
+	sent    http.Header
+	status  int
+	out     *io.PipeWriter
+	once    sync.Once
+	started chan struct{}
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(status int) {
+	w.once.Do(func() {
+		w.status, w.sent = status, w.header.Clone()
+		close(w.started)
+	})
+}
+
+func (w *pipeResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.out.Write(data)
+}
+
+func envOr(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/client"
+	"github.com/pmadhvi/telness-manager/handlers"
+	"github.com/pmadhvi/telness-manager/memory"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/ptsfake"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const msisdn = "+46107500500"
+
+var tomorrow = time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+
+// setupAPI starts the api against the memory backend and a fake PTS, and returns its url
+func setupAPI(t *testing.T) string {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	pts := httptest.NewServer(ptsfake.Default())
+	t.Cleanup(pts.Close)
+	repo := memory.NewSubscriptionRepo()
+	subsvc := service.SubscriptionSvc{Log: log, SubscriptionRepo: repo, PtsClient: client.NewClient(log, pts.URL+ptsfake.Path)}
+	api := httptest.NewServer(handlers.Server{Log: log, SubscriptionService: subsvc, Idempotency: repo}.Router())
+	t.Cleanup(api.Close)
+	return api.URL
+}
+
+// ctl runs telness-ctl with args and returns its exit code, stdout and stderr
+func ctl(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func create(t *testing.T, api string) {
+	code, _, stderr := ctl("create", "-api", api, "-msisdn", msisdn, "-activate-at", tomorrow, "-sub-type", "pbx")
+	assert.EqualValues(t, 0, code, stderr)
+}
+
+func find(t *testing.T, api string) model.Subscription {
+	code, stdout, stderr := ctl("find", "-api", api, "-o", "json", msisdn)
+	assert.EqualValues(t, 0, code, stderr)
+	var subs []model.Subscription
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &subs))
+	assert.Len(t, subs, 1)
+	if len(subs) == 0 {
+		return model.Subscription{}
+	}
+	return subs[0]
+}
+
+func TestRun_Usage(t *testing.T) {
+	code, _, stderr := ctl()
+	assert.EqualValues(t, 2, code)
+	assert.Contains(t, stderr, "commands:")
+
+	code, _, stderr = ctl("delete")
+	assert.EqualValues(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "delete"`)
+
+	code, _, stderr = ctl("list", "-o", "yaml")
+	assert.EqualValues(t, 2, code)
+	assert.Contains(t, stderr, `output "yaml" is not table, json or csv`)
+}
+
+func TestRun_Output(t *testing.T) {
+	api := setupAPI(t)
+	create(t, api)
+
+	code, stdout, stderr := ctl("find", "-api", api, msisdn)
+	assert.EqualValues(t, 0, code, stderr)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "MSISDN "))
+	fields := strings.Fields(lines[1])
+	assert.Equal(t, []string{msisdn, "pbx", "pending"}, []string{fields[0], fields[2], fields[3]})
+	assert.Contains(t, lines[1], "Telness AB")
+
+	sub := find(t, api)
+	assert.EqualValues(t, msisdn, sub.Msisdn)
+	assert.EqualValues(t, model.StatusPending, sub.Status)
+	assert.EqualValues(t, 1, sub.Version)
+
+	code, stdout, stderr = ctl("list", "-api", api, "-o", "csv")
+	assert.EqualValues(t, 0, code, stderr)
+	records, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, subscriptionColumns, records[0])
+	assert.Equal(t, []string{msisdn, "pbx", "pending", "Telness AB"}, []string{records[1][0], records[1][2], records[1][3], records[1][4]})
+}
+
+func TestRun_Export(t *testing.T) {
+	api := setupAPI(t)
+	create(t, api)
+	code, _, stderr := ctl("create", "-api", api, "-msisdn", "+46107500501", "-activate-at", tomorrow, "-sub-type", "cell")
+	assert.EqualValues(t, 0, code, stderr)
+
+	code, stdout, stderr := ctl("export", "-api", api, "-o", "json", "-sort", "msisdn")
+	assert.EqualValues(t, 0, code, stderr)
+	var subs []model.Subscription
+	assert.Nil(t, json.Unmarshal([]byte(stdout), &subs), stdout)
+	assert.Len(t, subs, 2)
+	if len(subs) == 2 {
+		assert.EqualValues(t, []string{msisdn, "+46107500501"}, []string{subs[0].Msisdn, subs[1].Msisdn})
+		assert.EqualValues(t, "Telness AB", subs[0].Operator)
+	}
+
+	code, stdout, stderr = ctl("export", "-api", api, "-o", "csv", "-sub-type", "cell")
+	assert.EqualValues(t, 0, code, stderr)
+	records, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, subscriptionColumns, records[0])
+
+	code, stdout, stderr = ctl("export", "-api", api, "-o", "json", "-status", "cancelled")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, "[]\n", stdout)
+
+	code, stdout, stderr = ctl("export", "-api", api)
+	assert.EqualValues(t, 0, code, stderr)
+	assert.Len(t, strings.Split(strings.TrimSpace(stdout), "\n"), 3)
+}
+
+func TestRun_StatusNeedsVersion(t *testing.T) {
+	api := setupAPI(t)
+	create(t, api)
+
+	code, _, stderr := ctl("status", "-api", api, msisdn, "paused")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "-expect-version is required")
+
+	code, _, stderr = ctl("status", "-api", api, "-expect-version", "2", msisdn, "cancelled")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "version")
+
+	code, _, stderr = ctl("status", "-api", api, "-expect-version", "1", msisdn, "cancelled")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, model.StatusCancelled, find(t, api).Status)
+}
+
+func TestRun_DryRun(t *testing.T) {
+	api := setupAPI(t)
+
+	code, stdout, stderr := ctl("create", "-api", api, "-dry-run", "-o", "json", "-msisdn", msisdn, "-activate-at", tomorrow, "-sub-type", "pbx")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.Contains(t, stdout, `"sub_type": "pbx"`)
+	code, _, stderr = ctl("find", "-api", api, msisdn)
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "not found")
+
+	create(t, api)
+	code, _, stderr = ctl("create", "-api", api, "-dry-run", "-msisdn", msisdn, "-activate-at", tomorrow, "-sub-type", "pbx")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "already exists")
+
+	code, stdout, stderr = ctl("status", "-api", api, "-dry-run", "-o", "json", msisdn, "cancelled")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.Contains(t, stdout, `"status": "cancelled"`)
+	code, _, stderr = ctl("reschedule", "-api", api, "-dry-run", msisdn, "2021-10-11")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "future date")
+	sub := find(t, api)
+	assert.EqualValues(t, model.StatusPending, sub.Status)
+	assert.True(t, strings.HasPrefix(sub.ActivateAt, tomorrow))
+	assert.EqualValues(t, 1, sub.Version)
+
+	code, _, stderr = ctl("status", "-api", api, "-expect-version", "1", msisdn, "cancelled")
+	assert.EqualValues(t, 0, code, stderr)
+	code, _, stderr = ctl("status", "-api", api, "-dry-run", msisdn, "activated")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "cancelled is a terminal status")
+	assert.EqualValues(t, model.StatusCancelled, find(t, api).Status)
+}
+
+// setenv sets an env variable until the test finishes, tests using it must not be parallel
+func setenv(t *testing.T, name, value string) {
+	previous, set := os.LookupEnv(name)
+	os.Setenv(name, value)
+	t.Cleanup(func() {
+		if set {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func TestRun_DB(t *testing.T) {
+	pts := httptest.NewServer(ptsfake.Default())
+	t.Cleanup(pts.Close)
+	setenv(t, "STORAGE", "sqlite")
+	setenv(t, "SQLITE_PATH", filepath.Join(t.TempDir(), "telness.db"))
+	setenv(t, "PTS_HOST", pts.URL+ptsfake.Path)
+
+	code, _, stderr := ctl("create", "-db", "-msisdn", msisdn, "-activate-at", tomorrow, "-sub-type", "cell")
+	assert.EqualValues(t, 0, code, stderr)
+
+	for _, args := range [][]string{{"find", "-db", "-o", "json", msisdn}, {"export", "-db", "-o", "json"}} {
+		code, stdout, stderr := ctl(args...)
+		assert.EqualValues(t, 0, code, stderr)
+		var subs []model.Subscription
+		assert.Nil(t, json.Unmarshal([]byte(stdout), &subs), stdout)
+		assert.Len(t, subs, 1)
+		if len(subs) == 1 {
+			assert.EqualValues(t, []string{msisdn, "cell", "Telness AB"}, []string{subs[0].Msisdn, subs[0].SubType, subs[0].Operator})
+		}
+	}
+}
+
+func TestRun_Completion(t *testing.T) {
+	code, stdout, stderr := ctl("completion", "bash")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.Contains(t, stdout, "complete -F _telness_ctl telness-ctl")
+	assert.Contains(t, stdout, `status) words="`)
+	assert.Contains(t, stdout, "-expect-version")
+
+	code, stdout, _ = ctl("completion", "zsh")
+	assert.EqualValues(t, 0, code)
+	assert.True(t, strings.HasPrefix(stdout, "autoload -U +X bashcompinit && bashcompinit\n"))
+
+	code, _, stderr = ctl("completion", "fish")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, `shell "fish" is not bash or zsh`)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+var subscriptionColumns = []string{"msisdn", "activate_at", "sub_type", "status", "operator", "version", "modified_at"}
+
+func (env *environment) printSubscriptions(subs ...model.Subscription) error {
+	rows := make([][]string, 0, len(subs))
+	for _, sub := range subs {
+		rows = append(rows, subscriptionRow(sub))
+	}
+	if subs == nil {
+		subs = []model.Subscription{}
+	}
+	return env.print(subs, subscriptionColumns, rows)
+}
+
+func subscriptionRow(sub model.Subscription) []string {
+	return []string{
+		sub.Msisdn,
+		sub.ActivateAt,
+		sub.SubType,
+		string(sub.Status),
+		sub.Operator,
+		strconv.FormatInt(sub.Version, 10),
+		sub.ModifiedAt,
+	}
+}
+
+func (env *environment) printImportResults(results []model.ImportRow) error {
+	rows := make([][]string, 0, len(results))
+	for _, result := range results {
+		detail := result.Detail
+		for _, field := range result.Errors {
+			detail += fmt.Sprintf("; %v: %v", field.Pointer, field.Detail)
+		}
+		rows = append(rows, []string{strconv.Itoa(result.Row), result.Msisdn, result.Status, detail})
+	}
+	if results == nil {
+		results = []model.ImportRow{}
+	}
+	return env.print(results, []string{"row", "msisdn", "result", "error"}, rows)
+}
+
+// print writes value as json, or its rows as csv or an aligned table
+func (env *environment) print(value interface{}, columns []string, rows [][]string) error {
+	if env.opts.output == "json" {
+		encoder := json.NewEncoder(env.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	p := env.newRowPrinter(columns)
+	for _, row := range rows {
+		if err := p.print(nil, row); err != nil {
+			return err
+		}
+	}
+	return p.close()
+}
+
+// tableBlockRows is how many rows of a streamed table are aligned together
+const tableBlockRows = 500
+
+// rowPrinter prints one value at a time, so a long list does not have to be held in memory. It
+// writes the same json array, csv or table as print, except that a table is aligned in blocks of
+// tableBlockRows rows.
+type rowPrinter struct {
+	output  string
+	out     io.Writer
+	columns []string
+	rows    int
+	csv     *csv.Writer
+	table   *tabwriter.Writer
+}
+
+func (env *environment) newRowPrinter(columns []string) *rowPrinter {
+	return &rowPrinter{
+		output:  env.opts.output,
+		out:     env.out,
+		columns: columns,
+		csv:     csv.NewWriter(env.out),
+		table:   tabwriter.NewWriter(env.out, 0, 0, 2, ' ', 0),
+	}
+}
+
+// print writes value as json, or row as csv or table
+func (p *rowPrinter) print(value interface{}, row []string) error {
+	if p.rows == 0 {
+		if err := p.header(); err != nil {
+			return err
+		}
+	}
+	p.rows++
+	switch p.output {
+	case "json":
+		encoded, err := json.MarshalIndent(value, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		separator := ",\n  "
+		if p.rows == 1 {
+			separator = "\n  "
+		}
+		_, err = fmt.Fprintf(p.out, "%v%s", separator, encoded)
+		return err
+	case "csv":
+		return p.csv.Write(row)
+	}
+	fmt.Fprintln(p.table, strings.Join(row, "\t"))
+	if p.rows%tableBlockRows == 0 {
+		return p.table.Flush()
+	}
+	return nil
+}
+
+func (p *rowPrinter) header() error {
+	switch p.output {
+	case "json":
+		_, err := io.WriteString(p.out, "[")
+		return err
+	case "csv":
+		return p.csv.Write(p.columns)
+	}
+	_, err := fmt.Fprintln(p.table, strings.ToUpper(strings.Join(p.columns, "\t")))
+	return err
+}
+
+// close ends the output, it is complete after close
+func (p *rowPrinter) close() error {
+	if p.rows == 0 {
+		if err := p.header(); err != nil {
+			return err
+		}
+	}
+	switch p.output {
+	case "json":
+		end := "\n]\n"
+		if p.rows == 0 {
+			end = "]\n"
+		}
+		_, err := io.WriteString(p.out, end)
+		return err
+	case "csv":
+		p.csv.Flush()
+		return p.csv.Error()
+	}
+	return p.table.Flush()
+}
@@ -6,6 +6,7 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/joho/godotenv v1.3.0
 	github.com/lib/pq v1.10.3
+	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.2.2
 )
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// etag returns the entity tag of a subscription version. It only changes when the subscription
+// is updated, not when PTS answers with another operator.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion returns the subscription version an update request is based on, as sent in the
+// If-Match header. Zero is returned for "*", which matches any version.
+func ifMatchVersion(req *http.Request) (int64, error) {
+	value := strings.TrimSpace(req.Header.Get("If-Match"))
+	if value == "" {
+		return 0, apperr.PreconditionRequired("If-Match header with the ETag of the subscription is required")
+	}
+	if value == "*" {
+		return 0, nil
+	}
+	// weak tags never match If-Match, and tags not created by etag cannot match any version
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || etag(version) != value || version < 1 {
+		return 0, apperr.PreconditionFailed("If-Match %v does not match any version of the subscription", value)
+	}
+	return version, nil
+}
+
+// notModified reports whether one of the tags in the If-None-Match header matches tag
+func notModified(req *http.Request, tag string) bool {
+	value := req.Header.Get("If-None-Match")
+	if value == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(value, ",") {
+		// If-None-Match uses the weak comparison
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// respondSubscription responds with the subscription and its version as ETag
+func respondSubscription(rw http.ResponseWriter, statusCode int, sub model.Subscription) {
+	rw.Header().Set("ETag", etag(sub.Version))
+	respondSuccessJSON(rw, statusCode, sub)
+}
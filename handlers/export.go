@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// exportColumn is a column of an export, value returns a string or an int64
+type exportColumn struct {
+	name  string
+	value func(sub model.Subscription) interface{}
+}
+
+var exportColumns = []exportColumn{
+	{"msisdn", func(sub model.Subscription) interface{} { return sub.Msisdn }},
+	{"activate_at", func(sub model.Subscription) interface{} { return sub.ActivateAt }},
+	{"sub_type", func(sub model.Subscription) interface{} { return sub.SubType }},
+	{"status", func(sub model.Subscription) interface{} { return string(sub.Status) }},
+	{"created_at", func(sub model.Subscription) interface{} { return sub.CreatedAt }},
+	{"modified_at", func(sub model.Subscription) interface{} { return sub.ModifiedAt }},
+	{"version", func(sub model.Subscription) interface{} { return sub.Version }},
+}
+
+// operatorColumns are added to an export with include_operator=true
+var operatorColumns = []exportColumn{
+	{"operator", func(sub model.Subscription) interface{} { return sub.Operator }},
+	{"operator_status", func(sub model.Subscription) interface{} { return sub.OperatorStatus }},
+	{"operator_checked_at", func(sub model.Subscription) interface{} { return sub.OperatorCheckedAt }},
+}
+
+// exportWriter writes the rows of an export in one format
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+type exportFormat struct {
+	mediaType string
+	extension string
+	newWriter func(w io.Writer, columns []string) (exportWriter, error)
+}
+
+// exportFormats are the formats an export can be downloaded in, the first one is the default
+var exportFormats = []exportFormat{
+	{csvContentType, "csv", newCSVExport},
+	{ndjsonContentType, "ndjson", newNDJSONExport},
+	{xlsxContentType, "xlsx", newXLSXExport},
+}
+
+// ExportHandler is an httphandler to handle request to download every subscription matching the filter,
+// as csv, ndjson or xlsx picked by the Accept header. Rows are written while they are read from the
+// database, so an export of all subscriptions does not have to fit in memory.
+func (s Server) ExportHandler(rw http.ResponseWriter, req *http.Request) {
+	format, ok := negotiateExport(req.Header.Get("Accept"))
+	if !ok {
+		mediaTypes := make([]string, len(exportFormats))
+		for i, f := range exportFormats {
+			mediaTypes[i] = f.mediaType
+		}
+		returnError(rw, fmt.Sprintf("Accept must be one of %v", strings.Join(mediaTypes, ", ")), http.StatusNotAcceptable)
+		return
+	}
+	filter, err := parseCriteria(req)
+	if err != nil {
+		s.returnServiceError(rw, "Export request is not valid", err)
+		return
+	}
+	withOperator := req.URL.Query().Get("include_operator") == "true"
+	columns := exportColumns
+	if withOperator {
+		columns = append(columns[:len(columns):len(columns)], operatorColumns...)
+	}
+
+	// the response is only started with the first row, so an export failing right away still gets an error response
+	var (
+		out     exportWriter
+		started bool
+	)
+	start := func() error {
+		started = true
+		rw.Header().Set("Content-Type", format.mediaType)
+		rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="subscriptions-%v.%v"`, time.Now().Format("2006-01-02"), format.extension))
+		rw.WriteHeader(http.StatusOK)
+		names := make([]string, len(columns))
+		for i, column := range columns {
+			names[i] = column.name
+		}
+		var err error
+		out, err = format.newWriter(rw, names)
+		return err
+	}
+	err = s.SubscriptionService.Export(req.Context(), filter, withOperator, func(sub model.Subscription) error {
+		if out == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			values[i] = column.value(sub)
+		}
+		return out.WriteRow(values)
+	})
+	if err == nil && out == nil {
+		err = start()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil && !started {
+		s.returnServiceError(rw, "Could not export subscriptions", err)
+		return
+	}
+	if err != nil {
+		// the status is sent already, abort the response so the client does not take a cut off file for a complete one
+		s.Log.Errorf("Could not export subscriptions, the response is aborted: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// negotiateExport picks the export format with the highest quality in the Accept header, csv when
+// any format is accepted
+func negotiateExport(accept string) (exportFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return exportFormats[0], true
+	}
+	var (
+		best    exportFormat
+		bestQ   float64
+		matched bool
+	)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 || (matched && q <= bestQ) {
+			continue
+		}
+		for _, format := range exportFormats {
+			if mediaType == format.mediaType || mediaType == "*/*" || mediaType == strings.Split(format.mediaType, "/")[0]+"/*" {
+				best, bestQ, matched = format, q, true
+				break
+			}
+		}
+	}
+	return best, matched
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func newCSVExport(w io.Writer, columns []string) (exportWriter, error) {
+	e := csvExport{w: csv.NewWriter(w)}
+	return e, e.w.Write(columns)
+}
+
+func (e csvExport) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = fmt.Sprint(value)
+	}
+	return e.w.Write(record)
+}
+
+func (e csvExport) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonExport writes every row as a json object with the columns as keys, in column order
+type ndjsonExport struct {
+	w       io.Writer
+	columns []string
+}
+
+func newNDJSONExport(w io.Writer, columns []string) (exportWriter, error) {
+	return ndjsonExport{w: w, columns: columns}, nil
+}
+
+func (e ndjsonExport) WriteRow(values []interface{}) error {
+	var line strings.Builder
+	line.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		name, _ := json.Marshal(e.columns[i])
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		line.Write(name)
+		line.WriteByte(':')
+		line.Write(encoded)
+	}
+	line.WriteString("}\n")
+	_, err := io.WriteString(e.w, line.String())
+	return err
+}
+
+func (e ndjsonExport) Close() error {
+	return nil
+}
+
+// newXLSXExport starts a workbook with a header row of the column names
+func newXLSXExport(w io.Writer, columns []string) (exportWriter, error) {
+	x, err := newXLSXWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+	return x, x.WriteRow(header)
+}
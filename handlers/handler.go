@@ -1,18 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	//"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pmadhvi/telness-manager/apperr"
 	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
 )
 
 // CreateHandler is an httphandler to handle request to create an subscription
@@ -34,25 +39,33 @@ func (s Server) CreateHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 	err = validateRequest(subreq)
 	if err != nil {
-		msg := fmt.Sprintf("Create request body is not valid: %v", err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		s.returnServiceError(rw, "Create request body is not valid", err)
 		return
 	}
 
+	subreq.Actor, subreq.Reason = changedBy(req)
+	subreq.ValidateOnly = validateOnly(req)
 	var sub model.Subscription
-	sub, err = s.SubscriptionService.Create(subreq)
+	sub, err = s.SubscriptionService.Create(req.Context(), subreq)
 	if err != nil {
-		msg := fmt.Sprintf("Could not create a new subscription, %v", err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		s.returnServiceError(rw, "Could not create a new subscription", err)
+		return
+	}
+	if subreq.ValidateOnly {
+		respondSubscription(rw, http.StatusOK, sub)
 		return
 	}
-	respondSuccessJSON(rw, http.StatusCreated, sub)
+	rw.Header().Set("Location", subscriptionLocation(sub.Msisdn))
+	respondSubscription(rw, http.StatusCreated, sub)
 }
 
 // UpdateHandler is an httphandler to handle request to create an subscription
 func (s Server) UpdateHandler(rw http.ResponseWriter, req *http.Request) {
+	version, err := ifMatchVersion(req)
+	if err != nil {
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
 	reqBody, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		msg := fmt.Sprintf("Could not read request body: %v", err)
@@ -60,6 +73,10 @@ func (s Server) UpdateHandler(rw http.ResponseWriter, req *http.Request) {
 		returnError(rw, msg, 400)
 		return
 	}
+	if contentType := patchContentType(req); contentType != "" {
+		s.patchSubscription(rw, req, contentType, reqBody, version)
+		return
+	}
 	var subreq model.CreateSubscription
 	err = json.Unmarshal(reqBody, &subreq)
 	if err != nil {
@@ -70,21 +87,45 @@ func (s Server) UpdateHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 	err = validateRequest(subreq)
 	if err != nil {
-		msg := fmt.Sprintf("Update request body is not valid: %v", err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		s.returnServiceError(rw, "Update request body is not valid", err)
 		return
 	}
 
+	subreq.Actor, subreq.Reason = changedBy(req)
+	subreq.ExpectedVersion = version
+	subreq.ValidateOnly = validateOnly(req)
 	var sub model.Subscription
-	sub, err = s.SubscriptionService.Update(subreq)
+	sub, err = s.SubscriptionService.Update(req.Context(), subreq)
+	if err != nil {
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
+	respondSubscription(rw, http.StatusOK, sub)
+}
+
+// PatchHandler is an httphandler to handle request to change some fields of an subscription with a
+// JSON Merge Patch or JSON Patch
+func (s Server) PatchHandler(rw http.ResponseWriter, req *http.Request) {
+	version, err := ifMatchVersion(req)
 	if err != nil {
-		msg := fmt.Sprintf("Could not update subscription: %v", err)
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
+	contentType := patchContentType(req)
+	if contentType == "" {
+		msg := fmt.Sprintf("Content-Type must be %v or %v", mergePatchContentType, jsonPatchContentType)
+		s.Log.Error(msg)
+		returnError(rw, msg, http.StatusUnsupportedMediaType)
+		return
+	}
+	reqBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body: %v", err)
 		s.Log.Error(msg)
 		returnError(rw, msg, 400)
 		return
 	}
-	respondSuccessJSON(rw, http.StatusOK, sub)
+	s.patchSubscription(rw, req, contentType, reqBody, version)
 }
 
 // FindHandler is an httphandler to handle request to find an subscription
@@ -98,14 +139,17 @@ func (s Server) FindHandler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 	var sub model.Subscription
-	sub, err := s.SubscriptionService.FindbyID(msisdn)
+	sub, err := s.SubscriptionService.FindbyID(req.Context(), msisdn)
 	if err != nil {
-		msg := fmt.Sprintf("Could not find subscription with msisdn %v, %v", msisdn, err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 404)
+		s.returnServiceError(rw, fmt.Sprintf("Could not find subscription with msisdn %v", msisdn), err)
+		return
+	}
+	if notModified(req, etag(sub.Version)) {
+		rw.Header().Set("ETag", etag(sub.Version))
+		rw.WriteHeader(http.StatusNotModified)
 		return
 	}
-	respondSuccessJSON(rw, http.StatusOK, sub)
+	respondSubscription(rw, http.StatusOK, sub)
 }
 
 // UpdateStatusHandler is an httphandler to handle request to find an subscription and updates it status
@@ -124,35 +168,42 @@ func (s Server) UpdateStatusHandler(rw http.ResponseWriter, req *http.Request) {
 		s.Log.Error(msg)
 		returnError(rw, msg, 400)
 		return
-	} else if !IsValidStatus(model.SubStatus(status)) {
-		msg := fmt.Sprintf("Invalid status type %v", status)
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
-		return
 	}
+	s.updateStatus(rw, req, msisdn, model.SubStatus(status))
+}
 
-	var sub model.Subscription
-	foundSub, err := s.SubscriptionService.FindbyID(msisdn)
+// updateStatus moves the subscription to a new status, keeping its other fields
+func (s Server) updateStatus(rw http.ResponseWriter, req *http.Request, msisdn string, status model.SubStatus) {
+	if !IsValidStatus(status) {
+		s.returnServiceError(rw, "Status is not valid", apperr.Validation("invalid status type %v", status))
+		return
+	}
+	version, err := ifMatchVersion(req)
 	if err != nil {
-		msg := fmt.Sprintf("Could not find subscription with msisdn %v, %v", msisdn, err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 404)
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
+	foundSub, err := s.SubscriptionService.FindbyID(req.Context(), msisdn)
+	if err != nil {
+		markUnchanged(rw)
+		s.returnServiceError(rw, fmt.Sprintf("Could not find subscription with msisdn %v", msisdn), err)
 		return
 	}
 	updateSub := model.CreateSubscription{
 		Msisdn:     foundSub.Msisdn,
 		ActivateAt: foundSub.ActivateAt,
 		SubType:    foundSub.SubType,
-		Status:     model.SubStatus(status),
+		Status:     status,
 	}
-	sub, err = s.SubscriptionService.Update(updateSub)
+	updateSub.Actor, updateSub.Reason = changedBy(req)
+	updateSub.ExpectedVersion = version
+	updateSub.ValidateOnly = validateOnly(req)
+	sub, err := s.SubscriptionService.Update(req.Context(), updateSub)
 	if err != nil {
-		msg := fmt.Sprintf("Could not update subscription: %v", err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		s.returnServiceError(rw, "Could not update subscription", err)
 		return
 	}
-	respondSuccessJSON(rw, http.StatusOK, sub)
+	respondSubscription(rw, http.StatusOK, sub)
 }
 
 // UpdateActivationDateHandler is an httphandler to handle request to update activation date of pending an subscription
@@ -174,34 +225,37 @@ func (s Server) UpdateActivationDateHandler(rw http.ResponseWriter, req *http.Re
 		return
 	}
 
+	s.updateActivationDate(rw, req, msisdn, date)
+}
+
+// updateActivationDate changes the activation date of a pending subscription
+func (s Server) updateActivationDate(rw http.ResponseWriter, req *http.Request, msisdn, date string) {
 	// Check if activation date is future date
 	parsedDate, err := time.Parse("2006-01-02", date)
 	if err != nil {
-		msg := fmt.Sprint("could not parse string date into time.Time format")
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		s.returnServiceError(rw, "Activation date is not valid", apperr.Validation("could not parse string date into time.Time format"))
 		return
 	}
 
 	if parsedDate.Before(time.Now()) {
-		msg := fmt.Sprint("enter valid future date for activation")
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		s.returnServiceError(rw, "Activation date is not valid", apperr.Validation("enter valid future date for activation"))
 		return
 	}
 
-	var sub model.Subscription
-	foundSub, err := s.SubscriptionService.FindbyID(msisdn)
+	version, err := ifMatchVersion(req)
 	if err != nil {
-		msg := fmt.Sprintf("Could not find subscription with msisdn %v, %v", msisdn, err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 404)
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
+	foundSub, err := s.SubscriptionService.FindbyID(req.Context(), msisdn)
+	if err != nil {
+		markUnchanged(rw)
+		s.returnServiceError(rw, fmt.Sprintf("Could not find subscription with msisdn %v", msisdn), err)
 		return
 	}
 	if foundSub.Status != model.StatusPending {
-		msg := fmt.Sprintf("Found subscription status %v is not pending to update activation date", foundSub.Status)
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		err := apperr.Validation("found subscription status %v is not pending to update activation date", foundSub.Status)
+		s.returnServiceError(rw, "Activation date cannot be updated", err)
 		return
 	}
 	updateSub := model.CreateSubscription{
@@ -210,14 +264,174 @@ func (s Server) UpdateActivationDateHandler(rw http.ResponseWriter, req *http.Re
 		SubType:    foundSub.SubType,
 		Status:     foundSub.Status,
 	}
-	sub, err = s.SubscriptionService.Update(updateSub)
+	updateSub.Actor, updateSub.Reason = changedBy(req)
+	updateSub.ExpectedVersion = version
+	updateSub.ValidateOnly = validateOnly(req)
+	sub, err := s.SubscriptionService.Update(req.Context(), updateSub)
 	if err != nil {
-		msg := fmt.Sprintf("Could not update subscription: %v", err)
-		s.Log.Error(msg)
-		returnError(rw, msg, 400)
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
+	respondSubscription(rw, http.StatusOK, sub)
+}
+
+// ListHandler is an httphandler to handle request to list subscriptions by filter
+func (s Server) ListHandler(rw http.ResponseWriter, req *http.Request) {
+	filter, err := parseFilter(req)
+	if err != nil {
+		s.returnServiceError(rw, "List request is not valid", err)
+		return
+	}
+	page, err := s.SubscriptionService.List(req.Context(), filter)
+	if err != nil {
+		s.returnServiceError(rw, "Could not list subscriptions", err)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, page)
+}
+
+// HistoryHandler is an httphandler to handle request to find the change history of an subscription
+func (s Server) HistoryHandler(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	msisdn := vars["msisdn"]
+	if msisdn == "" {
+		s.Log.Error("msisdn cannot be empty")
+		returnError(rw, "msisdn cannot be empty", 400)
+		return
+	}
+	limit, err := queryInt(req, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		s.returnServiceError(rw, "History request is not valid", apperr.Validation("limit must be a number between 1 and %d", maxPageLimit))
+		return
+	}
+	offset, err := queryInt(req, "offset", 0)
+	if err != nil || offset < 0 {
+		s.returnServiceError(rw, "History request is not valid", apperr.Validation("offset must be a positive number"))
+		return
+	}
+	page, err := s.SubscriptionService.History(req.Context(), msisdn, limit, offset)
+	if err != nil {
+		s.returnServiceError(rw, fmt.Sprintf("Could not find history of subscription with msisdn %v", msisdn), err)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, page)
+}
+
+// TransitionsHandler is an httphandler to handle request to list the subscription status transitions
+func (s Server) TransitionsHandler(rw http.ResponseWriter, req *http.Request) {
+	table := s.SubscriptionService.Transitions()
+	resp := model.StatusTransitions{
+		Transitions: table,
+		Terminal:    []model.SubStatus{},
+	}
+	for _, status := range []model.SubStatus{model.StatusPending, model.StatusPaused, model.StatusActivated, model.StatusCancelled} {
+		if len(table[status]) == 0 {
+			resp.Terminal = append(resp.Terminal, status)
+		}
+	}
+	respondSuccessJSON(rw, http.StatusOK, resp)
+}
+
+// AllowedTransitionsHandler is an httphandler to handle request to find the statuses an subscription can move to
+func (s Server) AllowedTransitionsHandler(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	msisdn := vars["msisdn"]
+	if msisdn == "" {
+		s.Log.Error("msisdn cannot be empty")
+		returnError(rw, "msisdn cannot be empty", 400)
+		return
+	}
+	allowed, err := s.SubscriptionService.AllowedTransitions(req.Context(), msisdn)
+	if err != nil {
+		s.returnServiceError(rw, fmt.Sprintf("Could not find allowed transitions for msisdn %v", msisdn), err)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, allowed)
+}
+
+// SchedulerStatusHandler is an httphandler to handle request to check what the activation scheduler has done
+func (s Server) SchedulerStatusHandler(rw http.ResponseWriter, req *http.Request) {
+	if s.Scheduler == nil {
+		s.Log.Error("activation scheduler is not running")
+		returnError(rw, "activation scheduler is not running", 404)
 		return
 	}
-	respondSuccessJSON(rw, http.StatusOK, sub)
+	respondSuccessJSON(rw, http.StatusOK, s.Scheduler.Status())
+}
+
+// OperatorRefresherStatusHandler is an httphandler to handle request to check what the operator refresher has done
+func (s Server) OperatorRefresherStatusHandler(rw http.ResponseWriter, req *http.Request) {
+	if s.OperatorRefresher == nil {
+		s.Log.Error("operator refresher is not running")
+		returnError(rw, "operator refresher is not running", 404)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, s.OperatorRefresher.Status())
+}
+
+// PortabilityStatusHandler is an httphandler to handle request to check what the portability reconciler has done
+func (s Server) PortabilityStatusHandler(rw http.ResponseWriter, req *http.Request) {
+	if s.Portability == nil {
+		s.Log.Error("portability reconciler is not running")
+		returnError(rw, "portability reconciler is not running", 404)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, s.Portability.Status())
+}
+
+// PortabilityReportHandler is an httphandler to handle request to list numbers ported out or to another operator
+// in the window given by the from and to query parameters
+func (s Server) PortabilityReportHandler(rw http.ResponseWriter, req *http.Request) {
+	if s.Portability == nil {
+		s.Log.Error("portability reconciler is not running")
+		returnError(rw, "portability reconciler is not running", 404)
+		return
+	}
+	query := req.URL.Query()
+	if query.Get("from") == "" || query.Get("to") == "" {
+		s.returnServiceError(rw, "Portability report request is not valid", apperr.Validation("from and to cannot be empty"))
+		return
+	}
+	from, err := service.ParseDate(query.Get("from"))
+	if err != nil {
+		s.returnServiceError(rw, "Portability report request is not valid", apperr.Validation("could not parse from, use format 2006-01-02 or RFC3339"))
+		return
+	}
+	to, err := service.ParseDate(query.Get("to"))
+	if err != nil {
+		s.returnServiceError(rw, "Portability report request is not valid", apperr.Validation("could not parse to, use format 2006-01-02 or RFC3339"))
+		return
+	}
+	if !from.Before(to) {
+		s.returnServiceError(rw, "Portability report request is not valid", apperr.Validation("from should be before to"))
+		return
+	}
+	report, err := s.Portability.Report(req.Context(), from, to)
+	if err != nil {
+		s.returnServiceError(rw, "Could not create portability report", err)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, report)
+}
+
+// PtsCacheStatsHandler is an httphandler to handle request to check the PTS operator lookup cache counters
+func (s Server) PtsCacheStatsHandler(rw http.ResponseWriter, req *http.Request) {
+	if s.PtsCache == nil {
+		s.Log.Error("pts cache is not enabled")
+		returnError(rw, "pts cache is not enabled", 404)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, s.PtsCache.Stats())
+}
+
+// PtsBreakerStatsHandler is an httphandler to handle request to check the PTS circuit breaker state
+func (s Server) PtsBreakerStatsHandler(rw http.ResponseWriter, req *http.Request) {
+	if s.PtsBreaker == nil {
+		s.Log.Error("pts circuit breaker is not enabled")
+		returnError(rw, "pts circuit breaker is not enabled", 404)
+		return
+	}
+	respondSuccessJSON(rw, http.StatusOK, s.PtsBreaker.Stats())
 }
 
 // CheckHealthHandler is an httphandler to handle request to check application health
@@ -237,45 +451,232 @@ func respondSuccessJSON(rw http.ResponseWriter, statusCode int, response interfa
 	json.NewEncoder(rw).Encode(response)
 }
 
-func respondErrorJSON(rw http.ResponseWriter, errorCode int, errorMsg interface{}) {
-	rw.Header().Set("Content-Type", "application/json")
-	rw.WriteHeader(errorCode)
-	json.NewEncoder(rw).Encode(errorMsg)
+// problemTypeBase prefixes the error code to form the problem type URI
+const problemTypeBase = "urn:telness-manager:problem:"
+
+func respondProblemJSON(rw http.ResponseWriter, problem model.Problem) {
+	rw.Header().Set("Content-Type", "application/problem+json")
+	rw.WriteHeader(problem.Status)
+	json.NewEncoder(rw).Encode(problem)
+}
+
+// newProblem returns the problem details for an error response, Detail is the human readable message
+func newProblem(statusCode int, code, detail string) model.Problem {
+	return model.Problem{
+		Type:   problemTypeBase + code,
+		Title:  http.StatusText(statusCode),
+		Status: statusCode,
+		Detail: detail,
+		Code:   code,
+	}
 }
 
+// returnError responds with an error which is not returned by a service, like a request that cannot be read
 func returnError(rw http.ResponseWriter, message string, statusCode int) {
-	respMsg := model.ErrorMessage{
-		Message: message,
+	code := apperr.CodeBadRequest
+	switch statusCode {
+	case http.StatusNotFound:
+		code = apperr.CodeNotFound
+	case http.StatusUnsupportedMediaType:
+		code = apperr.CodeUnsupportedMediaType
+	case http.StatusNotAcceptable:
+		code = apperr.CodeNotAcceptable
 	}
-	respondErrorJSON(rw, statusCode, respMsg)
+	respondProblemJSON(rw, newProblem(statusCode, code, message))
 }
 
-func validateRequest(sub model.CreateSubscription) error {
-	activate_at, err := time.Parse("2006-01-02", sub.ActivateAt)
+// returnServiceError responds with the status code and error code belonging to the domain error in err,
+// field errors of a failed validation are all listed in the response.
+// The details of unexpected errors are only logged, they are not shown to clients.
+func (s Server) returnServiceError(rw http.ResponseWriter, message string, err error) {
+	s.Log.Errorf("%v: %v", message, err)
+	statusCode, code := errorStatus(err)
+	if statusCode != http.StatusInternalServerError {
+		message = fmt.Sprintf("%v: %v", message, err)
+	}
+	problem := newProblem(statusCode, code, message)
+	for _, field := range apperr.FieldsOf(err) {
+		problem.Errors = append(problem.Errors, model.ProblemField{
+			Pointer: field.Pointer,
+			Detail:  field.Detail,
+		})
+	}
+	respondProblemJSON(rw, problem)
+}
+
+// errorStatus returns the http status code and error code for an error returned by a service
+func errorStatus(err error) (int, string) {
+	switch apperr.KindOf(err) {
+	case apperr.KindNotFound:
+		return http.StatusNotFound, apperr.CodeOf(err)
+	case apperr.KindAlreadyExists, apperr.KindInvalidTransition, apperr.KindConflict:
+		return http.StatusConflict, apperr.CodeOf(err)
+	case apperr.KindPreconditionFailed:
+		return http.StatusPreconditionFailed, apperr.CodeOf(err)
+	case apperr.KindPreconditionMissing:
+		return http.StatusPreconditionRequired, apperr.CodeOf(err)
+	case apperr.KindValidation:
+		return http.StatusUnprocessableEntity, apperr.CodeOf(err)
+	case apperr.KindUpstreamUnavailable:
+		return http.StatusServiceUnavailable, apperr.CodeOf(err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable, apperr.CodeTimeout
+	}
+	return http.StatusInternalServerError, apperr.CodeInternal
+}
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// parseFilter reads the list filter from the request query parameters
+func parseFilter(req *http.Request) (model.SubscriptionFilter, error) {
+	filter, err := parseCriteria(req)
 	if err != nil {
-		return errors.New("could not parse string activate_at into time.Time format")
-	}
-
-	var regexp = regexp.MustCompile(`^\+46[1-9][0-9]{8}$`)
-	if sub.Msisdn == "" {
-		return errors.New("msisdn cannot be nil")
-	} else if !regexp.MatchString(sub.Msisdn) {
-		return errors.New("msisdn must be of format: +46 followed by 9 digits of phone number, example - [+46107500500]")
-	} else if sub.ActivateAt == "" {
-		return errors.New("activate_at cannot be empty")
-	} else if activate_at.Before(time.Now()) {
-		return errors.New("activate_at should be future date")
-	} else if sub.SubType == "" {
-		return errors.New("sub_type cannot be empty")
-	} else if sub.Status == "" {
-		return errors.New("status cannot be empty")
-	} else if !IsValidStatus(sub.Status) {
-		return errors.New("Invalid status type")
+		return model.SubscriptionFilter{}, err
 	}
+	limit, err := queryInt(req, "limit", defaultPageLimit)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return model.SubscriptionFilter{}, apperr.Validation("limit must be a number between 1 and %d", maxPageLimit)
+	}
+	filter.Limit = limit
+	if cursor := req.URL.Query().Get("cursor"); cursor != "" {
+		after, err := model.DecodeCursor(cursor)
+		if err != nil {
+			return model.SubscriptionFilter{}, apperr.Validation("%v", err)
+		}
+		filter.After = &after
+	}
+	return filter, nil
+}
 
+// parseCriteria reads the criteria to select subscriptions by from the query, without the paging of parseFilter
+func parseCriteria(req *http.Request) (model.SubscriptionFilter, error) {
+	query := req.URL.Query()
+	filter := model.SubscriptionFilter{
+		SubType:      queryList(req, "sub_type"),
+		MsisdnPrefix: query.Get("msisdn_prefix"),
+		Sort:         query.Get("sort"),
+		Order:        query.Get("order"),
+	}
+	for _, status := range queryList(req, "status") {
+		if !IsValidStatus(model.SubStatus(status)) {
+			return model.SubscriptionFilter{}, apperr.Validation("invalid status type %v", status)
+		}
+		filter.Status = append(filter.Status, model.SubStatus(status))
+	}
+	dates := []struct {
+		name  string
+		value *time.Time
+	}{
+		{"activate_from", &filter.ActivateFrom},
+		{"activate_to", &filter.ActivateTo},
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	}
+	for _, date := range dates {
+		if query.Get(date.name) == "" {
+			continue
+		}
+		parsed, err := service.ParseDate(query.Get(date.name))
+		if err != nil {
+			return model.SubscriptionFilter{}, apperr.Validation("could not parse %v, use format 2006-01-02 or RFC3339", date.name)
+		}
+		*date.value = parsed
+	}
+	return filter, nil
+}
+
+// queryList returns all values of a query parameter, given either repeated or comma separated
+func queryList(req *http.Request, name string) []string {
+	var values []string
+	for _, value := range req.URL.Query()[name] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// changedBy returns who makes the change and why, as sent in the X-Actor and X-Change-Reason headers
+func changedBy(req *http.Request) (string, string) {
+	actor := req.Header.Get("X-Actor")
+	if actor == "" {
+		actor = "api"
+	}
+	return actor, req.Header.Get("X-Change-Reason")
+}
+
+// validateOnly reports whether the request asks to check the change without making it
+func validateOnly(req *http.Request) bool {
+	return req.URL.Query().Get("validate_only") == "true"
+}
+
+// queryInt returns the query parameter as int, or the default value when it is not set
+func queryInt(req *http.Request, name string, defaultValue int) (int, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// validateRequest checks every field of the request and returns all failures at once
+func validateRequest(sub model.CreateSubscription) error {
+	return validateFields(sub, "msisdn", "activate_at", "sub_type", "status")
+}
+
+// validateFields checks the given fields of the request and returns all failures at once
+func validateFields(sub model.CreateSubscription, fields ...string) error {
+	var invalid []apperr.FieldError
+	for _, field := range fields {
+		if detail := validateField(sub, field); detail != "" {
+			invalid = append(invalid, apperr.FieldError{Pointer: "/" + field, Detail: detail})
+		}
+	}
+	if len(invalid) > 0 {
+		return apperr.InvalidFields(invalid)
+	}
 	return nil
 }
 
+// validateField returns what is wrong with one field of the request, or an empty string
+func validateField(sub model.CreateSubscription, field string) string {
+	switch field {
+	case "msisdn":
+		if sub.Msisdn == "" {
+			return "msisdn cannot be nil"
+		} else if !msisdnFormat.MatchString(sub.Msisdn) {
+			return "msisdn must be of format: +46 followed by 9 digits of phone number, example - [+46107500500]"
+		}
+	case "activate_at":
+		if sub.ActivateAt == "" {
+			return "activate_at cannot be empty"
+		} else if activateAt, err := time.Parse("2006-01-02", sub.ActivateAt); err != nil {
+			return "could not parse string activate_at into time.Time format"
+		} else if activateAt.Before(time.Now()) {
+			return "activate_at should be future date"
+		}
+	case "sub_type":
+		if sub.SubType == "" {
+			return "sub_type cannot be empty"
+		}
+	case "status":
+		if sub.Status == "" {
+			return "status cannot be empty"
+		} else if !IsValidStatus(sub.Status) {
+			return "Invalid status type"
+		}
+	}
+	return ""
+}
+
+var msisdnFormat = regexp.MustCompile(`^\+46[1-9][0-9]{8}$`)
+
 func IsValidStatus(status model.SubStatus) bool {
 	switch status {
 	case model.StatusPending, model.StatusPaused, model.StatusActivated, model.StatusCancelled:
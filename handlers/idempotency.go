@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+)
+
+// replayedHeaders are the response headers stored with the response and replayed, so a retry gets
+// the same ETag and Location as the first request
+var replayedHeaders = []string{"ETag", "Location", "Deprecation", "Sunset", "Link"}
+
+// idempotent makes a handler safe to retry with the same Idempotency-Key header. The first request
+// with a key runs and its response is stored, a retry with the same method, url and body gets the
+// stored response without running the handler again. Requests without the header are not affected.
+// A server error may come after the change was written, so it is stored like any other response,
+// unless the handler reported with markUnchanged that nothing was written.
+func (s Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(idempotencyKeyHeader)
+		if key == "" || s.Idempotency == nil {
+			next(rw, req)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			s.returnServiceError(rw, "Idempotency key is not valid", apperr.Validation("%v cannot be longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+		reqBody, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			returnError(rw, "Could not read request body", 400)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		hash := requestHash(req, reqBody)
+
+		ttl := s.IdempotencyTTL
+		if ttl <= 0 {
+			ttl = defaultIdempotencyKeyTTL
+		}
+		now := time.Now()
+		stored, reserved, err := s.Idempotency.ReserveIdempotencyKey(req.Context(), key, hash, now, now.Add(ttl))
+		if err != nil {
+			s.returnServiceError(rw, "Could not check idempotency key", err)
+			return
+		}
+		if !reserved {
+			s.replay(rw, key, hash, stored)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: rw, statusCode: http.StatusOK}
+		next(recorder, req)
+
+		// the request context may have timed out by now, the outcome must be stored anyway
+		ctx := context.Background()
+		unchanged := recorder.unchanged || validateOnly(req)
+		if recorder.statusCode >= 500 && unchanged {
+			// nothing was done for sure, so a retry should run the request again
+			s.releaseIdempotencyKey(ctx, key)
+			return
+		}
+		err = s.Idempotency.CompleteIdempotencyKey(ctx, key, model.IdempotentResponse{
+			RequestHash: hash,
+			StatusCode:  recorder.statusCode,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Headers:     storedHeaders(recorder.Header()),
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			s.Log.Errorf("could not store response for idempotency key %v: %v", key, err)
+			// a change may have been written, the key stays in use until it expires so it is not run twice
+			if unchanged {
+				s.releaseIdempotencyKey(ctx, key)
+			}
+		}
+	}
+}
+
+func (s Server) releaseIdempotencyKey(ctx context.Context, key string) {
+	if err := s.Idempotency.ReleaseIdempotencyKey(ctx, key); err != nil {
+		s.Log.Errorf("could not release idempotency key %v: %v", key, err)
+	}
+}
+
+// markUnchanged reports that the handler failed before writing anything, so the idempotency key of
+// the request is released instead of storing its error
+func markUnchanged(rw http.ResponseWriter) {
+	if recorder, ok := rw.(*responseRecorder); ok {
+		recorder.unchanged = true
+	}
+}
+
+// replay responds to a retried request with the response stored for its idempotency key
+func (s Server) replay(rw http.ResponseWriter, key, hash string, stored model.IdempotentResponse) {
+	if stored.RequestHash != hash {
+		s.returnServiceError(rw, "Idempotency key cannot be reused", apperr.Conflict(apperr.CodeIdempotencyKeyReused, "key %v was used for a different request", key))
+		return
+	}
+	if stored.StatusCode == 0 {
+		s.returnServiceError(rw, "Idempotency key is in use", apperr.Conflict(apperr.CodeIdempotencyKeyInUse, "the first request with key %v has not finished yet", key))
+		return
+	}
+	s.Log.Infof("replaying stored response for idempotency key %v", key)
+	if stored.ContentType != "" {
+		rw.Header().Set("Content-Type", stored.ContentType)
+	}
+	for name, value := range stored.Headers {
+		rw.Header().Set(name, value)
+	}
+	rw.Header().Set(idempotentReplayedHeader, "true")
+	rw.WriteHeader(stored.StatusCode)
+	rw.Write(stored.Body)
+}
+
+// storedHeaders returns the replayed headers the response has
+func storedHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// requestHash identifies a request by method, path, query and body, a key may only be retried with
+// the same request. The query is encoded in sorted order, so its parameters may come in any order.
+func requestHash(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + req.URL.Path + "?" + req.URL.Query().Encode() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder passes a response on to the client and keeps a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	// unchanged is set by markUnchanged
+	unchanged bool
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+const (
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+	maxImportRows     = 10000
+)
+
+// importColumns are the columns a csv import needs in its header row, in any order
+var importColumns = []string{"msisdn", "activate_at", "sub_type", "status"}
+
+// importRow is one data row of an import, err is set when the row could not be read
+type importRow struct {
+	sub model.CreateSubscription
+	err string
+}
+
+// ImportHandler is an httphandler to handle request to create many subscriptions from a csv or ndjson body.
+// Every row is validated like a create request and the result of every row is returned. With
+// validate_only=true nothing is created, with atomic=true nothing is created unless every row can be.
+func (s Server) ImportHandler(rw http.ResponseWriter, req *http.Request) {
+	validateOnly := validateOnly(req)
+	atomic := req.URL.Query().Get("atomic") == "true"
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var (
+		rows []importRow
+		err  error
+	)
+	switch mediaType {
+	case csvContentType:
+		rows, err = readCSVImport(req.Body)
+	case ndjsonContentType, "application/jsonl":
+		rows, err = readNDJSONImport(req.Body)
+	default:
+		returnError(rw, fmt.Sprintf("Content-Type must be %v or %v", csvContentType, ndjsonContentType), 415)
+		return
+	}
+	if err != nil {
+		s.returnServiceError(rw, "Import request is not valid", err)
+		return
+	}
+
+	actor, reason := changedBy(req)
+	result := model.ImportResult{ValidateOnly: validateOnly, Atomic: atomic, Total: len(rows), Rows: make([]model.ImportRow, len(rows))}
+	var (
+		valid   []model.CreateSubscription
+		validAt []int
+		seen    = map[string]int{}
+	)
+	for i, row := range rows {
+		result.Rows[i] = model.ImportRow{Row: i + 1, Msisdn: row.sub.Msisdn, Status: model.ImportRowValid}
+		var rowErr error
+		if row.err != "" {
+			rowErr = apperr.Validation("%v", row.err)
+		} else if err := validateRequest(row.sub); err != nil {
+			rowErr = err
+		} else if first, ok := seen[row.sub.Msisdn]; ok {
+			rowErr = apperr.InvalidFields([]apperr.FieldError{{Pointer: "/msisdn", Detail: fmt.Sprintf("msisdn is on row %d already", first)}})
+		}
+		if rowErr != nil {
+			setRowError(&result.Rows[i], model.ImportRowInvalid, rowErr)
+			continue
+		}
+		seen[row.sub.Msisdn] = i + 1
+		row.sub.Actor, row.sub.Reason = actor, reason
+		valid = append(valid, row.sub)
+		validAt = append(validAt, i)
+	}
+
+	invalid := len(rows) - len(valid)
+	switch {
+	case validateOnly:
+	case atomic && invalid > 0:
+		for _, i := range validAt {
+			setRowError(&result.Rows[i], model.ImportRowSkipped, apperr.Conflict(apperr.CodeImportRowSkipped, "not created, %d rows are invalid and the import is all or nothing", invalid))
+		}
+	case len(valid) > 0:
+		rowErrs := s.SubscriptionService.Import(req.Context(), valid, atomic)
+		for j, i := range validAt {
+			if rowErrs[j] == nil {
+				result.Rows[i].Status = model.ImportRowCreated
+				result.Created++
+			} else if apperr.CodeOf(rowErrs[j]) == apperr.CodeImportRowSkipped {
+				setRowError(&result.Rows[i], model.ImportRowSkipped, rowErrs[j])
+			} else {
+				setRowError(&result.Rows[i], model.ImportRowFailed, rowErrs[j])
+			}
+		}
+	}
+	for _, row := range result.Rows {
+		if row.Status != model.ImportRowCreated && row.Status != model.ImportRowValid {
+			result.Failed++
+		}
+	}
+	s.Log.Infof("imported subscriptions: %d rows, %d created, %d failed", result.Total, result.Created, result.Failed)
+	respondSuccessJSON(rw, http.StatusOK, result)
+}
+
+// setRowError reports the error of a row the same way as an error response would
+func setRowError(row *model.ImportRow, status string, err error) {
+	row.Status = status
+	row.Code = apperr.CodeOf(err)
+	row.Detail = err.Error()
+	if apperr.KindOf(err) == apperr.KindInternal {
+		row.Detail = "internal error"
+	}
+	for _, field := range apperr.FieldsOf(err) {
+		row.Errors = append(row.Errors, model.ProblemField{Pointer: field.Pointer, Detail: field.Detail})
+	}
+}
+
+// readCSVImport reads the rows of a csv import, the first row names the columns
+func readCSVImport(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, apperr.Validation("csv is empty, it needs a header row with columns %v", strings.Join(importColumns, ", "))
+	} else if err != nil {
+		return nil, apperr.Validation("could not read csv header: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		// spreadsheets often save csv with a byte order mark
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	var missing []string
+	for _, name := range importColumns {
+		if _, ok := columns[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, apperr.Validation("csv header is missing columns %v", strings.Join(missing, ", "))
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if len(rows) == maxImportRows {
+			return nil, apperr.Validation("an import can have at most %d rows", maxImportRows)
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, importRow{err: fmt.Sprintf("could not read csv row: %v", parseErr.Err)})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		rows = append(rows, importRow{sub: model.CreateSubscription{
+			Msisdn:     value("msisdn"),
+			ActivateAt: value("activate_at"),
+			SubType:    value("sub_type"),
+			Status:     model.SubStatus(value("status")),
+		}})
+	}
+}
+
+// readNDJSONImport reads the rows of an ndjson import, one create request per line. Empty lines are skipped.
+func readNDJSONImport(body io.Reader) ([]importRow, error) {
+	var rows []importRow
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, apperr.Validation("an import can have at most %d rows", maxImportRows)
+		}
+		var row importRow
+		if err := json.Unmarshal([]byte(line), &row.sub); err != nil {
+			row.err = fmt.Sprintf("could not parse row as json: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, apperr.Validation("could not read ndjson: %v", err)
+	}
+	return rows, nil
+}
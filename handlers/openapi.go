@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// openAPIDocument is the OpenAPI 3 description of every route registered in Router
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+var openAPI = mustParseSpec(openAPIDocument)
+
+// swaggerUIPage shows the OpenAPI document with Swagger UI, loaded from a cdn
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>telness-manager api</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// OpenAPIHandler is an httphandler to handle request to get the OpenAPI document of the api
+func (s Server) OpenAPIHandler(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(openAPIDocument)
+}
+
+// DocsHandler is an httphandler to handle request to browse the OpenAPI document with Swagger UI
+func (s Server) DocsHandler(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write([]byte(swaggerUIPage))
+}
+
+// openAPISpec is the part of the OpenAPI document needed to validate requests
+type openAPISpec struct {
+	Paths      map[string]map[string]*specOperation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*specSchema    `json:"schemas"`
+		Parameters map[string]*specParameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type specOperation struct {
+	Parameters  []*specParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *specSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type specParameter struct {
+	Ref      string      `json:"$ref"`
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Schema   *specSchema `json:"schema"`
+}
+
+type specSchema struct {
+	Ref        string                 `json:"$ref"`
+	Type       string                 `json:"type"`
+	Format     string                 `json:"format"`
+	Enum       []interface{}          `json:"enum"`
+	Pattern    string                 `json:"pattern"`
+	MaxLength  *int                   `json:"maxLength"`
+	Minimum    *float64               `json:"minimum"`
+	Maximum    *float64               `json:"maximum"`
+	Nullable   bool                   `json:"nullable"`
+	Required   []string               `json:"required"`
+	Properties map[string]*specSchema `json:"properties"`
+	Items      *specSchema            `json:"items"`
+	AllOf      []*specSchema          `json:"allOf"`
+	// AdditionalProperties is either false or a schema, only false is checked
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+}
+
+func mustParseSpec(document []byte) *openAPISpec {
+	var spec openAPISpec
+	if err := json.Unmarshal(document, &spec); err != nil {
+		panic(fmt.Sprintf("openapi.json is not valid: %v", err))
+	}
+	return &spec
+}
+
+// operation returns the operation of the route with given path template and method, or nil
+func (spec *openAPISpec) operation(pathTemplate, method string) *specOperation {
+	return spec.Paths[pathTemplate][strings.ToLower(method)]
+}
+
+func (spec *openAPISpec) parameter(param *specParameter) *specParameter {
+	if param.Ref != "" {
+		return spec.Components.Parameters[strings.TrimPrefix(param.Ref, "#/components/parameters/")]
+	}
+	return param
+}
+
+func (spec *openAPISpec) schema(schema *specSchema) *specSchema {
+	for schema != nil && schema.Ref != "" {
+		schema = spec.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOpenAPIMatchesRouter fails when a route is added to the router without documenting it in
+// openapi.json, or the other way around
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	router := Server{Log: log}.Router()
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err := json.NewDecoder(rw.Body).Decode(&spec)
+	assert.Nil(t, err)
+
+	var documented, routed []string
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// routes without methods answer every method, they are documented as GET
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			routed = append(routed, strings.ToUpper(method)+" "+path)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	sort.Strings(documented)
+	sort.Strings(routed)
+	assert.EqualValues(t, routed, documented)
+}
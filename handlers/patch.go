@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// subscriptionDocument holds the fields of a subscription a patch is applied to, by json name
+type subscriptionDocument map[string]string
+
+// patchableFields are the fields a patch can change, the msisdn identifies the subscription
+// and the other fields are kept up to date by the service
+var patchableFields = []string{"activate_at", "sub_type", "status"}
+
+func documentOf(sub model.Subscription) subscriptionDocument {
+	activateAt := sub.ActivateAt
+	// dates are read from the database as timestamps, patches compare and send plain dates
+	if parsed, err := service.ParseDate(activateAt); err == nil {
+		activateAt = parsed.Format("2006-01-02")
+	}
+	return subscriptionDocument{
+		"msisdn":      sub.Msisdn,
+		"activate_at": activateAt,
+		"sub_type":    sub.SubType,
+		"status":      string(sub.Status),
+	}
+}
+
+func (d subscriptionDocument) request() model.CreateSubscription {
+	return model.CreateSubscription{
+		Msisdn:     d["msisdn"],
+		ActivateAt: d["activate_at"],
+		SubType:    d["sub_type"],
+		Status:     model.SubStatus(d["status"]),
+	}
+}
+
+// changed returns the patchable fields which differ from the original document
+func (d subscriptionDocument) changed(original subscriptionDocument) []string {
+	var fields []string
+	for _, field := range patchableFields {
+		if d[field] != original[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// set changes one field, returning what is wrong when the field cannot be set to value
+func (d subscriptionDocument) set(field string, value json.RawMessage) string {
+	if field == "msisdn" {
+		var msisdn string
+		if json.Unmarshal(value, &msisdn) == nil && msisdn == d["msisdn"] {
+			return ""
+		}
+		return "msisdn cannot be changed"
+	}
+	if !isPatchable(field) {
+		return fmt.Sprintf("%v cannot be changed", field)
+	}
+	if string(value) == "null" {
+		return fmt.Sprintf("%v cannot be removed", field)
+	}
+	var str string
+	if err := json.Unmarshal(value, &str); err != nil {
+		return fmt.Sprintf("%v must be a string", field)
+	}
+	d[field] = str
+	return ""
+}
+
+func isPatchable(field string) bool {
+	for _, patchable := range patchableFields {
+		if field == patchable {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMergePatch applies an RFC 7396 JSON Merge Patch to the document
+func applyMergePatch(doc subscriptionDocument, patch []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return apperr.Validation("merge patch must be a json object")
+	}
+	var invalid []apperr.FieldError
+	for field, value := range members {
+		if detail := doc.set(field, value); detail != "" {
+			invalid = append(invalid, apperr.FieldError{Pointer: "/" + escapePointer(field), Detail: detail})
+		}
+	}
+	if len(invalid) > 0 {
+		sortFieldErrors(invalid)
+		return apperr.InvalidFields(invalid)
+	}
+	return nil
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyReplacement replaces the document with a complete representation of the subscription,
+// as sent with PUT. The msisdn may be left out, the other patchable fields are required.
+func applyReplacement(doc subscriptionDocument, body []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return apperr.Validation("request body must be a json object")
+	}
+	var missing []apperr.FieldError
+	for _, field := range patchableFields {
+		if _, ok := members[field]; !ok {
+			missing = append(missing, apperr.FieldError{Pointer: "/" + field, Detail: fmt.Sprintf("%v is required", field)})
+		}
+	}
+	if len(missing) > 0 {
+		return apperr.InvalidFields(missing)
+	}
+	// a subscription as returned by GET can be sent back, the fields kept by the service are ignored
+	for _, field := range serviceFields {
+		delete(members, field)
+	}
+	patch, err := json.Marshal(members)
+	if err != nil {
+		return err
+	}
+	return applyMergePatch(doc, patch)
+}
+
+// serviceFields are the fields of model.Subscription which are set by the service, not by clients
+var serviceFields = []string{"operator", "operator_status", "operator_checked_at", "created_at", "modified_at", "version"}
+
+// applyJSONPatch applies an RFC 6902 JSON Patch to the document. Only the top level fields
+// of a subscription exist, so move and copy are not supported. The patch is applied as a whole
+// or not at all.
+func applyJSONPatch(doc subscriptionDocument, patch []byte) error {
+	var operations []patchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return apperr.Validation("json patch must be an array of operations")
+	}
+	var invalid []apperr.FieldError
+	for i, op := range operations {
+		pointer := fmt.Sprintf("/%d", i)
+		if !strings.HasPrefix(op.Path, "/") || strings.Count(op.Path, "/") != 1 {
+			invalid = append(invalid, apperr.FieldError{Pointer: pointer + "/path", Detail: fmt.Sprintf("path %q is not a field of the subscription", op.Path)})
+			continue
+		}
+		field := unescapePointer(strings.TrimPrefix(op.Path, "/"))
+		if _, ok := doc[field]; !ok {
+			invalid = append(invalid, apperr.FieldError{Pointer: pointer + "/path", Detail: fmt.Sprintf("path %q is not a field of the subscription", op.Path)})
+			continue
+		}
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				invalid = append(invalid, apperr.FieldError{Pointer: pointer + "/value", Detail: fmt.Sprintf("%v needs a value", op.Op)})
+			} else if detail := doc.set(field, op.Value); detail != "" {
+				invalid = append(invalid, apperr.FieldError{Pointer: pointer + "/value", Detail: detail})
+			}
+		case "remove":
+			invalid = append(invalid, apperr.FieldError{Pointer: pointer + "/path", Detail: fmt.Sprintf("%v cannot be removed", field)})
+		case "test":
+			var expected string
+			if json.Unmarshal(op.Value, &expected) != nil || expected != doc[field] {
+				return apperr.Conflict(apperr.CodePatchTestFailed, "test of %v failed, it is %q", op.Path, doc[field])
+			}
+		default:
+			invalid = append(invalid, apperr.FieldError{Pointer: pointer + "/op", Detail: fmt.Sprintf("operation %q is not supported", op.Op)})
+		}
+	}
+	if len(invalid) > 0 {
+		return apperr.InvalidFields(invalid)
+	}
+	return nil
+}
+
+// patchSubscription applies a merge patch or json patch to the stored subscription
+func (s Server) patchSubscription(rw http.ResponseWriter, req *http.Request, contentType string, patch []byte, version int64) {
+	msisdn := mux.Vars(req)["msisdn"]
+	if msisdn == "" && contentType == mergePatchContentType {
+		// on /api/subscription the merge patch names the subscription it changes
+		var target struct {
+			Msisdn string `json:"msisdn"`
+		}
+		json.Unmarshal(patch, &target)
+		msisdn = target.Msisdn
+	}
+	if msisdn == "" {
+		err := apperr.InvalidFields([]apperr.FieldError{{Pointer: "/msisdn", Detail: "msisdn of the subscription to patch cannot be empty"}})
+		s.returnServiceError(rw, "Patch request is not valid", err)
+		return
+	}
+	s.changeSubscription(rw, req, msisdn, version, func(doc subscriptionDocument) error {
+		if contentType == mergePatchContentType {
+			return applyMergePatch(doc, patch)
+		}
+		return applyJSONPatch(doc, patch)
+	})
+}
+
+// changeSubscription applies a change to the stored subscription and updates it. Only the changed
+// fields are validated, the status transition rules are checked by the service.
+func (s Server) changeSubscription(rw http.ResponseWriter, req *http.Request, msisdn string, version int64, apply func(doc subscriptionDocument) error) {
+	current, err := s.SubscriptionService.FindbyID(req.Context(), msisdn)
+	if err != nil {
+		markUnchanged(rw)
+		s.returnServiceError(rw, fmt.Sprintf("Could not find subscription with msisdn %v", msisdn), err)
+		return
+	}
+	if version != 0 && version != current.Version {
+		s.returnServiceError(rw, "Could not update subscription", apperr.VersionMismatch(msisdn, version, current.Version))
+		return
+	}
+	original := documentOf(current)
+	doc := documentOf(current)
+	if err := apply(doc); err != nil {
+		s.returnServiceError(rw, "Request is not valid", err)
+		return
+	}
+
+	changed := doc.changed(original)
+	if len(changed) == 0 {
+		respondSubscription(rw, http.StatusOK, current)
+		return
+	}
+	updateSub := doc.request()
+	if err := validateFields(updateSub, changed...); err != nil {
+		s.returnServiceError(rw, "Request is not valid", err)
+		return
+	}
+	updateSub.Actor, updateSub.Reason = changedBy(req)
+	// the patch was applied to the current version, it must not overwrite a change made since
+	updateSub.ExpectedVersion = current.Version
+	updateSub.ValidateOnly = validateOnly(req)
+	sub, err := s.SubscriptionService.Update(req.Context(), updateSub)
+	if err != nil {
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
+	respondSubscription(rw, http.StatusOK, sub)
+}
+
+// patchContentType returns the patch format of the request body, or an empty string for a full update
+func patchContentType(req *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case mergePatchContentType, jsonPatchContentType:
+		return mediaType
+	}
+	return ""
+}
+
+func escapePointer(field string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(field)
+}
+
+func unescapePointer(token string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+}
+
+// sortFieldErrors orders field errors by pointer, map iteration gives them in random order
+func sortFieldErrors(fields []apperr.FieldError) {
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Pointer < fields[j].Pointer
+	})
+}
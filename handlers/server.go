@@ -1,42 +1,152 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
 	log "github.com/sirupsen/logrus"
 )
 
 type Server struct {
 	Log                 *log.Logger
 	Port                string
+	RequestTimeout      time.Duration
 	SubscriptionService SubscriptionService
+	Scheduler           SchedulerStatusProvider
+	PtsCache            PtsCacheStatsProvider
+	PtsBreaker          PtsBreakerStatsProvider
+	OperatorRefresher   JobStatusProvider
+	Portability         PortabilityService
+	Idempotency         service.IdempotencyRepoInterface
+	IdempotencyTTL      time.Duration
+	// V1Deprecation is when the v1 routes were deprecated in favour of /api/v2/subscriptions, sent in
+	// their Deprecation header, zero leaves it out
+	V1Deprecation time.Time
+	// V1Sunset is sent in the Sunset header of the deprecated v1 routes, zero leaves it out
+	V1Sunset time.Time
+	// ValidateRequests rejects requests not matching the OpenAPI document before they reach the handlers
+	ValidateRequests bool
 }
 
 type SubscriptionService interface {
-	Create(sub model.CreateSubscription) (model.Subscription, error)
-	FindbyID(id string) (model.Subscription, error)
-	Update(sub model.CreateSubscription) (model.Subscription, error)
+	Create(ctx context.Context, sub model.CreateSubscription) (model.Subscription, error)
+	FindbyID(ctx context.Context, id string) (model.Subscription, error)
+	Update(ctx context.Context, sub model.CreateSubscription) (model.Subscription, error)
+	AllowedTransitions(ctx context.Context, msisdn string) (model.AllowedTransitions, error)
+	Transitions() map[model.SubStatus][]model.SubStatus
+	History(ctx context.Context, msisdn string, limit, offset int) (model.HistoryPage, error)
+	List(ctx context.Context, filter model.SubscriptionFilter) (model.SubscriptionPage, error)
+	Import(ctx context.Context, subs []model.CreateSubscription, atomic bool) []error
+	Export(ctx context.Context, filter model.SubscriptionFilter, withOperator bool, write func(model.Subscription) error) error
 }
 
-//  defines routes and their handlers and start the server
+type SchedulerStatusProvider interface {
+	Status() model.SchedulerStatus
+}
+
+type PtsCacheStatsProvider interface {
+	Stats() model.PtsCacheStats
+}
+
+type PtsBreakerStatsProvider interface {
+	Stats() model.PtsBreakerStats
+}
+
+type JobStatusProvider interface {
+	Status() model.JobStatus
+}
+
+type PortabilityService interface {
+	Status() model.JobStatus
+	Report(ctx context.Context, from, to time.Time) (model.PortabilityReport, error)
+}
+
+// defines routes and their handlers and start the server
 func (s Server) Start() error {
 	log.Info("Telness server is starting up")
+	// start the server on specified port
+	err := http.ListenAndServe(fmt.Sprintf(":%s", s.Port), s.Router())
+	log.Errorf("error starting server: %v", err)
+	return err
+}
+
+// Router returns the routes of the api with their handlers
+func (s Server) Router() *mux.Router {
 	// Initialize mux router
 	router := mux.NewRouter()
+	router.Use(s.timeoutMiddleware)
+	if s.ValidateRequests {
+		router.Use(s.validateRequests)
+	}
 
 	// define routes and call their handler function
 	router.HandleFunc("/api/subscription/health", s.CheckHealthHandler)
-	router.HandleFunc("/api/subscription/msisdn/{msisdn}", s.FindHandler).Methods("Get")
-	router.HandleFunc("/api/subscription", s.CreateHandler).Methods("Post")
-	router.HandleFunc("/api/subscription", s.UpdateHandler).Methods("Patch")
-	router.HandleFunc("/api/subscription/update-subscription/msisdn/{msisdn}/status/{status}", s.UpdateStatusHandler).Methods("Patch")
-	router.HandleFunc("/api/subscription/update-activation-date/msisdn/{msisdn}/date/{date}", s.UpdateActivationDateHandler).Methods("Patch")
+	router.HandleFunc("/api/subscription/scheduler/status", s.SchedulerStatusHandler).Methods("Get")
+	router.HandleFunc("/api/subscription/operator-refresher/status", s.OperatorRefresherStatusHandler).Methods("Get")
+	router.HandleFunc("/api/subscription/portability/status", s.PortabilityStatusHandler).Methods("Get")
+	router.HandleFunc("/api/subscription/portability/report", s.PortabilityReportHandler).Methods("Get")
+	router.HandleFunc("/api/subscription/pts/cache", s.PtsCacheStatsHandler).Methods("Get")
+	router.HandleFunc("/api/subscription/pts/breaker", s.PtsBreakerStatsHandler).Methods("Get")
+	router.HandleFunc("/api/subscription/transitions", s.TransitionsHandler).Methods("Get")
+	router.HandleFunc("/api/openapi.json", s.OpenAPIHandler).Methods("Get")
+	router.HandleFunc("/api/docs", s.DocsHandler).Methods("Get")
 
-	// start the server on specified port
-	err := http.ListenAndServe(fmt.Sprintf(":%s", s.Port), router)
-	log.Errorf("error starting server: %v", err)
-	return err
+	// subscriptions as resources, values are sent as json bodies instead of in the path
+	router.HandleFunc("/api/v2/subscriptions", s.ListHandler).Methods("Get")
+	router.HandleFunc("/api/v2/subscriptions", s.idempotent(s.CreateHandler)).Methods("Post")
+	router.HandleFunc("/api/v2/subscriptions/import", s.idempotent(s.ImportHandler)).Methods("Post")
+	router.HandleFunc("/api/v2/subscriptions/export", s.ExportHandler).Methods("Get")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}", s.FindHandler).Methods("Get")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}", s.idempotent(s.ReplaceHandler)).Methods("Put")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}", s.idempotent(s.PatchHandler)).Methods("Patch")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}", s.idempotent(s.CancelHandler)).Methods("Delete")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}/status", s.AllowedTransitionsHandler).Methods("Get")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}/status", s.idempotent(s.SetStatusHandler)).Methods("Put")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}/activation", s.ActivationHandler).Methods("Get")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}/activation", s.idempotent(s.SetActivationHandler)).Methods("Put")
+	router.HandleFunc("/api/v2/subscriptions/{msisdn}/history", s.HistoryHandler).Methods("Get")
+
+	// v1 subscription routes, deprecated in favour of the v2 routes
+	router.HandleFunc("/api/subscription/msisdn/{msisdn}", s.deprecated("/api/v2/subscriptions/{msisdn}", s.FindHandler)).Methods("Get")
+	router.HandleFunc("/api/subscription/msisdn/{msisdn}/transitions", s.deprecated("/api/v2/subscriptions/{msisdn}/status", s.AllowedTransitionsHandler)).Methods("Get")
+	router.HandleFunc("/api/subscription/msisdn/{msisdn}/history", s.deprecated("/api/v2/subscriptions/{msisdn}/history", s.HistoryHandler)).Methods("Get")
+	router.HandleFunc("/api/subscription", s.deprecated("/api/v2/subscriptions", s.ListHandler)).Methods("Get")
+	router.HandleFunc("/api/subscription", s.deprecated("/api/v2/subscriptions", s.idempotent(s.CreateHandler))).Methods("Post")
+	router.HandleFunc("/api/subscription/import", s.deprecated("/api/v2/subscriptions/import", s.idempotent(s.ImportHandler))).Methods("Post")
+	router.HandleFunc("/api/subscription/export", s.deprecated("/api/v2/subscriptions/export", s.ExportHandler)).Methods("Get")
+	router.HandleFunc("/api/subscription", s.deprecated("/api/v2/subscriptions/{msisdn}", s.idempotent(s.UpdateHandler))).Methods("Patch")
+	router.HandleFunc("/api/subscription/update-subscription/msisdn/{msisdn}/status/{status}", s.deprecated("/api/v2/subscriptions/{msisdn}/status", s.idempotent(s.UpdateStatusHandler))).Methods("Patch")
+	router.HandleFunc("/api/subscription/update-activation-date/msisdn/{msisdn}/date/{date}", s.deprecated("/api/v2/subscriptions/{msisdn}/activation", s.idempotent(s.UpdateActivationDateHandler))).Methods("Patch")
+	return router
+}
+
+// untimedRoutes stream their response for as long as it takes, they only stop when the client goes away
+var untimedRoutes = map[string]bool{
+	"/api/v2/subscriptions/export": true,
+	"/api/subscription/export":     true,
+}
+
+// timeoutMiddleware sets RequestTimeout as the request deadline, so db queries and PTS calls stop
+// when it passes or when the client goes away. Zero RequestTimeout means no deadline.
+func (s Server) timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if route := mux.CurrentRoute(req); route != nil {
+			if template, err := route.GetPathTemplate(); err == nil && untimedRoutes[template] {
+				next.ServeHTTP(rw, req)
+				return
+			}
+		}
+		if s.RequestTimeout <= 0 {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		ctx, cancel := context.WithTimeout(req.Context(), s.RequestTimeout)
+		defer cancel()
+		next.ServeHTTP(rw, req.WithContext(ctx))
+	})
 }
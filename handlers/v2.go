@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// deprecated marks a v1 route as deprecated, pointing clients to the v2 route replacing it
+func (s Server) deprecated(successorRoute string, next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		successor := successorRoute
+		if !s.V1Deprecation.IsZero() {
+			rw.Header().Set("Deprecation", fmt.Sprintf("@%d", s.V1Deprecation.Unix()))
+		}
+		if !s.V1Sunset.IsZero() {
+			rw.Header().Set("Sunset", s.V1Sunset.UTC().Format(http.TimeFormat))
+		}
+		if msisdn := mux.Vars(req)["msisdn"]; msisdn != "" {
+			successor = strings.Replace(successor, "{msisdn}", msisdn, 1)
+		}
+		rw.Header().Set("Link", fmt.Sprintf(`<%v>; rel="successor-version"`, successor))
+		next(rw, req)
+	}
+}
+
+// subscriptionLocation returns the v2 url of the subscription with given msisdn
+func subscriptionLocation(msisdn string) string {
+	return "/api/v2/subscriptions/" + msisdn
+}
+
+// ReplaceHandler is an httphandler to handle request to replace all fields of an subscription
+func (s Server) ReplaceHandler(rw http.ResponseWriter, req *http.Request) {
+	msisdn := mux.Vars(req)["msisdn"]
+	version, err := ifMatchVersion(req)
+	if err != nil {
+		s.returnServiceError(rw, "Could not update subscription", err)
+		return
+	}
+	reqBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		msg := fmt.Sprintf("Could not read request body: %v", err)
+		s.Log.Error(msg)
+		returnError(rw, msg, 400)
+		return
+	}
+	s.changeSubscription(rw, req, msisdn, version, func(doc subscriptionDocument) error {
+		return applyReplacement(doc, reqBody)
+	})
+}
+
+// CancelHandler is an httphandler to handle request to delete an subscription. Subscriptions and
+// their history are kept, so deleting cancels the subscription.
+func (s Server) CancelHandler(rw http.ResponseWriter, req *http.Request) {
+	s.updateStatus(rw, req, mux.Vars(req)["msisdn"], model.StatusCancelled)
+}
+
+// SetStatusHandler is an httphandler to handle request to change the status of an subscription,
+// the new status is sent as json body
+func (s Server) SetStatusHandler(rw http.ResponseWriter, req *http.Request) {
+	var body model.StatusChange
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		msg := fmt.Sprintf("Could not unmarshalling request body into StatusChange type: %v", err)
+		s.Log.Error(msg)
+		returnError(rw, msg, 400)
+		return
+	}
+	if body.Status == "" {
+		err := apperr.InvalidFields([]apperr.FieldError{{Pointer: "/status", Detail: "status cannot be empty"}})
+		s.returnServiceError(rw, "Status request body is not valid", err)
+		return
+	}
+	s.updateStatus(rw, req, mux.Vars(req)["msisdn"], body.Status)
+}
+
+// ActivationHandler is an httphandler to handle request to find when an subscription is activated
+func (s Server) ActivationHandler(rw http.ResponseWriter, req *http.Request) {
+	msisdn := mux.Vars(req)["msisdn"]
+	sub, err := s.SubscriptionService.FindbyID(req.Context(), msisdn)
+	if err != nil {
+		s.returnServiceError(rw, fmt.Sprintf("Could not find subscription with msisdn %v", msisdn), err)
+		return
+	}
+	rw.Header().Set("ETag", etag(sub.Version))
+	respondSuccessJSON(rw, http.StatusOK, model.ActivationChange{ActivateAt: documentOf(sub)["activate_at"]})
+}
+
+// SetActivationHandler is an httphandler to handle request to change the activation date of a pending
+// subscription, the new date is sent as json body
+func (s Server) SetActivationHandler(rw http.ResponseWriter, req *http.Request) {
+	var body model.ActivationChange
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		msg := fmt.Sprintf("Could not unmarshalling request body into ActivationChange type: %v", err)
+		s.Log.Error(msg)
+		returnError(rw, msg, 400)
+		return
+	}
+	if body.ActivateAt == "" {
+		err := apperr.InvalidFields([]apperr.FieldError{{Pointer: "/activate_at", Detail: "activate_at cannot be empty"}})
+		s.returnServiceError(rw, "Activation request body is not valid", err)
+		return
+	}
+	s.updateActivationDate(rw, req, mux.Vars(req)["msisdn"], body.ActivateAt)
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pmadhvi/telness-manager/apperr"
+)
+
+// validateRequests rejects requests which do not match the OpenAPI document before they reach
+// the handlers. Path and query parameters and json request bodies are checked, headers are left
+// to the handlers.
+func (s Server) validateRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		route := mux.CurrentRoute(req)
+		if route == nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		op := openAPI.operation(pathTemplate, req.Method)
+		if op == nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		if details := openAPI.validateParameters(op, req); len(details) > 0 {
+			s.returnServiceError(rw, "Request parameters are not valid", apperr.Validation("%v", strings.Join(details, "; ")))
+			return
+		}
+		if op.RequestBody == nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		mediaType := "application/json"
+		if contentType := req.Header.Get("Content-Type"); contentType != "" {
+			mediaType, _, _ = mime.ParseMediaType(contentType)
+		}
+		content, ok := op.RequestBody.Content[mediaType]
+		if !ok {
+			returnError(rw, fmt.Sprintf("Content-Type %v is not supported by %v %v", mediaType, req.Method, pathTemplate), 415)
+			return
+		}
+		if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+			// bodies like csv are read by the handler itself
+			next.ServeHTTP(rw, req)
+			return
+		}
+		reqBody, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			returnError(rw, "Could not read request body", 400)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+		if len(bytes.TrimSpace(reqBody)) == 0 {
+			if op.RequestBody.Required {
+				s.returnServiceError(rw, "Request body is not valid", apperr.Validation("request body is required"))
+				return
+			}
+			next.ServeHTTP(rw, req)
+			return
+		}
+		var body interface{}
+		if err := json.Unmarshal(reqBody, &body); err != nil {
+			returnError(rw, fmt.Sprintf("Could not parse request body as json: %v", err), 400)
+			return
+		}
+		var invalid []apperr.FieldError
+		openAPI.validateValue(content.Schema, body, "", &invalid)
+		if len(invalid) > 0 {
+			s.returnServiceError(rw, "Request body is not valid", apperr.InvalidFields(invalid))
+			return
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// validateParameters returns what is wrong with the path and query parameters of the request
+func (spec *openAPISpec) validateParameters(op *specOperation, req *http.Request) []string {
+	var details []string
+	for _, param := range op.Parameters {
+		param = spec.parameter(param)
+		if param == nil {
+			continue
+		}
+		var values []string
+		switch param.In {
+		case "path":
+			if value, ok := mux.Vars(req)[param.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = req.URL.Query()[param.Name]
+		default:
+			continue
+		}
+		if len(values) == 0 {
+			if param.Required {
+				details = append(details, fmt.Sprintf("%v parameter %v is required", param.In, param.Name))
+			}
+			continue
+		}
+		schema := spec.schema(param.Schema)
+		if schema == nil {
+			continue
+		}
+		var invalid []apperr.FieldError
+		if schema.Type == "array" {
+			// arrays are sent repeated or comma separated
+			for _, value := range values {
+				for _, item := range strings.Split(value, ",") {
+					spec.validateValue(schema.Items, parameterValue(spec.schema(schema.Items), item), "", &invalid)
+				}
+			}
+		} else {
+			spec.validateValue(schema, parameterValue(schema, values[0]), "", &invalid)
+		}
+		for _, field := range invalid {
+			details = append(details, fmt.Sprintf("%v parameter %v %v", param.In, param.Name, strings.TrimPrefix(field.Detail, "value ")))
+		}
+	}
+	return details
+}
+
+// parameterValue converts a parameter to the json type of its schema, values which cannot be
+// converted are kept as string and fail the type check
+func parameterValue(schema *specSchema, value string) interface{} {
+	if schema == nil {
+		return value
+	}
+	switch schema.Type {
+	case "integer", "number":
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return number
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// validateValue checks a value decoded from json against the schema and appends what is wrong to
+// invalid, pointer is the JSON pointer to the value in the request body
+func (spec *openAPISpec) validateValue(schema *specSchema, value interface{}, pointer string, invalid *[]apperr.FieldError) {
+	schema = spec.schema(schema)
+	if schema == nil {
+		return
+	}
+	name := "value"
+	if pointer != "" {
+		name = unescapePointer(pointer[strings.LastIndex(pointer, "/")+1:])
+	}
+	fail := func(format string, args ...interface{}) {
+		*invalid = append(*invalid, apperr.FieldError{Pointer: pointer, Detail: name + " " + fmt.Sprintf(format, args...)})
+	}
+	if value == nil && schema.Nullable {
+		return
+	}
+	for _, all := range schema.AllOf {
+		spec.validateValue(all, value, pointer, invalid)
+	}
+	if value == nil {
+		if schema.Type != "" {
+			fail("cannot be null")
+		}
+		return
+	}
+
+	switch schema.Type {
+	case "object":
+		members, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		for _, field := range schema.Required {
+			if _, ok := members[field]; !ok {
+				*invalid = append(*invalid, apperr.FieldError{Pointer: pointer + "/" + escapePointer(field), Detail: field + " is required"})
+			}
+		}
+		fields := make([]string, 0, len(members))
+		for field := range members {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			fieldPointer := pointer + "/" + escapePointer(field)
+			if property, ok := schema.Properties[field]; ok {
+				spec.validateValue(property, members[field], fieldPointer, invalid)
+			} else if string(schema.AdditionalProperties) == "false" {
+				*invalid = append(*invalid, apperr.FieldError{Pointer: fieldPointer, Detail: field + " is not a field of the request"})
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		for i, item := range items {
+			spec.validateValue(schema.Items, item, fmt.Sprintf("%v/%d", pointer, i), invalid)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		if schema.MaxLength != nil && len(str) > *schema.MaxLength {
+			fail("cannot be longer than %d characters", *schema.MaxLength)
+		}
+		if schema.Pattern != "" {
+			if pattern, err := regexp.Compile(schema.Pattern); err == nil && !pattern.MatchString(str) {
+				fail("must match %v", schema.Pattern)
+			}
+		}
+		if schema.Format == "date" {
+			if _, err := time.Parse("2006-01-02", str); err != nil {
+				fail("must be a date of format 2006-01-02")
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			fail("must be a number")
+			return
+		}
+		if schema.Type == "integer" && number != math.Trunc(number) {
+			fail("must be an integer")
+			return
+		}
+		if schema.Minimum != nil && number < *schema.Minimum {
+			fail("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			fail("must be at most %v", *schema.Maximum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be a boolean")
+			return
+		}
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		allowed := make([]string, 0, len(schema.Enum))
+		for _, v := range schema.Enum {
+			allowed = append(allowed, fmt.Sprint(v))
+		}
+		fail("must be one of %v", strings.Join(allowed, ", "))
+	}
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, v := range enum {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindSubscriptionReturnsETag(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodGet, "/api/subscription/msisdn/{msisdn}", nil)
+	req = mux.SetURLVars(req, map[string]string{"msisdn": "+46107500500"})
+	mockFindSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	http.HandlerFunc(server.FindHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, `"1"`, rw.Header().Get("ETag"))
+}
+
+func TestFindSubscriptionNotModified(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodGet, "/api/subscription/msisdn/{msisdn}", nil)
+	req = mux.SetURLVars(req, map[string]string{"msisdn": "+46107500500"})
+	req.Header.Set("If-None-Match", `"1"`)
+	mockFindSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	http.HandlerFunc(server.FindHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusNotModified, rw.Code)
+	assert.EqualValues(t, `"1"`, rw.Header().Get("ETag"))
+	assert.EqualValues(t, 0, rw.Body.Len())
+}
+
+func TestUpdateStatusWithoutIfMatch(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodPatch, "/api/subscription/update-subscription/msisdn/{msisdn}/status/{status}", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"msisdn": "+46107500500",
+		"status": "paused",
+	})
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	http.HandlerFunc(server.UpdateStatusHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusPreconditionRequired, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, apperr.CodeIfMatchRequired, resp.Code)
+}
+
+func TestUpdateStatusWithStaleIfMatch(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodPatch, "/api/subscription/update-subscription/msisdn/{msisdn}/status/{status}", nil)
+	req = mux.SetURLVars(req, map[string]string{
+		"msisdn": "+46107500500",
+		"status": "paused",
+	})
+	req.Header.Set("If-Match", `"2"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+	updated := false
+	server.db.Update = func(sub model.CreateSubscription) error {
+		updated = true
+		return nil
+	}
+
+	http.HandlerFunc(server.UpdateStatusHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusPreconditionFailed, rw.Code)
+	assert.False(t, updated)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, apperr.CodeVersionMismatch, resp.Code)
+}
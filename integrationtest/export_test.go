@@ -0,0 +1,133 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockExportList(server testServer) *model.SubscriptionFilter {
+	var listed model.SubscriptionFilter
+	server.db.List = func(filter model.SubscriptionFilter) ([]model.Subscription, error) {
+		listed = filter
+		return []model.Subscription{
+			{Msisdn: "+46107500500", ActivateAt: "2027-01-01", SubType: "pbx", Status: model.StatusPending, Operator: "Telia Sverige AB", Version: 1},
+			{Msisdn: "+46107500501", ActivateAt: "2027-02-01", SubType: "cell", Status: model.StatusActivated, Version: 4},
+		}, nil
+	}
+	return &listed
+}
+
+func TestExportCSV(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	listed := mockExportList(server)
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/export?status=pending,activated&sort=msisdn", nil)
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, "text/csv", rw.Header().Get("Content-Type"))
+	assert.Contains(t, rw.Header().Get("Content-Disposition"), ".csv")
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.EqualValues(t, "msisdn,activate_at,sub_type,status,created_at,modified_at,version", lines[0])
+	assert.EqualValues(t, "+46107500501,2027-02-01,cell,activated,,,4", lines[2])
+	assert.EqualValues(t, []model.SubStatus{model.StatusPending, model.StatusActivated}, listed.Status)
+	assert.EqualValues(t, model.SortByMsisdn, listed.Sort)
+	assert.EqualValues(t, 0, listed.Limit)
+}
+
+func TestExportNDJSONWithOperator(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	mockExportList(server)
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/export?include_operator=true", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, "application/x-ndjson", rw.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(rw.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	var row map[string]interface{}
+	err := json.Unmarshal([]byte(lines[0]), &row)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "+46107500500", row["msisdn"])
+	assert.EqualValues(t, 1, row["version"])
+	// the stored operator is exported, it was never confirmed by PTS
+	assert.EqualValues(t, "Telia Sverige AB", row["operator"])
+	assert.EqualValues(t, model.OperatorStatusStale, row["operator_status"])
+	server.pts.AssertNotCalled(t, "GetOperatorDetails")
+}
+
+func TestExportXLSX(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	mockExportList(server)
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/export", nil)
+	req.Header.Set("Accept", "text/csv;q=0.5, application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", rw.Header().Get("Content-Type"))
+	workbook, err := zip.NewReader(bytes.NewReader(rw.Body.Bytes()), int64(rw.Body.Len()))
+	assert.Nil(t, err)
+	var sheet string
+	for _, f := range workbook.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, _ := f.Open()
+			data, _ := ioutil.ReadAll(r)
+			sheet = string(data)
+		}
+	}
+	assert.Contains(t, sheet, `<c r="A1" t="inlineStr"><is><t xml:space="preserve">msisdn</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="A3" t="inlineStr"><is><t xml:space="preserve">+46107500501</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="G3"><v>4</v></c>`)
+}
+
+func TestExportNotAcceptable(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/export", nil)
+	req.Header.Set("Accept", "application/pdf")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusNotAcceptable, rw.Code)
+	assert.Contains(t, rw.Body.String(), "not_acceptable")
+}
+
+func TestExportInvalidFilter(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/export?status=unknown", nil)
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+}
+
+func TestV1ExportIsDeprecated(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	mockExportList(server)
+	req, rw := routedRequest(http.MethodGet, "/api/subscription/export", nil)
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.NotEmpty(t, rw.Header().Get("Deprecation"))
+	assert.Contains(t, rw.Header().Get("Link"), "/api/v2/subscriptions/export")
+}
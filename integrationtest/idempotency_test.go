@@ -0,0 +1,184 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// startServer serves the api over http, so requests go through the whole stack of the server
+func startServer(t *testing.T, server testServer) string {
+	ts := httptest.NewServer(server.Router())
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func postWithKey(t *testing.T, url, key string, body []byte) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, url+"/api/subscription", bytes.NewBuffer(body))
+	assert.Nil(t, err)
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("could not send request: %v", err)
+	}
+	return resp
+}
+
+func TestCreateSubscriptionRetriedWithIdempotencyKey(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	url := startServer(t, server)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	mockCreateSubscription(server, "+46107500510", tomorrow, "pbx", "pending")
+	request := []byte(`{"msisdn": "+46107500510", "activate_at": "` + tomorrow + `", "sub_type": "pbx", "status": "pending"}`)
+
+	first := postWithKey(t, url, "create-46107500510", request)
+	firstBody, _ := ioutil.ReadAll(first.Body)
+	first.Body.Close()
+	retry := postWithKey(t, url, "create-46107500510", request)
+	retryBody, _ := ioutil.ReadAll(retry.Body)
+	retry.Body.Close()
+
+	assert.EqualValues(t, http.StatusCreated, first.StatusCode)
+	assert.EqualValues(t, http.StatusCreated, retry.StatusCode)
+	server.db.AssertCallCount(t, "CreateSubscription", 1)
+	assert.EqualValues(t, firstBody, retryBody)
+	assert.EqualValues(t, "true", retry.Header.Get("Idempotent-Replayed"))
+	assert.EqualValues(t, "application/json", retry.Header.Get("Content-Type"))
+}
+
+func TestCreateSubscriptionIdempotencyKeyReusedWithOtherBody(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	url := startServer(t, server)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	mockCreateSubscription(server, "+46107500511", tomorrow, "pbx", "pending")
+
+	first := postWithKey(t, url, "create-46107500511", []byte(`{"msisdn": "+46107500511", "activate_at": "`+tomorrow+`", "sub_type": "pbx", "status": "pending"}`))
+	first.Body.Close()
+	other := postWithKey(t, url, "create-46107500511", []byte(`{"msisdn": "+46107500511", "activate_at": "`+tomorrow+`", "sub_type": "cell", "status": "pending"}`))
+	defer other.Body.Close()
+
+	assert.EqualValues(t, http.StatusCreated, first.StatusCode)
+	assert.EqualValues(t, http.StatusConflict, other.StatusCode)
+	var resp model.Problem
+	err := json.NewDecoder(other.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, apperr.CodeIdempotencyKeyReused, resp.Code)
+}
+
+func TestCreateSubscriptionServerErrorKeepsIdempotencyKey(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	url := startServer(t, server)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	mockCreateSubscription(server, "+46107500512", tomorrow, "pbx", "pending")
+	server.db.Create = func(sub model.CreateSubscription) error {
+		return errors.New("connection reset by peer")
+	}
+	request := []byte(`{"msisdn": "+46107500512", "activate_at": "` + tomorrow + `", "sub_type": "pbx", "status": "pending"}`)
+
+	first := postWithKey(t, url, "create-46107500512", request)
+	first.Body.Close()
+	retry := postWithKey(t, url, "create-46107500512", request)
+	retry.Body.Close()
+
+	// the insert may have been committed before the connection was reset, so it is not run again
+	assert.EqualValues(t, http.StatusInternalServerError, first.StatusCode)
+	assert.EqualValues(t, http.StatusInternalServerError, retry.StatusCode)
+	assert.EqualValues(t, "true", retry.Header.Get("Idempotent-Replayed"))
+	server.db.AssertCallCount(t, "CreateSubscription", 1)
+	server.keys.AssertNotCalled(t, "ReleaseIdempotencyKey")
+}
+
+func TestSetStatusIdempotencyKeyReleasedWhenNothingWritten(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	server.db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{}, errors.New("connection refused")
+	}
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/status", []byte(`{"status": "cancelled"}`))
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("Idempotency-Key", "cancel-46107500500")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusInternalServerError, rw.Code)
+	server.keys.AssertCalled(t, "ReleaseIdempotencyKey", "cancel-46107500500")
+	server.db.AssertNotCalled(t, "UpdateSubscription")
+}
+
+func TestValidateOnlyIsNotReplayedForTheRealRequest(t *testing.T) {
+	t.Parallel()
+	s := memoryServer()
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	code, _ := serve(s, http.MethodPost, "/api/v2/subscriptions", `{"msisdn": "+46107500515", "activate_at": "`+tomorrow+`", "sub_type": "pbx", "status": "pending"}`, nil)
+	assert.EqualValues(t, http.StatusCreated, code)
+	header := map[string]string{"If-Match": `"1"`, "Idempotency-Key": "cancel-46107500515"}
+
+	code, _ = serve(s, http.MethodPut, "/api/v2/subscriptions/+46107500515/status?validate_only=true", `{"status": "cancelled"}`, header)
+	assert.EqualValues(t, http.StatusOK, code)
+	code, problem := serve(s, http.MethodPut, "/api/v2/subscriptions/+46107500515/status", `{"status": "cancelled"}`, header)
+
+	assert.EqualValues(t, http.StatusConflict, code)
+	assert.EqualValues(t, apperr.CodeIdempotencyKeyReused, problem.Code)
+	code, _ = serve(s, http.MethodPut, "/api/v2/subscriptions/+46107500515/status", `{"status": "cancelled"}`, map[string]string{"If-Match": `"1"`, "Idempotency-Key": "cancel-46107500515-2"})
+	assert.EqualValues(t, http.StatusOK, code)
+}
+
+func TestSetStatusRetriedKeepsHeaders(t *testing.T) {
+	t.Parallel()
+	s := memoryServer()
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	code, _ := serve(s, http.MethodPost, "/api/v2/subscriptions", `{"msisdn": "+46107500512", "activate_at": "`+tomorrow+`", "sub_type": "pbx", "status": "pending"}`, nil)
+	assert.EqualValues(t, http.StatusCreated, code)
+	put := func() *httptest.ResponseRecorder {
+		req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500512/status", []byte(`{"status": "cancelled"}`))
+		req.Header.Set("If-Match", `"1"`)
+		req.Header.Set("Idempotency-Key", "cancel-46107500512")
+		s.Router().ServeHTTP(rw, req)
+		return rw
+	}
+
+	first := put()
+	retry := put()
+
+	assert.EqualValues(t, http.StatusOK, first.Code)
+	assert.EqualValues(t, http.StatusOK, retry.Code)
+	assert.EqualValues(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.EqualValues(t, `"2"`, first.Header().Get("ETag"))
+	assert.EqualValues(t, first.Header().Get("ETag"), retry.Header().Get("ETag"))
+}
+
+func TestCreateSubscriptionRetriedKeepsLocation(t *testing.T) {
+	t.Parallel()
+	s := memoryServer()
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	post := func() *httptest.ResponseRecorder {
+		req, rw := routedRequest(http.MethodPost, "/api/subscription", []byte(`{"msisdn": "+46107500513", "activate_at": "`+tomorrow+`", "sub_type": "pbx", "status": "pending"}`))
+		req.Header.Set("Idempotency-Key", "create-46107500513")
+		s.Router().ServeHTTP(rw, req)
+		return rw
+	}
+
+	first := post()
+	retry := post()
+
+	assert.EqualValues(t, http.StatusCreated, retry.Code)
+	assert.EqualValues(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	for _, name := range []string{"ETag", "Location", "Deprecation", "Link"} {
+		assert.NotEmpty(t, first.Header().Get(name), name)
+		assert.EqualValues(t, first.Header().Get(name), retry.Header().Get(name), name)
+	}
+}
@@ -0,0 +1,146 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var importDate = time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+
+func importRequest(server testServer, url, contentType, body string) (*http.Request, model.ImportResult, int) {
+	req, rw := routedRequest(http.MethodPost, url, []byte(body))
+	req.Header.Set("Content-Type", contentType)
+	server.Router().ServeHTTP(rw, req)
+	var result model.ImportResult
+	json.NewDecoder(rw.Body).Decode(&result)
+	return req, result, rw.Code
+}
+
+func mockImport(server testServer) *[]model.CreateSubscription {
+	var created []model.CreateSubscription
+	server.db.CreateBatch = func(subs []model.CreateSubscription, atomic bool) ([]error, error) {
+		created = append(created, subs...)
+		return make([]error, len(subs)), nil
+	}
+	return &created
+}
+
+func TestImportCSV(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	created := mockImport(server)
+	body := fmt.Sprintf("\ufeffmsisdn,activate_at,sub_type,status\n+46107500500,%v,pbx,pending\n+46107500501,%v,cell,pending\n", importDate, importDate)
+
+	_, result, code := importRequest(server, "/api/v2/subscriptions/import", "text/csv", body)
+
+	assert.EqualValues(t, http.StatusOK, code)
+	assert.EqualValues(t, 2, result.Total)
+	assert.EqualValues(t, 2, result.Created)
+	assert.EqualValues(t, 0, result.Failed)
+	assert.Len(t, *created, 2)
+	assert.EqualValues(t, "+46107500501", (*created)[1].Msisdn)
+	assert.EqualValues(t, model.ImportRowCreated, result.Rows[0].Status)
+}
+
+func TestImportNDJSONWithInvalidRows(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	created := mockImport(server)
+	body := fmt.Sprintf(`{"msisdn": "+46107500500", "activate_at": "%v", "sub_type": "pbx", "status": "pending"}
+{"msisdn": "0107500501", "activate_at": "%v", "sub_type": "pbx", "status": "pending"}
+
+{"msisdn": "+46107500500", "activate_at": "%v", "sub_type": "cell", "status": "pending"}
+not json
+`, importDate, importDate, importDate)
+
+	_, result, code := importRequest(server, "/api/v2/subscriptions/import", "application/x-ndjson", body)
+
+	assert.EqualValues(t, http.StatusOK, code)
+	assert.EqualValues(t, 4, result.Total)
+	assert.EqualValues(t, 1, result.Created)
+	assert.EqualValues(t, 3, result.Failed)
+	assert.Len(t, *created, 1)
+	assert.EqualValues(t, model.ImportRowInvalid, result.Rows[1].Status)
+	assert.EqualValues(t, apperr.CodeValidationFailed, result.Rows[1].Code)
+	assert.EqualValues(t, "/msisdn", result.Rows[1].Errors[0].Pointer)
+	assert.EqualValues(t, "msisdn is on row 1 already", result.Rows[2].Errors[0].Detail)
+	assert.EqualValues(t, model.ImportRowInvalid, result.Rows[3].Status)
+}
+
+func TestImportRowFailsInDatabase(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	server.db.CreateBatch = func(subs []model.CreateSubscription, atomic bool) ([]error, error) {
+		return []error{nil, apperr.Conflict(apperr.CodeSubscriptionExists, "subscription already exists")}, nil
+	}
+	body := fmt.Sprintf("msisdn,activate_at,sub_type,status\n+46107500500,%v,pbx,pending\n+46107500501,%v,pbx,pending\n", importDate, importDate)
+
+	_, result, _ := importRequest(server, "/api/v2/subscriptions/import", "text/csv", body)
+
+	assert.EqualValues(t, 1, result.Created)
+	assert.EqualValues(t, model.ImportRowFailed, result.Rows[1].Status)
+	assert.EqualValues(t, apperr.CodeSubscriptionExists, result.Rows[1].Code)
+}
+
+func TestImportValidateOnly(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	created := mockImport(server)
+	body := fmt.Sprintf("msisdn,activate_at,sub_type,status\n+46107500500,%v,pbx,pending\n", importDate)
+
+	_, result, code := importRequest(server, "/api/v2/subscriptions/import?validate_only=true", "text/csv", body)
+
+	assert.EqualValues(t, http.StatusOK, code)
+	assert.True(t, result.ValidateOnly)
+	assert.EqualValues(t, 0, result.Created)
+	assert.EqualValues(t, model.ImportRowValid, result.Rows[0].Status)
+	assert.Empty(t, *created)
+}
+
+func TestImportAtomicWithInvalidRow(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	created := mockImport(server)
+	body := fmt.Sprintf("msisdn,activate_at,sub_type,status\n+46107500500,%v,pbx,pending\n+46107500501,2020-01-01,pbx,pending\n", importDate)
+
+	_, result, _ := importRequest(server, "/api/v2/subscriptions/import?atomic=true", "text/csv", body)
+
+	assert.Empty(t, *created)
+	assert.EqualValues(t, 0, result.Created)
+	assert.EqualValues(t, 2, result.Failed)
+	assert.EqualValues(t, model.ImportRowSkipped, result.Rows[0].Status)
+	assert.EqualValues(t, apperr.CodeImportRowSkipped, result.Rows[0].Code)
+	assert.EqualValues(t, model.ImportRowInvalid, result.Rows[1].Status)
+}
+
+func TestImportCSVMissingColumns(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPost, "/api/v2/subscriptions/import", []byte("msisdn,sub_type\n+46107500500,pbx\n"))
+	req.Header.Set("Content-Type", "text/csv")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+	assert.Contains(t, rw.Body.String(), "activate_at, status")
+}
+
+func TestImportUnsupportedContentType(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPost, "/api/v2/subscriptions/import", []byte(`[]`))
+	req.Header.Set("Content-Type", "application/json")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnsupportedMediaType, rw.Code)
+}
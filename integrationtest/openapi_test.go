@@ -0,0 +1,89 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocsPage(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodGet, "/api/docs", nil)
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.Contains(t, rw.Body.String(), "/api/openapi.json")
+}
+
+func validatingServer(server testServer) http.Handler {
+	validating := server
+	validating.ValidateRequests = true
+	return validating.Router()
+}
+
+func TestValidationRejectsBodyNotMatchingSpec(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	body := []byte(`{"msisdn": "0107500500", "activate_at": "tomorrow", "status": "unknown", "color": "red"}`)
+	req, rw := routedRequest(http.MethodPost, "/api/v2/subscriptions", body)
+	req.Header.Set("Content-Type", "application/json")
+
+	validatingServer(server).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, apperr.CodeValidationFailed, resp.Code)
+	var pointers []string
+	for _, field := range resp.Errors {
+		pointers = append(pointers, field.Pointer)
+	}
+	assert.EqualValues(t, []string{"/sub_type", "/activate_at", "/color", "/msisdn", "/status"}, pointers)
+}
+
+func TestValidationRejectsUndocumentedContentType(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/status", []byte(`status=paused`))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	validatingServer(server).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnsupportedMediaType, rw.Code)
+}
+
+func TestValidationRejectsQueryParameters(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions?limit=0&status=pending,unknown", nil)
+
+	validatingServer(server).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.Contains(t, resp.Detail, "query parameter status must be one of")
+	assert.Contains(t, resp.Detail, "query parameter limit must be at least 1")
+}
+
+func TestValidationPassesValidRequest(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/status", []byte(`{"status": "paused"}`))
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	validatingServer(server).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+}
@@ -0,0 +1,132 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatchSubscriptionSubType(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodPatch, "/api/v2/subscriptions/{msisdn}", []byte(`{"sub_type": "pbx"}`))
+	req = mux.SetURLVars(req, map[string]string{"msisdn": "+46107500500"})
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	// activate_at is in the past, which is fine as long as it is not changed
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+	var updated model.CreateSubscription
+	server.db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+
+	http.HandlerFunc(server.PatchHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, "+46107500500", updated.Msisdn)
+	assert.EqualValues(t, "pbx", updated.SubType)
+	assert.EqualValues(t, "2021-10-11", updated.ActivateAt)
+	assert.EqualValues(t, model.StatusActivated, updated.Status)
+	assert.EqualValues(t, 1, updated.ExpectedVersion)
+}
+
+func TestMergePatchOnCollectionRoute(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodPatch, "/api/subscription", []byte(`{"msisdn": "+46107500500", "status": "paused"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", "*")
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+	var updated model.CreateSubscription
+	server.db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+
+	http.HandlerFunc(server.UpdateHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, model.StatusPaused, updated.Status)
+	assert.EqualValues(t, "cell", updated.SubType)
+}
+
+func TestMergePatchReadOnlyFields(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodPatch, "/api/v2/subscriptions/{msisdn}", []byte(`{"msisdn": "+46107500501", "created_at": "2021-10-11", "sub_type": null}`))
+	req = mux.SetURLVars(req, map[string]string{"msisdn": "+46107500500"})
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	http.HandlerFunc(server.PatchHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []model.ProblemField{
+		{Pointer: "/created_at", Detail: "created_at cannot be changed"},
+		{Pointer: "/msisdn", Detail: "msisdn cannot be changed"},
+		{Pointer: "/sub_type", Detail: "sub_type cannot be removed"},
+	}, resp.Errors)
+}
+
+func TestJSONPatchInvalidTransition(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	request := []byte(`[{"op": "test", "path": "/status", "value": "cancelled"}, {"op": "replace", "path": "/status", "value": "activated"}]`)
+	req, rw := requestResponse(http.MethodPatch, "/api/v2/subscriptions/{msisdn}", request)
+	req = mux.SetURLVars(req, map[string]string{"msisdn": "+46107500500"})
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "cancelled")
+
+	http.HandlerFunc(server.PatchHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusConflict, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, apperr.CodeInvalidTransition, resp.Code)
+}
+
+func TestJSONPatchFailedTest(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	request := []byte(`[{"op": "test", "path": "/sub_type", "value": "pbx"}, {"op": "replace", "path": "/sub_type", "value": "cell"}]`)
+	req, rw := requestResponse(http.MethodPatch, "/api/v2/subscriptions/{msisdn}", request)
+	req = mux.SetURLVars(req, map[string]string{"msisdn": "+46107500500"})
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	http.HandlerFunc(server.PatchHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusConflict, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, apperr.CodePatchTestFailed, resp.Code)
+}
+
+func TestPatchWithUnsupportedContentType(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := requestResponse(http.MethodPatch, "/api/v2/subscriptions/{msisdn}", []byte(`{"sub_type": "pbx"}`))
+	req = mux.SetURLVars(req, map[string]string{"msisdn": "+46107500500"})
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+
+	http.HandlerFunc(server.PatchHandler).ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnsupportedMediaType, rw.Code)
+}
@@ -5,13 +5,12 @@ package integrationtest
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
-	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/apperr"
 
 	"github.com/gorilla/mux"
 	"github.com/pmadhvi/telness-manager/model"
@@ -28,11 +27,11 @@ func requestResponse(method string, url string, requestBody []byte) (*http.Reque
 	return req, rw
 }
 
-func mockCreateSubscription(msisdn string, now, sub_type string, status model.SubStatus) {
-	mock.Create = func(sub model.CreateSubscription) error {
+func mockCreateSubscription(server testServer, msisdn string, now, sub_type string, status model.SubStatus) {
+	server.db.Create = func(sub model.CreateSubscription) error {
 		return nil
 	}
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
+	server.db.FindByID = func(msisdn string) (model.Subscription, error) {
 		return model.Subscription{
 			Msisdn:     msisdn,
 			ActivateAt: now,
@@ -40,17 +39,18 @@ func mockCreateSubscription(msisdn string, now, sub_type string, status model.Su
 			Status:     status,
 			CreatedAt:  now,
 			ModifiedAt: now,
+			Version:    1,
 		}, nil
 	}
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+	server.pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
 		return model.PtsResponse{
 			D: model.OperatorDetails{Name: "Telness AB"},
 		}, nil
 	}
 }
 
-func mockFindSubscription(msisdn string, now, sub_type string, status model.SubStatus) {
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
+func mockFindSubscription(server testServer, msisdn string, now, sub_type string, status model.SubStatus) {
+	server.db.FindByID = func(msisdn string) (model.Subscription, error) {
 		return model.Subscription{
 			Msisdn:     msisdn,
 			ActivateAt: now,
@@ -58,23 +58,24 @@ func mockFindSubscription(msisdn string, now, sub_type string, status model.SubS
 			Status:     status,
 			CreatedAt:  now,
 			ModifiedAt: now,
+			Version:    1,
 		}, nil
 	}
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+	server.pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
 		return model.PtsResponse{
 			D: model.OperatorDetails{Name: "Telness AB"},
 		}, nil
 	}
 }
 
-func mockFindNonExistingSubscription(msisdn string) {
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
-		return model.Subscription{}, errors.New("subscription not found")
+func mockFindNonExistingSubscription(server testServer, msisdn string) {
+	server.db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{}, apperr.NotFound(apperr.CodeSubscriptionNotFound, nil, "subscription not found")
 	}
 }
 
-func mockUpdateSubscription(msisdn string, now, sub_type string, status model.SubStatus) {
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
+func mockUpdateSubscription(server testServer, msisdn string, now, sub_type string, status model.SubStatus) {
+	server.db.FindByID = func(msisdn string) (model.Subscription, error) {
 		return model.Subscription{
 			Msisdn:     msisdn,
 			ActivateAt: now,
@@ -82,20 +83,23 @@ func mockUpdateSubscription(msisdn string, now, sub_type string, status model.Su
 			Status:     status,
 			CreatedAt:  now,
 			ModifiedAt: now,
+			Version:    1,
 		}, nil
 	}
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+	server.pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
 		return model.PtsResponse{
 			D: model.OperatorDetails{Name: "Telness AB"},
 		}, nil
 	}
-	mock.Update = func(sub model.CreateSubscription) error {
+	server.db.Update = func(sub model.CreateSubscription) error {
 		return nil
 	}
 
 }
 
 func TestCreateSubscription(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	var (
 		msisdn = "+46107500500"
 		now    = time.Now().Format("2006-01-02")
@@ -107,7 +111,7 @@ func TestCreateSubscription(t *testing.T) {
 		"status":     "pending"}`)
 	req, rw := requestResponse(http.MethodPost, "/api/subscription", request)
 
-	mockCreateSubscription(msisdn, now, "pbx", "pending")
+	mockCreateSubscription(server, msisdn, now, "pbx", "pending")
 	handler := http.HandlerFunc(server.CreateHandler)
 	handler.ServeHTTP(rw, req)
 	if status := rw.Code; status != http.StatusCreated {
@@ -127,6 +131,8 @@ func TestCreateSubscription(t *testing.T) {
 }
 
 func TestCreateSubscriptionEmptyStatus(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	request := []byte(`{
 		"msisdn": "+46107500500",
 		"activate_at": "2021-10-17",
@@ -135,19 +141,27 @@ func TestCreateSubscriptionEmptyStatus(t *testing.T) {
 
 	handler := http.HandlerFunc(server.CreateHandler)
 	handler.ServeHTTP(rw, req)
-	if status := rw.Code; status != http.StatusBadRequest {
+	if status := rw.Code; status != http.StatusUnprocessableEntity {
 		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusBadRequest)
+			status, http.StatusUnprocessableEntity)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "Create request body is not valid: status cannot be empty", resp.Message)
+	assert.EqualValues(t, "Create request body is not valid: activate_at should be future date; status cannot be empty", resp.Detail)
+	assert.EqualValues(t, apperr.CodeValidationFailed, resp.Code)
+	assert.EqualValues(t, "application/problem+json", rw.Header().Get("Content-Type"))
+	assert.EqualValues(t, []model.ProblemField{
+		{Pointer: "/activate_at", Detail: "activate_at should be future date"},
+		{Pointer: "/status", Detail: "status cannot be empty"},
+	}, resp.Errors)
 }
 
 func TestUpdateSubscription(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	var (
 		msisdn = "+46107500501"
 		now    = time.Now().Format("2006-01-02")
@@ -158,9 +172,10 @@ func TestUpdateSubscription(t *testing.T) {
 		"sub_type":    "cell",
 		"status":     "activated"}`)
 	req, rw := requestResponse(http.MethodPatch, "/api/subscription", request)
+	req.Header.Set("If-Match", `"1"`)
 
-	mockUpdateSubscription(msisdn, now, "pbx", "pending")
-	mockFindSubscription(msisdn, now, "cell", "activated")
+	mockUpdateSubscription(server, msisdn, now, "pbx", "pending")
+	mockFindSubscription(server, msisdn, now, "cell", "activated")
 	handler := http.HandlerFunc(server.UpdateHandler)
 	handler.ServeHTTP(rw, req)
 	if status := rw.Code; status != http.StatusOK {
@@ -180,27 +195,34 @@ func TestUpdateSubscription(t *testing.T) {
 }
 
 func TestUpdateSubscriptionEmptymsisdn(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	request := []byte(`{
 		"activate_at": "2021-09-17",
 		"sub_type":    "pbx",
 		"status": "pending"}`)
 	req, rw := requestResponse(http.MethodPatch, "/api/subscription", request)
+	req.Header.Set("If-Match", `"1"`)
 
 	handler := http.HandlerFunc(server.UpdateHandler)
 	handler.ServeHTTP(rw, req)
-	if status := rw.Code; status != http.StatusBadRequest {
+	if status := rw.Code; status != http.StatusUnprocessableEntity {
 		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusBadRequest)
+			status, http.StatusUnprocessableEntity)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "Update request body is not valid: msisdn cannot be nil", resp.Message)
+	assert.EqualValues(t, "Update request body is not valid: msisdn cannot be nil; activate_at should be future date", resp.Detail)
+	assert.EqualValues(t, apperr.CodeValidationFailed, resp.Code)
+	assert.EqualValues(t, "/msisdn", resp.Errors[0].Pointer)
 }
 
 func TestFindSubscription(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	var (
 		msisdn = "+46107500500"
 		now    = time.Now().Format("2006-01-02")
@@ -209,7 +231,7 @@ func TestFindSubscription(t *testing.T) {
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "+46107500500",
 	})
-	mockFindSubscription(msisdn, now, "cell", "activated")
+	mockFindSubscription(server, msisdn, now, "cell", "activated")
 	handler := http.HandlerFunc(server.FindHandler)
 	handler.ServeHTTP(rw, req)
 	if status := rw.Code; status != http.StatusOK {
@@ -229,6 +251,8 @@ func TestFindSubscription(t *testing.T) {
 }
 
 func TestFindSubscriptionWithEmptymsisdn(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	req, rw := requestResponse(http.MethodGet, "/api/subscription/msisdn/", nil)
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "",
@@ -239,48 +263,54 @@ func TestFindSubscriptionWithEmptymsisdn(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusBadRequest)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "msisdn cannot be empty", resp.Message)
+	assert.EqualValues(t, "msisdn cannot be empty", resp.Detail)
 }
 
 func TestFindSubscriptionWithNonExistantmsisdn(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	req, rw := requestResponse(http.MethodGet, "/api/subscription/msisdn/", nil)
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "+46107500578",
 	})
 	msisdn := "+46107500578"
-	mockFindNonExistingSubscription(msisdn)
+	mockFindNonExistingSubscription(server, msisdn)
 	handler := http.HandlerFunc(server.FindHandler)
 	handler.ServeHTTP(rw, req)
 	if status := rw.Code; status != http.StatusNotFound {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusNotFound)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "Could not find subscription with msisdn +46107500578, subscription not found", resp.Message)
+	assert.EqualValues(t, "Could not find subscription with msisdn +46107500578: subscription not found", resp.Detail)
+	assert.EqualValues(t, apperr.CodeSubscriptionNotFound, resp.Code)
 }
 
 func TestCancelSubscription(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	var (
 		msisdn = "+46107500500"
 		now    = time.Now().Format("2006-01-02")
 	)
 
 	req, rw := requestResponse(http.MethodPatch, "/api/subscription/update-subscription/msisdn/{msisdn}/status/{status}", nil)
+	req.Header.Set("If-Match", `"1"`)
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "+46107500500",
 		"status": "cancelled",
 	})
-	mockUpdateSubscription(msisdn, now, "cell", "activated")
-	mockFindSubscription(msisdn, "2021-10-11", "cell", "cancelled")
+	mockUpdateSubscription(server, msisdn, now, "cell", "activated")
+	mockFindSubscription(server, msisdn, "2021-10-11", "cell", "cancelled")
 	handler := http.HandlerFunc(server.UpdateStatusHandler)
 	handler.ServeHTTP(rw, req)
 	if status := rw.Code; status != http.StatusOK {
@@ -300,6 +330,8 @@ func TestCancelSubscription(t *testing.T) {
 }
 
 func TestPauseSubscriptionWithEmptymsisdn(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	req, rw := requestResponse(http.MethodPost, "/api/subscription/update-subscription/msisdn/{msisdn}/status/{status}", nil)
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "",
@@ -311,49 +343,56 @@ func TestPauseSubscriptionWithEmptymsisdn(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusBadRequest)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "msisdn cannot be empty", resp.Message)
+	assert.EqualValues(t, "msisdn cannot be empty", resp.Detail)
 }
 
 func TestReactivateSubscriptionWithNonExistingmsisdn(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	req, rw := requestResponse(http.MethodPost, "/api/subscription", nil)
+	req.Header.Set("If-Match", "*")
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "+46107500500",
 		"status": "activated",
 	})
 	msisdn := "+46107500500"
-	mockFindNonExistingSubscription(msisdn)
+	mockFindNonExistingSubscription(server, msisdn)
 	handler := http.HandlerFunc(server.UpdateStatusHandler)
 	handler.ServeHTTP(rw, req)
 	if status := rw.Code; status != http.StatusNotFound {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusNotFound)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "Could not find subscription with msisdn +46107500500, subscription not found", resp.Message)
+	assert.EqualValues(t, "Could not find subscription with msisdn +46107500500: subscription not found", resp.Detail)
+	assert.EqualValues(t, apperr.CodeSubscriptionNotFound, resp.Code)
 }
 
 func TestUpdateActivationDate(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	var (
 		msisdn = "+46107500500"
 		now    = time.Now().Format("2006-01-02")
 	)
 
 	req, rw := requestResponse(http.MethodPatch, "/api/subscription/update-activation-date/msisdn/{msisdn}/date/{date}", nil)
+	req.Header.Set("If-Match", `"1"`)
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "+46107500500",
 		"date":   "2021-10-11",
 	})
-	mockUpdateSubscription(msisdn, now, "cell", "pending")
-	mockFindSubscription(msisdn, "2021-10-11", "cell", "pending")
+	mockUpdateSubscription(server, msisdn, now, "cell", "pending")
+	mockFindSubscription(server, msisdn, "2021-10-11", "cell", "pending")
 	handler := http.HandlerFunc(server.UpdateActivationDateHandler)
 	handler.ServeHTTP(rw, req)
 	if status := rw.Code; status != http.StatusOK {
@@ -373,27 +412,34 @@ func TestUpdateActivationDate(t *testing.T) {
 }
 
 func TestUpdateActivationDateWithWrongDate(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	req, rw := requestResponse(http.MethodPatch, "/api/subscription/update-activation-date/msisdn/{msisdn}/date/{date}", nil)
+	req.Header.Set("If-Match", "*")
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "+46107500500",
 		"date":   "2021-09-11",
 	})
 	handler := http.HandlerFunc(server.UpdateActivationDateHandler)
 	handler.ServeHTTP(rw, req)
-	if status := rw.Code; status != http.StatusBadRequest {
+	if status := rw.Code; status != http.StatusUnprocessableEntity {
 		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusBadRequest)
+			status, http.StatusUnprocessableEntity)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "enter valid future date for activation", resp.Message)
+	assert.EqualValues(t, "Activation date is not valid: enter valid future date for activation", resp.Detail)
+	assert.EqualValues(t, apperr.CodeValidationFailed, resp.Code)
 }
 
 func TestUpdateActivationDateWithEmptyDate(t *testing.T) {
+	t.Parallel()
+	server := newServer()
 	req, rw := requestResponse(http.MethodPatch, "/api/subscription/update-activation-date/msisdn/{msisdn}/date/{date}", nil)
+	req.Header.Set("If-Match", "*")
 	req = mux.SetURLVars(req, map[string]string{
 		"msisdn": "+46107500500",
 		"date":   "",
@@ -404,10 +450,10 @@ func TestUpdateActivationDateWithEmptyDate(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v",
 			status, http.StatusBadRequest)
 	}
-	var resp model.ErrorMessage
+	var resp model.Problem
 	err := json.NewDecoder(rw.Body).Decode(&resp)
 	if err != nil {
 		t.Errorf("could not decode response: %v", err)
 	}
-	assert.EqualValues(t, "enter valid date for activation, date cannot be empty", resp.Message)
+	assert.EqualValues(t, "enter valid date for activation, date cannot be empty", resp.Detail)
 }
@@ -4,7 +4,7 @@ package integrationtest
 
 import (
 	"os"
-	"testing"
+	"time"
 
 	"github.com/pmadhvi/telness-manager/handlers"
 	"github.com/pmadhvi/telness-manager/mock"
@@ -12,24 +12,33 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var server handlers.Server
+// testServer is a server on mocks of its own, so every test can script them and run in parallel
+type testServer struct {
+	handlers.Server
+	db   *mock.DbMock
+	pts  *mock.ClientMock
+	keys *mock.IdempotencyMock
+}
+
+// v1Deprecation is the deprecation date of the v1 routes the test servers are configured with
+var v1Deprecation = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
 
-func setup() {
+func newServer() testServer {
 	var (
-		log              = logrus.New()
-		subscriptionRepo = &mock.DbMock{}
-		client           = &mock.ClientMock{}
-		subsvc           = service.SubscriptionSvc{Log: log, SubscriptionRepo: subscriptionRepo, PtsClient: client}
+		log  = logrus.New()
+		db   = &mock.DbMock{}
+		pts  = &mock.ClientMock{}
+		keys = &mock.IdempotencyMock{}
 	)
 	log.SetOutput(os.Stdout)
-	server = handlers.Server{Log: log, Port: "7000", SubscriptionService: subsvc}
-	go func() {
-		err := server.Start()
-		log.Error("Test Server could not be started:", err)
-	}()
-}
-
-func TestMain(m *testing.M) {
-	setup()
-	os.Exit(m.Run())
+	db.SetOperator = func(msisdn string, operator string, checkedAt time.Time) error {
+		return nil
+	}
+	subsvc := service.SubscriptionSvc{Log: log, SubscriptionRepo: db, PtsClient: pts}
+	return testServer{
+		Server: handlers.Server{Log: log, SubscriptionService: subsvc, Idempotency: keys, V1Deprecation: v1Deprecation},
+		db:     db,
+		pts:    pts,
+		keys:   keys,
+	}
 }
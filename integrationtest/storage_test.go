@@ -0,0 +1,75 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/handlers"
+	"github.com/pmadhvi/telness-manager/memory"
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryServer returns a server storing subscriptions in memory, so the repository errors are real
+func memoryServer() handlers.Server {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	repo := memory.NewSubscriptionRepo()
+	pts := &mock.ClientMock{}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts is not reachable")
+	}
+	subsvc := service.SubscriptionSvc{Log: log, SubscriptionRepo: repo, PtsClient: pts}
+	return handlers.Server{Log: log, SubscriptionService: subsvc, Idempotency: repo, V1Deprecation: v1Deprecation}
+}
+
+func serve(s handlers.Server, method, url, body string, header map[string]string) (int, model.Problem) {
+	req, rw := routedRequest(method, url, []byte(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	s.Router().ServeHTTP(rw, req)
+	var problem model.Problem
+	json.NewDecoder(rw.Body).Decode(&problem)
+	return rw.Code, problem
+}
+
+func TestMemoryStorage_DuplicateCreate(t *testing.T) {
+	t.Parallel()
+	s := memoryServer()
+	body := fmt.Sprintf(`{"msisdn": "+46107500500", "activate_at": "%v", "sub_type": "pbx", "status": "pending"}`, importDate)
+
+	code, _ := serve(s, http.MethodPost, "/api/v2/subscriptions", body, nil)
+	assert.EqualValues(t, http.StatusCreated, code)
+	code, problem := serve(s, http.MethodPost, "/api/v2/subscriptions", body, nil)
+
+	assert.EqualValues(t, http.StatusConflict, code)
+	assert.EqualValues(t, apperr.CodeSubscriptionExists, problem.Code)
+}
+
+func TestMemoryStorage_VersionMismatch(t *testing.T) {
+	t.Parallel()
+	s := memoryServer()
+	body := fmt.Sprintf(`{"msisdn": "+46107500500", "activate_at": "%v", "sub_type": "pbx", "status": "pending"}`, importDate)
+	serve(s, http.MethodPost, "/api/v2/subscriptions", body, nil)
+
+	activation := fmt.Sprintf(`{"activate_at": "%v"}`, importDate)
+
+	code, _ := serve(s, http.MethodPut, "/api/v2/subscriptions/+46107500500/activation", activation, map[string]string{"If-Match": `"1"`})
+	assert.EqualValues(t, http.StatusOK, code)
+	code, problem := serve(s, http.MethodPut, "/api/v2/subscriptions/+46107500500/activation", activation, map[string]string{"If-Match": `"1"`})
+
+	assert.EqualValues(t, http.StatusPreconditionFailed, code)
+	assert.EqualValues(t, apperr.CodeVersionMismatch, problem.Code)
+}
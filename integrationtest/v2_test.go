@@ -0,0 +1,277 @@
+// +build integration
+
+package integrationtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// routedRequest is like requestResponse, but for requests sent through the router to the given url
+func routedRequest(method string, url string, requestBody []byte) (*http.Request, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, url, bytes.NewBuffer(requestBody))
+	rw := httptest.NewRecorder()
+	return req, rw
+}
+
+func TestV2FindSubscription(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/+46107500500", nil)
+	mockFindSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, `"1"`, rw.Header().Get("ETag"))
+	assert.Empty(t, rw.Header().Get("Deprecation"))
+	var resp model.Subscription
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "+46107500500", resp.Msisdn)
+}
+
+func TestV2ReplaceSubscription(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	body := []byte(`{"msisdn": "+46107500500", "activate_at": "2021-10-11", "sub_type": "pbx", "status": "paused", "version": 1}`)
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500", body)
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+	var updated model.CreateSubscription
+	server.db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, "pbx", updated.SubType)
+	assert.EqualValues(t, model.StatusPaused, updated.Status)
+	assert.EqualValues(t, 1, updated.ExpectedVersion)
+}
+
+func TestV2ReplaceSubscriptionMissingFields(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500", []byte(`{"sub_type": "pbx"}`))
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, apperr.CodeValidationFailed, resp.Code)
+	assert.Len(t, resp.Errors, 2)
+}
+
+func TestV2DeleteCancelsSubscription(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodDelete, "/api/v2/subscriptions/+46107500500", nil)
+	req.Header.Set("If-Match", "*")
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+	var updated model.CreateSubscription
+	server.db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, model.StatusCancelled, updated.Status)
+}
+
+func TestV2SetStatus(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/status", []byte(`{"status": "paused"}`))
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+	var updated model.CreateSubscription
+	server.db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, model.StatusPaused, updated.Status)
+}
+
+func TestV2SetStatusEmpty(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/status", []byte(`{}`))
+	req.Header.Set("If-Match", `"1"`)
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+	var resp model.Problem
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "/status", resp.Errors[0].Pointer)
+}
+
+func TestV2SetStatusValidateOnly(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/status?validate_only=true", []byte(`{"status": "paused"}`))
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	var resp model.Subscription
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, model.StatusPaused, resp.Status)
+	server.db.AssertNotCalled(t, "UpdateSubscription")
+}
+
+func TestV2PatchAndReplaceValidateOnly(t *testing.T) {
+	t.Parallel()
+	s := memoryServer()
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	code, _ := serve(s, http.MethodPost, "/api/v2/subscriptions", `{"msisdn": "+46107500514", "activate_at": "`+tomorrow+`", "sub_type": "pbx", "status": "pending"}`, nil)
+	assert.EqualValues(t, http.StatusCreated, code)
+	change := func(method, contentType, body string) model.Subscription {
+		req, rw := routedRequest(method, "/api/v2/subscriptions/+46107500514?validate_only=true", []byte(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("If-Match", `"1"`)
+		s.Router().ServeHTTP(rw, req)
+		assert.EqualValues(t, http.StatusOK, rw.Code, rw.Body.String())
+		var resp model.Subscription
+		assert.Nil(t, json.NewDecoder(rw.Body).Decode(&resp))
+		return resp
+	}
+
+	patched := change(http.MethodPatch, "application/merge-patch+json", `{"sub_type": "cell"}`)
+	replaced := change(http.MethodPut, "application/json", `{"activate_at": "`+tomorrow+`", "sub_type": "cell", "status": "cancelled"}`)
+
+	assert.EqualValues(t, "cell", patched.SubType)
+	assert.EqualValues(t, "cell", replaced.SubType)
+	assert.EqualValues(t, model.StatusCancelled, replaced.Status)
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/+46107500514", nil)
+	s.Router().ServeHTTP(rw, req)
+	var stored model.Subscription
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&stored))
+	assert.EqualValues(t, 1, stored.Version)
+	assert.EqualValues(t, "pbx", stored.SubType)
+	assert.EqualValues(t, model.StatusPending, stored.Status)
+}
+
+func TestV2SetStatusValidateOnlyInvalidTransition(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/status?validate_only=true", []byte(`{"status": "activated"}`))
+	req.Header.Set("If-Match", "*")
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "cancelled")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusConflict, rw.Code)
+	server.db.AssertNotCalled(t, "UpdateSubscription")
+}
+
+func TestV2SetActivationDateValidateOnlyPastDate(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/activation?validate_only=true", []byte(`{"activate_at": "2021-10-11"}`))
+	req.Header.Set("If-Match", "*")
+	mockUpdateSubscription(server, "+46107500500", "2021-10-11", "cell", "pending")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusUnprocessableEntity, rw.Code)
+	server.db.AssertNotCalled(t, "UpdateSubscription")
+}
+
+func TestV2CreateValidateOnly(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	body := []byte(`{"msisdn": "+46107500500", "activate_at": "` + tomorrow + `", "sub_type": "pbx", "status": "pending"}`)
+	req, rw := routedRequest(http.MethodPost, "/api/v2/subscriptions?validate_only=true", body)
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.Empty(t, rw.Header().Get("Location"))
+	var resp model.Subscription
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "pbx", resp.SubType)
+	server.db.AssertNotCalled(t, "CreateSubscription")
+
+	req, rw = routedRequest(http.MethodPost, "/api/v2/subscriptions?validate_only=true", body)
+	mockFindSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusConflict, rw.Code)
+	server.db.AssertNotCalled(t, "CreateSubscription")
+}
+
+func TestV2SetActivationDate(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	req, rw := routedRequest(http.MethodPut, "/api/v2/subscriptions/+46107500500/activation", []byte(`{"activate_at": "`+tomorrow+`"}`))
+	req.Header.Set("If-Match", `"1"`)
+	mockUpdateSubscription(server, "+46107500500", tomorrow, "cell", "pending")
+	var updated model.CreateSubscription
+	server.db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, tomorrow, updated.ActivateAt)
+}
+
+func TestV2GetActivationDate(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodGet, "/api/v2/subscriptions/+46107500500/activation", nil)
+	mockFindSubscription(server, "+46107500500", "2021-10-11T00:00:00Z", "cell", "pending")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	var resp model.ActivationChange
+	err := json.NewDecoder(rw.Body).Decode(&resp)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "2021-10-11", resp.ActivateAt)
+}
+
+func TestV1RouteIsDeprecated(t *testing.T) {
+	t.Parallel()
+	server := newServer()
+	req, rw := routedRequest(http.MethodGet, "/api/subscription/msisdn/+46107500500", nil)
+	mockFindSubscription(server, "+46107500500", "2021-10-11", "cell", "activated")
+
+	server.Router().ServeHTTP(rw, req)
+
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, "@1792281600", rw.Header().Get("Deprecation"))
+	assert.EqualValues(t, `</api/v2/subscriptions/+46107500500>; rel="successor-version"`, rw.Header().Get("Link"))
+}
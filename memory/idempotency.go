@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+type idempotencyKey struct {
+	response  model.IdempotentResponse
+	expiresAt time.Time
+}
+
+// ReserveIdempotencyKey stores the key for a request that is about to run and reports whether it
+// was reserved. When the key is already in use and not expired nothing is reserved, the stored
+// request hash and response, if the first request has finished, are returned instead.
+func (r *subscriptionRepo) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, now, expiresAt time.Time) (model.IdempotentResponse, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.idempotencyKeys[key]; ok && stored.expiresAt.After(now) {
+		return copyResponse(stored.response), false, nil
+	}
+	r.idempotencyKeys[key] = idempotencyKey{response: model.IdempotentResponse{RequestHash: requestHash}, expiresAt: expiresAt}
+	return model.IdempotentResponse{}, true, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request the key was reserved for
+func (r *subscriptionRepo) CompleteIdempotencyKey(ctx context.Context, key string, response model.IdempotentResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.idempotencyKeys[key]
+	if !ok {
+		return nil
+	}
+	response.RequestHash = stored.response.RequestHash
+	stored.response = copyResponse(response)
+	r.idempotencyKeys[key] = stored
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a reserved key whose request did not finish, so it can be retried
+func (r *subscriptionRepo) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.idempotencyKeys[key]; ok && stored.response.StatusCode == 0 {
+		delete(r.idempotencyKeys, key)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys which expired before now and returns how many
+func (r *subscriptionRepo) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for key, stored := range r.idempotencyKeys {
+		if !stored.expiresAt.After(now) {
+			delete(r.idempotencyKeys, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func copyResponse(response model.IdempotentResponse) model.IdempotentResponse {
+	if response.Body != nil {
+		response.Body = append([]byte(nil), response.Body...)
+	}
+	if response.Headers != nil {
+		headers := make(map[string]string, len(response.Headers))
+		for name, value := range response.Headers {
+			headers[name] = value
+		}
+		response.Headers = headers
+	}
+	return response
+}
@@ -0,0 +1,153 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+func (r *subscriptionRepo) ListSubscriptions(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subs, err := r.list(filter)
+	if err != nil {
+		return nil, err
+	}
+	return models(subs, filter.Limit), nil
+}
+
+// StreamSubscriptions calls fn for every subscription matching the filter, in the order of the
+// filter. The matching subscriptions are copied first, so fn may use the repository itself.
+// An error returned by fn stops the stream and is returned as it is.
+func (r *subscriptionRepo) StreamSubscriptions(ctx context.Context, filter model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	r.mu.Lock()
+	subs, err := r.list(filter)
+	var result []model.Subscription
+	if err == nil {
+		result = models(subs, filter.Limit)
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, sub := range result {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the subscriptions matching the filter, sorted by the sort field and msisdn
+func (r *subscriptionRepo) list(filter model.SubscriptionFilter) ([]*subscription, error) {
+	switch filter.Sort {
+	case model.SortByMsisdn, model.SortByActivateAt, model.SortByCreatedAt, model.SortByModifiedAt:
+	default:
+		return nil, fmt.Errorf("cannot sort by %q", filter.Sort)
+	}
+	desc := filter.Order == model.OrderDesc
+	var after *time.Time
+	if filter.After != nil && filter.Sort != model.SortByMsisdn {
+		value, err := time.Parse(time.RFC3339Nano, filter.After.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor value %q: %v", filter.After.Value, err)
+		}
+		after = &value
+	}
+
+	var subs []*subscription
+	for _, sub := range r.subs {
+		if matches(sub, filter) && (filter.After == nil || isAfter(sub, filter.Sort, after, filter.After.Msisdn, desc)) {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		c := compare(subs[i], subs[j], filter.Sort)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return subs, nil
+}
+
+func matches(sub *subscription, filter model.SubscriptionFilter) bool {
+	if len(filter.Status) > 0 && !containsStatus(filter.Status, sub.status) {
+		return false
+	}
+	if len(filter.SubType) > 0 && !containsString(filter.SubType, sub.subType) {
+		return false
+	}
+	if !filter.ActivateFrom.IsZero() && sub.activateAt.Before(filter.ActivateFrom) {
+		return false
+	}
+	if !filter.ActivateTo.IsZero() && !sub.activateAt.Before(filter.ActivateTo) {
+		return false
+	}
+	if !filter.CreatedFrom.IsZero() && sub.createdAt.Before(filter.CreatedFrom) {
+		return false
+	}
+	if !filter.CreatedTo.IsZero() && !sub.createdAt.Before(filter.CreatedTo) {
+		return false
+	}
+	return strings.HasPrefix(sub.msisdn, filter.MsisdnPrefix)
+}
+
+// isAfter reports whether sub comes after the cursor in the listing order
+func isAfter(sub *subscription, sortBy string, value *time.Time, msisdn string, desc bool) bool {
+	order := strings.Compare(sub.msisdn, msisdn)
+	if value != nil {
+		if c := compareTime(*sub.sortValue(sortBy), *value); c != 0 {
+			order = c
+		}
+	}
+	if desc {
+		return order < 0
+	}
+	return order > 0
+}
+
+// compare orders two subscriptions ascending by the sort field, ties are broken by msisdn
+func compare(a, b *subscription, sortBy string) int {
+	if sortBy != model.SortByMsisdn {
+		if c := compareTime(*a.sortValue(sortBy), *b.sortValue(sortBy)); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.msisdn, b.msisdn)
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func containsStatus(statuses []model.SubStatus, status model.SubStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
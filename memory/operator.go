@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// UpdateOperator stores the operator PTS answered with and when it was checked. A changed
+// operator is recorded as an operator change, so ported numbers can be reported later.
+func (r *subscriptionRepo) UpdateOperator(ctx context.Context, msisdn string, operator string, checkedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subs[msisdn]
+	if !ok {
+		return notFound(msisdn)
+	}
+	if sub.operator != "" && sub.operator != operator {
+		r.eventID++
+		r.operatorChanges = append(r.operatorChanges, event{id: r.eventID, msisdn: msisdn, from: sub.operator, operator: operator, detectedAt: checkedAt})
+	}
+	sub.operator, sub.operatorCheckedAt = operator, checkedAt
+	return nil
+}
+
+// FindSubscriptionsWithStaleOperator returns subscriptions, except cancelled ones, whose operator
+// was never checked or last checked before the given time
+func (r *subscriptionRepo) FindSubscriptionsWithStaleOperator(ctx context.Context, checkedBefore time.Time, limit int) ([]model.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stale []*subscription
+	for _, sub := range r.subs {
+		if sub.status != model.StatusCancelled && sub.operatorCheckedAt.Before(checkedBefore) {
+			stale = append(stale, sub)
+		}
+	}
+	// never checked has a zero time, so it sorts first like NULLS FIRST
+	sort.Slice(stale, func(i, j int) bool {
+		if !stale[i].operatorCheckedAt.Equal(stale[j].operatorCheckedAt) {
+			return stale[i].operatorCheckedAt.Before(stale[j].operatorCheckedAt)
+		}
+		return stale[i].msisdn < stale[j].msisdn
+	})
+	return models(stale, limit), nil
+}
+
+// RecordPortedOut stores a ported out event, unless the latest event of the number already
+// reports the same operator and the number has not changed operator since, e.g. ported back and
+// out again. It returns whether the event was recorded.
+func (r *subscriptionRepo) RecordPortedOut(ctx context.Context, portedOut model.PortabilityEvent, detectedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *event
+	for i := range r.portabilityEvents {
+		e := &r.portabilityEvents[i]
+		if e.msisdn == portedOut.Msisdn && (latest == nil || !e.detectedAt.Before(latest.detectedAt)) {
+			latest = e
+		}
+	}
+	if latest != nil && latest.operator == portedOut.Operator && !r.changedAfter(portedOut.Msisdn, latest.detectedAt) {
+		return false, nil
+	}
+	r.eventID++
+	r.portabilityEvents = append(r.portabilityEvents, event{id: r.eventID, msisdn: portedOut.Msisdn, from: portedOut.ExpectedOperator, operator: portedOut.Operator, detectedAt: detectedAt})
+	return true, nil
+}
+
+// changedAfter returns whether an operator change of the number was detected after the given time
+func (r *subscriptionRepo) changedAfter(msisdn string, detectedAt time.Time) bool {
+	for _, e := range r.operatorChanges {
+		if e.msisdn == msisdn && e.detectedAt.After(detectedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *subscriptionRepo) FindPortabilityEvents(ctx context.Context, from, to time.Time) ([]model.PortabilityEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	portabilityEvents := []model.PortabilityEvent{}
+	for _, e := range eventsBetween(r.portabilityEvents, from, to) {
+		portabilityEvents = append(portabilityEvents, model.PortabilityEvent{
+			ID:               e.id,
+			Msisdn:           e.msisdn,
+			ExpectedOperator: e.from,
+			Operator:         e.operator,
+			DetectedAt:       e.detectedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return portabilityEvents, nil
+}
+
+func (r *subscriptionRepo) FindOperatorChanges(ctx context.Context, from, to time.Time) ([]model.OperatorChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changes := []model.OperatorChange{}
+	for _, e := range eventsBetween(r.operatorChanges, from, to) {
+		changes = append(changes, model.OperatorChange{
+			ID:               e.id,
+			Msisdn:           e.msisdn,
+			PreviousOperator: e.from,
+			Operator:         e.operator,
+			DetectedAt:       e.detectedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	return changes, nil
+}
+
+// eventsBetween returns the events detected in [from, to), ordered by detection time and id
+func eventsBetween(events []event, from, to time.Time) []event {
+	var between []event
+	for _, e := range events {
+		if !e.detectedAt.Before(from) && e.detectedAt.Before(to) {
+			between = append(between, e)
+		}
+	}
+	sort.SliceStable(between, func(i, j int) bool {
+		return between[i].detectedAt.Before(between[j].detectedAt)
+	})
+	return between
+}
@@ -0,0 +1,302 @@
+// Package memory keeps subscriptions in memory instead of a database, so the service can run without
+// postgres, e.g. on a developer machine or in tests. Everything is lost when the process stops.
+// It behaves like the postgres repository: the same errors for missing and duplicate subscriptions,
+// the same version checks and the same history.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+const dateLayout = "2006-01-02"
+
+// subscription is a stored subscription, a zero operatorCheckedAt means it was never checked
+type subscription struct {
+	msisdn            string
+	activateAt        time.Time
+	subType           string
+	status            model.SubStatus
+	operator          string
+	operatorCheckedAt time.Time
+	createdAt         time.Time
+	modifiedAt        time.Time
+	version           int64
+}
+
+func (s *subscription) model() model.Subscription {
+	sub := model.Subscription{
+		Msisdn:     s.msisdn,
+		ActivateAt: formatTime(s.activateAt),
+		SubType:    s.subType,
+		Status:     s.status,
+		Operator:   s.operator,
+		CreatedAt:  formatTime(s.createdAt),
+		ModifiedAt: formatTime(s.modifiedAt),
+		Version:    s.version,
+	}
+	if !s.operatorCheckedAt.IsZero() {
+		sub.OperatorCheckedAt = formatTime(s.operatorCheckedAt)
+	}
+	return sub
+}
+
+// sortValue returns the time a subscription is sorted by, nil when it is sorted by msisdn only
+func (s *subscription) sortValue(sort string) *time.Time {
+	switch sort {
+	case model.SortByActivateAt:
+		return &s.activateAt
+	case model.SortByCreatedAt:
+		return &s.createdAt
+	case model.SortByModifiedAt:
+		return &s.modifiedAt
+	}
+	return nil
+}
+
+type historyEntry struct {
+	entry     model.SubscriptionHistory
+	changedAt time.Time
+}
+
+type event struct {
+	id         int64
+	msisdn     string
+	from       string
+	operator   string
+	detectedAt time.Time
+}
+
+type subscriptionRepo struct {
+	mu                sync.Mutex
+	subs              map[string]*subscription
+	history           map[string][]historyEntry
+	historyID         int64
+	operatorChanges   []event
+	portabilityEvents []event
+	eventID           int64
+	idempotencyKeys   map[string]idempotencyKey
+	now               func() time.Time
+}
+
+// NewSubscriptionRepo returns an empty repository. It is safe for concurrent use.
+func NewSubscriptionRepo() *subscriptionRepo {
+	return &subscriptionRepo{
+		subs:            map[string]*subscription{},
+		history:         map[string][]historyEntry{},
+		idempotencyKeys: map[string]idempotencyKey{},
+		now:             time.Now,
+	}
+}
+
+func (r *subscriptionRepo) CreateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(sub, r.now())
+}
+
+// CreateSubscriptions creates a batch of subscriptions and returns the error of every row, nil for
+// the rows created. With atomic nothing is created when a row fails, the rows after it are not tried.
+func (r *subscriptionRepo) CreateSubscriptions(ctx context.Context, subs []model.CreateSubscription, atomic bool) ([]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rowErrs := make([]error, len(subs))
+	now := r.now()
+	if atomic {
+		seen := map[string]bool{}
+		for i, sub := range subs {
+			_, exists := r.subs[sub.Msisdn]
+			if _, err := parseDate(sub.ActivateAt); err != nil {
+				rowErrs[i] = err
+			} else if exists || seen[sub.Msisdn] {
+				rowErrs[i] = alreadyExists(sub.Msisdn)
+			}
+			if rowErrs[i] != nil {
+				return rowErrs, nil
+			}
+			seen[sub.Msisdn] = true
+		}
+	}
+	for i, sub := range subs {
+		rowErrs[i] = r.create(sub, now)
+	}
+	return rowErrs, nil
+}
+
+func (r *subscriptionRepo) create(sub model.CreateSubscription, now time.Time) error {
+	if _, ok := r.subs[sub.Msisdn]; ok {
+		return alreadyExists(sub.Msisdn)
+	}
+	activateAt, err := parseDate(sub.ActivateAt)
+	if err != nil {
+		return err
+	}
+	r.subs[sub.Msisdn] = &subscription{
+		msisdn:     sub.Msisdn,
+		activateAt: activateAt,
+		subType:    sub.SubType,
+		status:     sub.Status,
+		createdAt:  now,
+		modifiedAt: now,
+		version:    1,
+	}
+	r.addHistory(sub.Msisdn, model.HistoryActionCreated, nil, stateOf(sub), sub.Actor, sub.Reason, now)
+	return nil
+}
+
+func (r *subscriptionRepo) FindSubscriptionbyID(ctx context.Context, msisdn string) (model.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub, ok := r.subs[msisdn]
+	if !ok {
+		return model.Subscription{}, notFound(msisdn)
+	}
+	return sub.model(), nil
+}
+
+func (r *subscriptionRepo) UpdateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.subs[sub.Msisdn]
+	if !ok {
+		return notFound(sub.Msisdn)
+	}
+	if sub.ExpectedVersion != 0 && sub.ExpectedVersion != stored.version {
+		return apperr.VersionMismatch(sub.Msisdn, sub.ExpectedVersion, stored.version)
+	}
+	activateAt, err := parseDate(sub.ActivateAt)
+	if err != nil {
+		return err
+	}
+	before := &model.SubscriptionState{
+		Msisdn:     stored.msisdn,
+		ActivateAt: stored.activateAt.Format(dateLayout),
+		SubType:    stored.subType,
+		Status:     stored.status,
+	}
+	now := r.now()
+	stored.activateAt, stored.subType, stored.status = activateAt, sub.SubType, sub.Status
+	stored.modifiedAt = now
+	stored.version++
+	r.addHistory(sub.Msisdn, model.HistoryActionUpdated, before, stateOf(sub), sub.Actor, sub.Reason, now)
+	return nil
+}
+
+func (r *subscriptionRepo) FindDuePendingSubscriptions(ctx context.Context, now time.Time, limit int) ([]model.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []*subscription
+	for _, sub := range r.subs {
+		if sub.status == model.StatusPending && !sub.activateAt.After(now) {
+			due = append(due, sub)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].activateAt.Equal(due[j].activateAt) {
+			return due[i].activateAt.Before(due[j].activateAt)
+		}
+		return due[i].msisdn < due[j].msisdn
+	})
+	return models(due, limit), nil
+}
+
+func (r *subscriptionRepo) addHistory(msisdn, action string, before, after *model.SubscriptionState, actor, reason string, changedAt time.Time) {
+	if actor == "" {
+		actor = "unknown"
+	}
+	r.historyID++
+	r.history[msisdn] = append(r.history[msisdn], historyEntry{
+		entry: model.SubscriptionHistory{
+			ID:        r.historyID,
+			Msisdn:    msisdn,
+			Action:    action,
+			Before:    before,
+			After:     after,
+			Actor:     actor,
+			Reason:    reason,
+			ChangedAt: changedAt.UTC().Format(time.RFC3339),
+		},
+		changedAt: changedAt,
+	})
+}
+
+func (r *subscriptionRepo) FindSubscriptionHistory(ctx context.Context, msisdn string, limit, offset int) ([]model.SubscriptionHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.history[msisdn]
+	history := []model.SubscriptionHistory{}
+	// entries are appended in order, so newest first is from the end
+	for i := len(entries) - 1 - offset; i >= 0 && len(history) < limit; i-- {
+		history = append(history, copyEntry(entries[i].entry))
+	}
+	return history, nil
+}
+
+// copyEntry copies the states of a history entry, so callers cannot change the stored history
+func copyEntry(entry model.SubscriptionHistory) model.SubscriptionHistory {
+	if entry.Before != nil {
+		before := *entry.Before
+		entry.Before = &before
+	}
+	if entry.After != nil {
+		after := *entry.After
+		entry.After = &after
+	}
+	return entry
+}
+
+// stateOf returns the history snapshot for the values in a create or update request
+func stateOf(sub model.CreateSubscription) *model.SubscriptionState {
+	state := &model.SubscriptionState{
+		Msisdn:     sub.Msisdn,
+		ActivateAt: sub.ActivateAt,
+		SubType:    sub.SubType,
+		Status:     sub.Status,
+	}
+	if activateAt, err := time.Parse(time.RFC3339, sub.ActivateAt); err == nil {
+		state.ActivateAt = activateAt.Format(dateLayout)
+	}
+	return state
+}
+
+func models(subs []*subscription, limit int) []model.Subscription {
+	if limit > 0 && len(subs) > limit {
+		subs = subs[:limit]
+	}
+	result := make([]model.Subscription, 0, len(subs))
+	for _, sub := range subs {
+		result = append(result, sub.model())
+	}
+	return result
+}
+
+// parseDate parses an activation date the way postgres does, a date or a RFC3339 timestamp
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse(dateLayout, value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid input syntax for type timestamp: %q", value)
+	}
+	return date.UTC(), nil
+}
+
+// formatTime formats stored times the way they are read from postgres
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func notFound(msisdn string) error {
+	return apperr.NotFound(apperr.CodeSubscriptionNotFound, nil, "subscription with msisdn %v not found", msisdn)
+}
+
+func alreadyExists(msisdn string) error {
+	return apperr.AlreadyExists(apperr.CodeSubscriptionExists, nil, "subscription with msisdn %v already exists", msisdn)
+}
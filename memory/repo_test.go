@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/repotest"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func newSub(msisdn string) model.CreateSubscription {
+	return model.CreateSubscription{Msisdn: msisdn, ActivateAt: "2027-01-01", SubType: "pbx", Status: model.StatusPending, Actor: "test"}
+}
+
+func TestRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) service.SubscriptionRepoInterface {
+		return NewSubscriptionRepo()
+	})
+}
+
+func TestUpdate_VersionMismatch(t *testing.T) {
+	repo := NewSubscriptionRepo()
+	repo.CreateSubscription(ctx, newSub("+46107500500"))
+	update := newSub("+46107500500")
+	update.Status = model.StatusActivated
+	update.ExpectedVersion = 1
+	assert.Nil(t, repo.UpdateSubscription(ctx, update))
+
+	err := repo.UpdateSubscription(ctx, update)
+
+	assert.EqualValues(t, apperr.CodeVersionMismatch, apperr.CodeOf(err))
+	sub, _ := repo.FindSubscriptionbyID(ctx, "+46107500500")
+	assert.EqualValues(t, 2, sub.Version)
+	history, _ := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+	assert.Len(t, history, 2)
+	assert.EqualValues(t, model.HistoryActionUpdated, history[0].Action)
+	assert.EqualValues(t, model.StatusPending, history[0].Before.Status)
+	assert.EqualValues(t, model.StatusActivated, history[0].After.Status)
+}
+
+func TestCreateSubscriptions_Atomic(t *testing.T) {
+	repo := NewSubscriptionRepo()
+	repo.CreateSubscription(ctx, newSub("+46107500501"))
+
+	rowErrs, err := repo.CreateSubscriptions(ctx, []model.CreateSubscription{newSub("+46107500500"), newSub("+46107500501")}, true)
+
+	assert.Nil(t, err)
+	assert.Nil(t, rowErrs[0])
+	assert.EqualValues(t, apperr.KindAlreadyExists, apperr.KindOf(rowErrs[1]))
+	_, err = repo.FindSubscriptionbyID(ctx, "+46107500500")
+	assert.EqualValues(t, apperr.KindNotFound, apperr.KindOf(err))
+}
+
+func TestListSubscriptions_Cursor(t *testing.T) {
+	repo := NewSubscriptionRepo()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo.now = func() time.Time { return now }
+	for _, msisdn := range []string{"+46107500502", "+46107500500", "+46107500501"} {
+		repo.CreateSubscription(ctx, newSub(msisdn))
+	}
+	filter := model.SubscriptionFilter{Sort: model.SortByCreatedAt, Order: model.OrderDesc, Limit: 2}
+
+	page, err := repo.ListSubscriptions(ctx, filter)
+	assert.Nil(t, err)
+	assert.Len(t, page, 2)
+	assert.EqualValues(t, "+46107500502", page[0].Msisdn)
+	last := page[1]
+	filter.After = &model.ListCursor{Value: last.SortValue(filter.Sort), Msisdn: last.Msisdn}
+	page, err = repo.ListSubscriptions(ctx, filter)
+
+	assert.Nil(t, err)
+	assert.Len(t, page, 1)
+	assert.EqualValues(t, "+46107500500", page[0].Msisdn)
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	repo := NewSubscriptionRepo()
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		created int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every msisdn is created by two goroutines, only one of them may succeed
+			if repo.CreateSubscription(ctx, newSub(fmt.Sprintf("+461075005%02d", i/2))) == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 25, created)
+}
+
+func TestLock(t *testing.T) {
+	lock := NewLock()
+	unlock, acquired, err := lock.TryLock(ctx)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	_, acquired, _ = lock.TryLock(ctx)
+	assert.False(t, acquired)
+
+	unlock()
+	_, acquired, _ = lock.TryLock(ctx)
+	assert.True(t, acquired)
+}
@@ -0,0 +1,43 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead_Ordered(t *testing.T) {
+	files := fstest.MapFS{
+		"m/0010_later.up.sql":   {Data: []byte("SELECT 10")},
+		"m/0010_later.down.sql": {Data: []byte("SELECT -10")},
+		"m/0002_first.up.sql":   {Data: []byte("SELECT 2")},
+		"m/0002_first.down.sql": {Data: []byte("SELECT -2")},
+	}
+	migrations, err := Read(files, "m")
+
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 2)
+	assert.EqualValues(t, 2, migrations[0].Version)
+	assert.EqualValues(t, "first", migrations[0].Name)
+	assert.EqualValues(t, "SELECT 2", migrations[0].Up)
+	assert.EqualValues(t, "SELECT -2", migrations[0].Down)
+	assert.EqualValues(t, 10, migrations[1].Version)
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {"m/0001_a.up.sql": {Data: []byte("SELECT 1")}},
+		"bad name":     {"m/a.up.sql": {Data: []byte("SELECT 1")}, "m/a.down.sql": {Data: []byte("SELECT 1")}},
+		"two names": {
+			"m/0001_a.up.sql":   {Data: []byte("SELECT 1")},
+			"m/0001_b.down.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Read(files, "m")
+			assert.NotNil(t, err)
+		})
+	}
+}
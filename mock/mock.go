@@ -1,30 +1,262 @@
+// Package mock has test doubles for the repositories, the PTS client and the background job
+// dependencies. Every mock is an instance of its own, so tests using them can run in parallel.
+// A mock records its calls, and a test scripts the answers it needs by setting the function
+// fields before the mock is used.
 package mock
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/memory"
 	"github.com/pmadhvi/telness-manager/model"
 )
 
-var (
+// repository is what an unscripted DbMock or IdempotencyMock method falls back to
+type repository interface {
+	CreateSubscription(ctx context.Context, sub model.CreateSubscription) error
+	CreateSubscriptions(ctx context.Context, subs []model.CreateSubscription, atomic bool) ([]error, error)
+	FindSubscriptionbyID(ctx context.Context, msisdn string) (model.Subscription, error)
+	UpdateSubscription(ctx context.Context, sub model.CreateSubscription) error
+	FindDuePendingSubscriptions(ctx context.Context, now time.Time, limit int) ([]model.Subscription, error)
+	FindSubscriptionHistory(ctx context.Context, msisdn string, limit, offset int) ([]model.SubscriptionHistory, error)
+	ListSubscriptions(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error)
+	StreamSubscriptions(ctx context.Context, filter model.SubscriptionFilter, fn func(model.Subscription) error) error
+	UpdateOperator(ctx context.Context, msisdn string, operator string, checkedAt time.Time) error
+	FindSubscriptionsWithStaleOperator(ctx context.Context, checkedBefore time.Time, limit int) ([]model.Subscription, error)
+	RecordPortedOut(ctx context.Context, event model.PortabilityEvent, detectedAt time.Time) (bool, error)
+	FindPortabilityEvents(ctx context.Context, from, to time.Time) ([]model.PortabilityEvent, error)
+	FindOperatorChanges(ctx context.Context, from, to time.Time) ([]model.OperatorChange, error)
+	ReserveIdempotencyKey(ctx context.Context, key, requestHash string, now, expiresAt time.Time) (model.IdempotentResponse, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, response model.IdempotentResponse) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
+
+// fallback lazily creates the in-memory repository of a mock, so the zero value of a mock is usable
+type fallback struct {
+	once sync.Once
+	repo repository
+}
+
+func (f *fallback) memory() repository {
+	f.once.Do(func() {
+		f.repo = memory.NewSubscriptionRepo()
+	})
+	return f.repo
+}
+
+// DbMock is a subscription repository. A method whose function is set answers with it, the others
+// answer from an in-memory repository, so a test only scripts what it is about and an unscripted
+// DbMock behaves like a real, empty repository.
+type DbMock struct {
+	Recorder
+	fallback
+
 	FindByID    func(msisdn string) (model.Subscription, error)
 	Create      func(sub model.CreateSubscription) error
+	CreateBatch func(subs []model.CreateSubscription, atomic bool) ([]error, error)
 	Update      func(sub model.CreateSubscription) error
+	FindDue     func(now time.Time, limit int) ([]model.Subscription, error)
+	FindHistory func(msisdn string, limit, offset int) ([]model.SubscriptionHistory, error)
+	// List also answers StreamSubscriptions when it is set
+	List        func(filter model.SubscriptionFilter) ([]model.Subscription, error)
+	SetOperator func(msisdn string, operator string, checkedAt time.Time) error
+	FindStale   func(checkedBefore time.Time, limit int) ([]model.Subscription, error)
+	PortedOut   func(event model.PortabilityEvent, detectedAt time.Time) (bool, error)
+	FindPorted  func(from, to time.Time) ([]model.PortabilityEvent, error)
+	FindChanges func(from, to time.Time) ([]model.OperatorChange, error)
+}
+
+func (m *DbMock) CreateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	m.record("CreateSubscription", sub)
+	if m.Create != nil {
+		return m.Create(sub)
+	}
+	return m.memory().CreateSubscription(ctx, sub)
+}
+
+func (m *DbMock) CreateSubscriptions(ctx context.Context, subs []model.CreateSubscription, atomic bool) ([]error, error) {
+	m.record("CreateSubscriptions", subs, atomic)
+	if m.CreateBatch != nil {
+		return m.CreateBatch(subs, atomic)
+	}
+	return m.memory().CreateSubscriptions(ctx, subs, atomic)
+}
+
+func (m *DbMock) FindSubscriptionbyID(ctx context.Context, msisdn string) (model.Subscription, error) {
+	m.record("FindSubscriptionbyID", msisdn)
+	if m.FindByID != nil {
+		return m.FindByID(msisdn)
+	}
+	return m.memory().FindSubscriptionbyID(ctx, msisdn)
+}
+
+func (m *DbMock) UpdateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	m.record("UpdateSubscription", sub)
+	if m.Update != nil {
+		return m.Update(sub)
+	}
+	return m.memory().UpdateSubscription(ctx, sub)
+}
+
+func (m *DbMock) FindDuePendingSubscriptions(ctx context.Context, now time.Time, limit int) ([]model.Subscription, error) {
+	m.record("FindDuePendingSubscriptions", now, limit)
+	if m.FindDue != nil {
+		return m.FindDue(now, limit)
+	}
+	return m.memory().FindDuePendingSubscriptions(ctx, now, limit)
+}
+
+func (m *DbMock) FindSubscriptionHistory(ctx context.Context, msisdn string, limit, offset int) ([]model.SubscriptionHistory, error) {
+	m.record("FindSubscriptionHistory", msisdn, limit, offset)
+	if m.FindHistory != nil {
+		return m.FindHistory(msisdn, limit, offset)
+	}
+	return m.memory().FindSubscriptionHistory(ctx, msisdn, limit, offset)
+}
+
+func (m *DbMock) ListSubscriptions(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+	m.record("ListSubscriptions", filter)
+	if m.List != nil {
+		return m.List(filter)
+	}
+	return m.memory().ListSubscriptions(ctx, filter)
+}
+
+func (m *DbMock) StreamSubscriptions(ctx context.Context, filter model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	m.record("StreamSubscriptions", filter)
+	if m.List == nil {
+		return m.memory().StreamSubscriptions(ctx, filter, fn)
+	}
+	subs, err := m.List(filter)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DbMock) UpdateOperator(ctx context.Context, msisdn string, operator string, checkedAt time.Time) error {
+	m.record("UpdateOperator", msisdn, operator, checkedAt)
+	if m.SetOperator != nil {
+		return m.SetOperator(msisdn, operator, checkedAt)
+	}
+	return m.memory().UpdateOperator(ctx, msisdn, operator, checkedAt)
+}
+
+func (m *DbMock) FindSubscriptionsWithStaleOperator(ctx context.Context, checkedBefore time.Time, limit int) ([]model.Subscription, error) {
+	m.record("FindSubscriptionsWithStaleOperator", checkedBefore, limit)
+	if m.FindStale != nil {
+		return m.FindStale(checkedBefore, limit)
+	}
+	return m.memory().FindSubscriptionsWithStaleOperator(ctx, checkedBefore, limit)
+}
+
+func (m *DbMock) RecordPortedOut(ctx context.Context, event model.PortabilityEvent, detectedAt time.Time) (bool, error) {
+	m.record("RecordPortedOut", event, detectedAt)
+	if m.PortedOut != nil {
+		return m.PortedOut(event, detectedAt)
+	}
+	return m.memory().RecordPortedOut(ctx, event, detectedAt)
+}
+
+func (m *DbMock) FindPortabilityEvents(ctx context.Context, from, to time.Time) ([]model.PortabilityEvent, error) {
+	m.record("FindPortabilityEvents", from, to)
+	if m.FindPorted != nil {
+		return m.FindPorted(from, to)
+	}
+	return m.memory().FindPortabilityEvents(ctx, from, to)
+}
+
+func (m *DbMock) FindOperatorChanges(ctx context.Context, from, to time.Time) ([]model.OperatorChange, error) {
+	m.record("FindOperatorChanges", from, to)
+	if m.FindChanges != nil {
+		return m.FindChanges(from, to)
+	}
+	return m.memory().FindOperatorChanges(ctx, from, to)
+}
+
+// ClientMock is a PTS client. Without GetOperator every lookup fails as if PTS cannot be reached.
+type ClientMock struct {
+	Recorder
+
 	GetOperator func(msisdn string) (model.PtsResponse, error)
-)
+}
 
-type DbMock struct{}
+func (c *ClientMock) GetOperatorDetails(ctx context.Context, msisdn string) (model.PtsResponse, error) {
+	c.record("GetOperatorDetails", msisdn)
+	if c.GetOperator == nil {
+		return model.PtsResponse{}, fmt.Errorf("mock: no operator scripted for msisdn %v", msisdn)
+	}
+	return c.GetOperator(msisdn)
+}
+
+// LockMock is a lock for the background jobs. Without Acquire it is always acquired.
+type LockMock struct {
+	Recorder
 
-func (m DbMock) CreateSubscription(sub model.CreateSubscription) error {
-	return Create(sub)
+	Acquire func() (func(), bool, error)
 }
-func (m DbMock) FindSubscriptionbyID(msisdn string) (model.Subscription, error) {
-	return FindByID(msisdn)
+
+func (l *LockMock) TryLock(ctx context.Context) (func(), bool, error) {
+	l.record("TryLock")
+	if l.Acquire == nil {
+		return func() {}, true, nil
+	}
+	return l.Acquire()
 }
-func (m DbMock) UpdateSubscription(sub model.CreateSubscription) error {
-	return Update(sub)
+
+// NotifierMock is told about ported out numbers. Without Notify every notification succeeds.
+type NotifierMock struct {
+	Recorder
+
+	Notify func(event model.PortabilityEvent) error
+}
+
+func (n *NotifierMock) NotifyPortedOut(ctx context.Context, event model.PortabilityEvent) error {
+	n.record("NotifyPortedOut", event)
+	if n.Notify == nil {
+		return nil
+	}
+	return n.Notify(event)
 }
 
-type ClientMock struct{}
+// IdempotencyMock is an idempotency key store. Unscripted methods answer from an in-memory store.
+type IdempotencyMock struct {
+	Recorder
+	fallback
+
+	ReserveKey  func(key, requestHash string, now, expiresAt time.Time) (model.IdempotentResponse, bool, error)
+	CompleteKey func(key string, response model.IdempotentResponse) error
+	ReleaseKey  func(key string) error
+}
+
+func (i *IdempotencyMock) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, now, expiresAt time.Time) (model.IdempotentResponse, bool, error) {
+	i.record("ReserveIdempotencyKey", key, requestHash, now, expiresAt)
+	if i.ReserveKey != nil {
+		return i.ReserveKey(key, requestHash, now, expiresAt)
+	}
+	return i.memory().ReserveIdempotencyKey(ctx, key, requestHash, now, expiresAt)
+}
+
+func (i *IdempotencyMock) CompleteIdempotencyKey(ctx context.Context, key string, response model.IdempotentResponse) error {
+	i.record("CompleteIdempotencyKey", key, response)
+	if i.CompleteKey != nil {
+		return i.CompleteKey(key, response)
+	}
+	return i.memory().CompleteIdempotencyKey(ctx, key, response)
+}
 
-func (c ClientMock) GetOperatorDetails(msisdn string) (model.PtsResponse, error) {
-	return GetOperator(msisdn)
+func (i *IdempotencyMock) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	i.record("ReleaseIdempotencyKey", key)
+	if i.ReleaseKey != nil {
+		return i.ReleaseKey(key)
+	}
+	return i.memory().ReleaseIdempotencyKey(ctx, key)
 }
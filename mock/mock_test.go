@@ -0,0 +1,67 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/repotest"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+// an unscripted DbMock must behave like a real repository
+func TestDbMock_Repo(t *testing.T) {
+	t.Parallel()
+	repotest.Run(t, func(t *testing.T) service.SubscriptionRepoInterface {
+		return &DbMock{}
+	})
+}
+
+func TestDbMock_ScriptedAndRecorded(t *testing.T) {
+	t.Parallel()
+	db := &DbMock{}
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{}, errors.New("db is down")
+	}
+
+	_, err := db.FindSubscriptionbyID(ctx, "+46107500500")
+
+	assert.EqualError(t, err, "db is down")
+	assert.True(t, db.AssertCalled(t, "FindSubscriptionbyID", "+46107500500"))
+	assert.True(t, db.AssertCallCount(t, "FindSubscriptionbyID", 1))
+	assert.True(t, db.AssertNotCalled(t, "UpdateSubscription"))
+}
+
+func TestRecorder_Assertions(t *testing.T) {
+	t.Parallel()
+	pts := &ClientMock{}
+	pts.GetOperatorDetails(ctx, "+46107500500")
+	failing := &fakeT{}
+
+	assert.False(t, pts.AssertCalled(failing, "GetOperatorDetails", "+46107500501"))
+	assert.False(t, pts.AssertNotCalled(failing, "GetOperatorDetails"))
+	assert.False(t, pts.AssertCallCount(failing, "GetOperatorDetails", 2))
+	assert.EqualValues(t, 3, failing.errors)
+	assert.EqualValues(t, []Call{{Method: "GetOperatorDetails", Args: []interface{}{"+46107500500"}}}, pts.Calls(""))
+}
+
+func TestClientMock_Unscripted(t *testing.T) {
+	t.Parallel()
+	_, err := (&ClientMock{}).GetOperatorDetails(ctx, "+46107500500")
+
+	assert.EqualError(t, err, "mock: no operator scripted for msisdn +46107500500")
+}
+
+type fakeT struct {
+	errors int
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors++
+}
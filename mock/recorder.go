@@ -0,0 +1,89 @@
+package mock
+
+import (
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Call is one recorded call of a mock method, Args are its arguments without the context
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// TestingT is the part of *testing.T the assertion helpers use
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Recorder records the calls made to a mock. It is safe for concurrent use.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (r *Recorder) record(method string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the calls of method in the order they were made, every call when method is empty
+func (r *Recorder) Calls(method string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls []Call
+	for _, call := range r.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// CallCount returns how often method was called
+func (r *Recorder) CallCount(method string) int {
+	return len(r.Calls(method))
+}
+
+// AssertCalled checks that method was called, with exactly args when they are given
+func (r *Recorder) AssertCalled(t TestingT, method string, args ...interface{}) bool {
+	t.Helper()
+	calls := r.Calls(method)
+	if len(args) == 0 && len(calls) > 0 {
+		return true
+	}
+	for _, call := range calls {
+		if assert.ObjectsAreEqual(args, call.Args) {
+			return true
+		}
+	}
+	if len(args) == 0 {
+		t.Errorf("%v was not called", method)
+	} else {
+		t.Errorf("%v was not called with %v, calls: %v", method, args, calls)
+	}
+	return false
+}
+
+// AssertNotCalled checks that method was never called
+func (r *Recorder) AssertNotCalled(t TestingT, method string) bool {
+	t.Helper()
+	if calls := r.Calls(method); len(calls) > 0 {
+		t.Errorf("%v was called %d times, calls: %v", method, len(calls), calls)
+		return false
+	}
+	return true
+}
+
+// AssertCallCount checks that method was called count times
+func (r *Recorder) AssertCallCount(t TestingT, method string, count int) bool {
+	t.Helper()
+	if calls := r.Calls(method); len(calls) != count {
+		t.Errorf("%v was called %d times, not %d", method, len(calls), count)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	SortByMsisdn     = "msisdn"
+	SortByActivateAt = "activate_at"
+	SortByCreatedAt  = "created_at"
+	SortByModifiedAt = "modified_at"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// SortFields lists the fields subscriptions can be sorted by
+var SortFields = []string{SortByMsisdn, SortByActivateAt, SortByCreatedAt, SortByModifiedAt}
+
+// SubscriptionFilter represents the criteria to list subscriptions by, zero values are not filtered on
+type SubscriptionFilter struct {
+	Status       []SubStatus
+	SubType      []string
+	ActivateFrom time.Time
+	ActivateTo   time.Time
+	CreatedFrom  time.Time
+	CreatedTo    time.Time
+	MsisdnPrefix string
+	Sort         string
+	Order        string
+	Limit        int
+	// After continues the listing after the subscription the cursor points at
+	After *ListCursor
+}
+
+// SubscriptionPage represents one page of listed subscriptions
+type SubscriptionPage struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+// ListCursor points at the last subscription of a page. Msisdn breaks ties between equal sort values,
+// so the listing stays stable while rows are added.
+type ListCursor struct {
+	Sort   string `json:"s"`
+	Order  string `json:"o"`
+	Value  string `json:"v"`
+	Msisdn string `json:"m"`
+}
+
+// Encode returns the cursor as an opaque string to hand out to clients
+func (c ListCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor returned by Encode
+func DecodeCursor(cursor string) (ListCursor, error) {
+	var c ListCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ListCursor{}, errors.New("cursor is not valid")
+	}
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.Msisdn == "" {
+		return ListCursor{}, errors.New("cursor is not valid")
+	}
+	return c, nil
+}
+
+// SortValue returns the value of the given sort field for the subscription
+func (s Subscription) SortValue(sort string) string {
+	switch sort {
+	case SortByActivateAt:
+		return s.ActivateAt
+	case SortByCreatedAt:
+		return s.CreatedAt
+	case SortByModifiedAt:
+		return s.ModifiedAt
+	}
+	return s.Msisdn
+}
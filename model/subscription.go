@@ -9,27 +9,229 @@ const (
 	StatusCancelled SubStatus = "cancelled"
 )
 
+// Operator statuses tell whether the operator of a subscription is confirmed by PTS,
+// the last known one from storage or unknown. OperatorCheckedAt is when PTS last confirmed it.
+const (
+	OperatorStatusOK      = "ok"
+	OperatorStatusStale   = "stale"
+	OperatorStatusUnknown = "unknown"
+)
+
 // Subscription represents all data for a phone subscription
 type Subscription struct {
+	Msisdn            string    `json:"msisdn"`
+	ActivateAt        string    `json:"activate_at"`
+	SubType           string    `json:"sub_type"`
+	Status            SubStatus `json:"status"`
+	Operator          string    `json:"operator"`
+	OperatorStatus    string    `json:"operator_status,omitempty"`
+	OperatorCheckedAt string    `json:"operator_checked_at,omitempty"`
+	CreatedAt         string    `json:"created_at"`
+	ModifiedAt        string    `json:"modified_at"`
+	Version           int64     `json:"version"`
+}
+
+// CreateSubscription represents all data for a phone subscription create request
+type CreateSubscription struct {
 	Msisdn     string    `json:"msisdn"`
 	ActivateAt string    `json:"activate_at"`
 	SubType    string    `json:"sub_type"`
 	Status     SubStatus `json:"status"`
-	Operator   string    `json:"operator"`
-	CreatedAt  string    `json:"created_at"`
-	ModifiedAt string    `json:"modified_at"`
+	// Actor and Reason are recorded in the subscription history, they are not part of the request body
+	Actor  string `json:"-"`
+	Reason string `json:"-"`
+	// ExpectedVersion makes the update fail when the stored version differs, zero updates any version
+	ExpectedVersion int64 `json:"-"`
+	// ValidateOnly checks the change against the stored subscription without making it
+	ValidateOnly bool `json:"-"`
 }
 
-// CreateSubscription represents all data for a phone subscription create request
-type CreateSubscription struct {
+// StatusChange is the request body to change the status of a subscription
+type StatusChange struct {
+	Status SubStatus `json:"status"`
+}
+
+// ActivationChange is the request body to change the activation date of a pending subscription
+type ActivationChange struct {
+	ActivateAt string `json:"activate_at"`
+}
+
+// SubscriptionState represents the values of a subscription recorded in its history
+type SubscriptionState struct {
 	Msisdn     string    `json:"msisdn"`
 	ActivateAt string    `json:"activate_at"`
 	SubType    string    `json:"sub_type"`
 	Status     SubStatus `json:"status"`
 }
 
-type ErrorMessage struct {
-	Message string `json:"message"`
+// SubscriptionHistory represents one change made to a subscription
+type SubscriptionHistory struct {
+	ID        int64              `json:"id"`
+	Msisdn    string             `json:"msisdn"`
+	Action    string             `json:"action"`
+	Before    *SubscriptionState `json:"before"`
+	After     *SubscriptionState `json:"after"`
+	Actor     string             `json:"actor"`
+	Reason    string             `json:"reason"`
+	ChangedAt string             `json:"changed_at"`
+}
+
+// HistoryPage represents one page of the subscription timeline, newest change first
+type HistoryPage struct {
+	Msisdn  string                `json:"msisdn"`
+	History []SubscriptionHistory `json:"history"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+	HasMore bool                  `json:"has_more"`
+}
+
+const (
+	HistoryActionCreated = "created"
+	HistoryActionUpdated = "updated"
+)
+
+// StatusTransitions represents the subscription status state machine
+type StatusTransitions struct {
+	Transitions map[SubStatus][]SubStatus `json:"transitions"`
+	Terminal    []SubStatus               `json:"terminal"`
+}
+
+// AllowedTransitions represents the statuses a single subscription can move to right now
+type AllowedTransitions struct {
+	Msisdn  string      `json:"msisdn"`
+	Status  SubStatus   `json:"status"`
+	Allowed []SubStatus `json:"allowed"`
+}
+
+// SchedulerStatus represents what the activation scheduler has done so far
+type SchedulerStatus struct {
+	Running              bool     `json:"running"`
+	Interval             string   `json:"interval"`
+	Runs                 int      `json:"runs"`
+	SkippedRuns          int      `json:"skipped_runs"`
+	LastRunAt            string   `json:"last_run_at,omitempty"`
+	LastActivated        int      `json:"last_activated"`
+	LastError            string   `json:"last_error,omitempty"`
+	TotalActivated       int      `json:"total_activated"`
+	TotalFailed          int      `json:"total_failed"`
+	LastActivatedMsisdns []string `json:"last_activated_msisdns"`
+}
+
+// PtsCacheStats represents the counters of the PTS operator lookup cache
+type PtsCacheStats struct {
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negative_hits"`
+	Misses       uint64 `json:"misses"`
+	SharedCalls  uint64 `json:"shared_calls"`
+	Entries      int    `json:"entries"`
+	TTL          string `json:"ttl"`
+	NegativeTTL  string `json:"negative_ttl"`
+}
+
+// PtsBreakerStats represents the state of the PTS circuit breaker
+type PtsBreakerStats struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	Rejected            uint64 `json:"rejected"`
+	Threshold           int    `json:"threshold"`
+	Cooldown            string `json:"cooldown"`
+	OpenedAt            string `json:"opened_at,omitempty"`
+}
+
+// JobStatus represents what a background job has done so far
+type JobStatus struct {
+	Running        bool   `json:"running"`
+	Interval       string `json:"interval"`
+	Runs           int    `json:"runs"`
+	SkippedRuns    int    `json:"skipped_runs"`
+	LastRunAt      string `json:"last_run_at,omitempty"`
+	LastProcessed  int    `json:"last_processed"`
+	LastError      string `json:"last_error,omitempty"`
+	TotalProcessed int    `json:"total_processed"`
+	TotalFailed    int    `json:"total_failed"`
+}
+
+// OperatorChange represents a number found ported from one operator to another
+type OperatorChange struct {
+	ID               int64  `json:"id"`
+	Msisdn           string `json:"msisdn"`
+	PreviousOperator string `json:"previous_operator"`
+	Operator         string `json:"operator"`
+	DetectedAt       string `json:"detected_at"`
+}
+
+// PortabilityEvent represents an active subscription found ported away from the expected operator
+type PortabilityEvent struct {
+	ID               int64  `json:"id"`
+	Msisdn           string `json:"msisdn"`
+	ExpectedOperator string `json:"expected_operator"`
+	Operator         string `json:"operator"`
+	DetectedAt       string `json:"detected_at"`
+}
+
+// PortabilityReport represents the ported out numbers and operator changes detected in a time window
+type PortabilityReport struct {
+	From            string             `json:"from"`
+	To              string             `json:"to"`
+	PortedOut       []PortabilityEvent `json:"ported_out"`
+	OperatorChanges []OperatorChange   `json:"operator_changes"`
+}
+
+// Statuses of a row of an import
+const (
+	ImportRowCreated = "created"
+	ImportRowValid   = "valid"
+	ImportRowInvalid = "invalid"
+	ImportRowFailed  = "failed"
+	ImportRowSkipped = "skipped"
+)
+
+// ImportResult reports what happened to every row of a bulk import
+type ImportResult struct {
+	ValidateOnly bool        `json:"validate_only"`
+	Atomic       bool        `json:"atomic"`
+	Total        int         `json:"total"`
+	Created      int         `json:"created"`
+	Failed       int         `json:"failed"`
+	Rows         []ImportRow `json:"rows"`
+}
+
+// ImportRow is the result of one row of an import, Row counts the data rows from 1
+type ImportRow struct {
+	Row    int            `json:"row"`
+	Msisdn string         `json:"msisdn"`
+	Status string         `json:"status"`
+	Code   string         `json:"code,omitempty"`
+	Detail string         `json:"detail,omitempty"`
+	Errors []ProblemField `json:"errors,omitempty"`
+}
+
+// IdempotentResponse is the stored response of a request sent with an Idempotency-Key header,
+// it is replayed when the request is retried. StatusCode is zero while the first request is running.
+type IdempotentResponse struct {
+	RequestHash string
+	StatusCode  int
+	ContentType string
+	// Headers are the response headers which are replayed besides Content-Type, e.g. ETag
+	Headers map[string]string
+	Body    []byte
+}
+
+// Problem is the body of every error response, an RFC 7807 problem details object.
+// Code is a stable machine readable error code, see package apperr.
+type Problem struct {
+	Type   string         `json:"type"`
+	Title  string         `json:"title"`
+	Status int            `json:"status"`
+	Detail string         `json:"detail"`
+	Code   string         `json:"code"`
+	Errors []ProblemField `json:"errors,omitempty"`
+}
+
+// ProblemField is one invalid field of a request, Pointer is a JSON pointer to it in the request body
+type ProblemField struct {
+	Pointer string `json:"pointer"`
+	Detail  string `json:"detail"`
 }
 
 type PtsResponse struct {
@@ -37,7 +239,7 @@ type PtsResponse struct {
 }
 
 type OperatorDetails struct {
-	Type   string `json: "__type"`
+	Type   string `json:"__type"`
 	Name   string `json:"Name"`
 	Number string `json:"Number"`
 }
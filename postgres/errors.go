@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/lib/pq"
+	"github.com/pmadhvi/telness-manager/apperr"
+)
+
+// uniqueViolation is the postgres error code for a duplicate key
+const uniqueViolation = "23505"
+
+// translateError turns an error from a query on the subscription with given msisdn into a
+// domain error. Errors without a domain meaning are returned as they are.
+func translateError(err error, msisdn string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NotFound(apperr.CodeSubscriptionNotFound, err, "subscription with msisdn %v not found", msisdn)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return apperr.AlreadyExists(apperr.CodeSubscriptionExists, err, "subscription with msisdn %v already exists", msisdn)
+	}
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		return apperr.UpstreamUnavailable(apperr.CodeDatabaseUnavailable, err, "database is unavailable")
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// exportFetchSize is how many rows are fetched from the export cursor at a time
+const exportFetchSize = 500
+
+// StreamSubscriptions calls fn for every subscription matching the filter, in the order of the
+// filter. The rows are read through a server side cursor in a read only transaction,
+// exportFetchSize at a time, so memory use does not grow with the number of subscriptions.
+// An error returned by fn stops the stream and is returned as it is.
+func (sr subscriptionRepo) StreamSubscriptions(ctx context.Context, filter model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		sr.log.Errorf("could not build export query: %v", err)
+		return err
+	}
+	tx, err := sr.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return translateError(err, "")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DECLARE export_cursor NO SCROLL CURSOR FOR `+query, args...); err != nil {
+		sr.log.Errorf("could not declare export cursor: %v", err)
+		return translateError(err, "")
+	}
+	fetch := fmt.Sprintf(`FETCH %d FROM export_cursor`, exportFetchSize)
+	for {
+		fetched, err := sr.fetchExport(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if fetched < exportFetchSize {
+			break
+		}
+	}
+	return tx.Commit()
+}
+
+// fetchExport fetches the next rows of the export cursor and returns how many there were
+func (sr subscriptionRepo) fetchExport(ctx context.Context, tx *sql.Tx, fetch string, fn func(model.Subscription) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		sr.log.Errorf("could not fetch exported subscriptions: %v", err)
+		return 0, translateError(err, "")
+	}
+	defer rows.Close()
+	fetched := 0
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			sr.log.Errorf("could not scan exported subscription: %v", err)
+			return fetched, err
+		}
+		fetched++
+		if err := fn(sub); err != nil {
+			return fetched, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fetched, translateError(err, "")
+	}
+	return fetched, nil
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+const dateLayout = "2006-01-02"
+
+// stateOf returns the history snapshot for the values in a create or update request
+func stateOf(sub model.CreateSubscription) *model.SubscriptionState {
+	state := &model.SubscriptionState{
+		Msisdn:     sub.Msisdn,
+		ActivateAt: sub.ActivateAt,
+		SubType:    sub.SubType,
+		Status:     sub.Status,
+	}
+	// store dates the same way whether they came from a client or the database
+	if activateAt, err := time.Parse(time.RFC3339, sub.ActivateAt); err == nil {
+		state.ActivateAt = activateAt.Format(dateLayout)
+	}
+	return state
+}
+
+// insertHistory appends a change to the subscription history, it must run in the same
+// transaction as the change itself
+func insertHistory(ctx context.Context, tx *sql.Tx, msisdn, action string, before, after *model.SubscriptionState, actor, reason string, changedAt time.Time) error {
+	var beforeJSON []byte
+	if before != nil {
+		var err error
+		beforeJSON, err = json.Marshal(before)
+		if err != nil {
+			return err
+		}
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	if actor == "" {
+		actor = "unknown"
+	}
+	query := `INSERT INTO subscription_history(msisdn, action, before, after, actor, reason, changed_at)
+	VALUES($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.ExecContext(ctx, query, msisdn, action, nullableJSON(beforeJSON), afterJSON, actor, reason, changedAt)
+	return err
+}
+
+func (sr subscriptionRepo) FindSubscriptionHistory(ctx context.Context, msisdn string, limit, offset int) ([]model.SubscriptionHistory, error) {
+	query := `SELECT id, msisdn, action, before, after, actor, reason, changed_at FROM subscription_history
+	WHERE msisdn = $1
+	ORDER BY changed_at DESC, id DESC
+	LIMIT $2 OFFSET $3`
+	rows, err := sr.db.QueryContext(ctx, query, msisdn, limit, offset)
+	if err != nil {
+		sr.log.Errorf("could not query subscription history: %v", err)
+		return nil, translateError(err, msisdn)
+	}
+	defer rows.Close()
+	history := []model.SubscriptionHistory{}
+	for rows.Next() {
+		var (
+			entry      model.SubscriptionHistory
+			beforeJSON []byte
+			afterJSON  []byte
+			changedAt  time.Time
+		)
+		err := rows.Scan(&entry.ID, &entry.Msisdn, &entry.Action, &beforeJSON, &afterJSON, &entry.Actor, &entry.Reason, &changedAt)
+		if err != nil {
+			sr.log.Errorf("could not scan subscription history: %v", err)
+			return nil, err
+		}
+		if beforeJSON != nil {
+			entry.Before = &model.SubscriptionState{}
+			if err := json.Unmarshal(beforeJSON, entry.Before); err != nil {
+				return nil, err
+			}
+		}
+		entry.After = &model.SubscriptionState{}
+		if err := json.Unmarshal(afterJSON, entry.After); err != nil {
+			return nil, err
+		}
+		entry.ChangedAt = changedAt.Format(time.RFC3339)
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+func nullableJSON(data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// ReserveIdempotencyKey stores the key for a request that is about to run and reports whether it
+// was reserved. When the key is already in use and not expired nothing is reserved, the stored
+// request hash and response, if the first request has finished, are returned instead.
+func (sr subscriptionRepo) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, now, expiresAt time.Time) (model.IdempotentResponse, bool, error) {
+	// an expired key is taken over as if it was never used
+	query := `INSERT INTO idempotency_key(key, request_hash, created_at, expires_at)
+	VALUES($1, $2, $3, $4)
+	ON CONFLICT (key) DO UPDATE
+		SET (request_hash, status_code, content_type, headers, response, created_at, expires_at) = ($2, NULL, NULL, NULL, NULL, $3, $4)
+		WHERE idempotency_key.expires_at <= $3`
+	result, err := sr.db.ExecContext(ctx, query, key, requestHash, now, expiresAt)
+	if err != nil {
+		sr.log.Errorf("could not reserve the idempotency key in db: %v", err)
+		return model.IdempotentResponse{}, false, translateError(err, "")
+	}
+	reserved, err := result.RowsAffected()
+	if err != nil {
+		return model.IdempotentResponse{}, false, err
+	}
+	if reserved == 1 {
+		return model.IdempotentResponse{}, true, nil
+	}
+
+	var (
+		stored      model.IdempotentResponse
+		statusCode  sql.NullInt64
+		contentType sql.NullString
+		headers     []byte
+	)
+	query = `SELECT request_hash, status_code, content_type, headers, response FROM idempotency_key
+	WHERE key = $1`
+	err = sr.db.QueryRowContext(ctx, query, key).Scan(&stored.RequestHash, &statusCode, &contentType, &headers, &stored.Body)
+	if err != nil {
+		sr.log.Errorf("could not find the idempotency key in db: %v", err)
+		return model.IdempotentResponse{}, false, translateError(err, "")
+	}
+	stored.StatusCode = int(statusCode.Int64)
+	stored.ContentType = contentType.String
+	if headers != nil {
+		if err := json.Unmarshal(headers, &stored.Headers); err != nil {
+			sr.log.Errorf("could not decode the stored response headers: %v", err)
+			return model.IdempotentResponse{}, false, err
+		}
+	}
+	return stored, false, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request the key was reserved for
+func (sr subscriptionRepo) CompleteIdempotencyKey(ctx context.Context, key string, response model.IdempotentResponse) error {
+	headers, err := json.Marshal(response.Headers)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE idempotency_key
+		SET (status_code, content_type, headers, response) = ($1, $2, $3, $4)
+		WHERE key = $5`
+	_, err = sr.db.ExecContext(ctx, query, response.StatusCode, response.ContentType, headers, response.Body, key)
+	if err != nil {
+		sr.log.Errorf("could not store the idempotent response in db: %v", err)
+		return translateError(err, "")
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a reserved key whose request did not finish, so it can be retried
+func (sr subscriptionRepo) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	query := `DELETE FROM idempotency_key
+	WHERE key = $1 AND status_code IS NULL`
+	_, err := sr.db.ExecContext(ctx, query, key)
+	if err != nil {
+		sr.log.Errorf("could not release the idempotency key in db: %v", err)
+		return translateError(err, "")
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes the keys which expired before now and returns how many
+func (sr subscriptionRepo) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM idempotency_key
+	WHERE expires_at <= $1`
+	result, err := sr.db.ExecContext(ctx, query, now)
+	if err != nil {
+		sr.log.Errorf("could not delete expired idempotency keys in db: %v", err)
+		return 0, translateError(err, "")
+	}
+	return result.RowsAffected()
+}
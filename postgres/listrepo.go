@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// sortColumns maps the allowed sort fields to their column, so user input never ends up in the query
+var sortColumns = map[string]string{
+	model.SortByMsisdn:     "msisdn",
+	model.SortByActivateAt: "activate_at",
+	model.SortByCreatedAt:  "created_at",
+	model.SortByModifiedAt: "modified_at",
+}
+
+func (sr subscriptionRepo) ListSubscriptions(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		sr.log.Errorf("could not build list query: %v", err)
+		return nil, err
+	}
+	rows, err := sr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		sr.log.Errorf("could not list subscriptions: %v", err)
+		return nil, translateError(err, "")
+	}
+	defer rows.Close()
+	subs := []model.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			sr.log.Errorf("could not scan listed subscription: %v", err)
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// listQuery builds the query and its arguments for the filter, sorted by the sort column and msisdn
+func listQuery(filter model.SubscriptionFilter) (string, []interface{}, error) {
+	column, ok := sortColumns[filter.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("cannot sort by %q", filter.Sort)
+	}
+	direction, compare := "ASC", ">"
+	if filter.Order == model.OrderDesc {
+		direction, compare = "DESC", "<"
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if len(filter.Status) > 0 {
+		placeholders := make([]string, len(filter.Status))
+		for i, status := range filter.Status {
+			placeholders[i] = arg(status)
+		}
+		where = append(where, fmt.Sprintf("status IN (%s)", strings.Join(placeholders, ", ")))
+	}
+	if len(filter.SubType) > 0 {
+		placeholders := make([]string, len(filter.SubType))
+		for i, subType := range filter.SubType {
+			placeholders[i] = arg(subType)
+		}
+		where = append(where, fmt.Sprintf("sub_type IN (%s)", strings.Join(placeholders, ", ")))
+	}
+	if !filter.ActivateFrom.IsZero() {
+		where = append(where, "activate_at >= "+arg(filter.ActivateFrom))
+	}
+	if !filter.ActivateTo.IsZero() {
+		where = append(where, "activate_at < "+arg(filter.ActivateTo))
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		where = append(where, "created_at < "+arg(filter.CreatedTo))
+	}
+	if filter.MsisdnPrefix != "" {
+		where = append(where, "msisdn LIKE "+arg(escapeLike(filter.MsisdnPrefix)+"%"))
+	}
+	if filter.After != nil {
+		if column == "msisdn" {
+			where = append(where, fmt.Sprintf("msisdn %s %s", compare, arg(filter.After.Msisdn)))
+		} else {
+			where = append(where, fmt.Sprintf("(%s, msisdn) %s (%s::timestamp, %s)", column, compare, arg(filter.After.Value), arg(filter.After.Msisdn)))
+		}
+	}
+
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription`
+	if len(where) > 0 {
+		query += "\n\tWHERE " + strings.Join(where, " AND ")
+	}
+	if column == "msisdn" {
+		query += fmt.Sprintf("\n\tORDER BY msisdn %s", direction)
+	} else {
+		query += fmt.Sprintf("\n\tORDER BY %s %s, msisdn %s", column, direction, direction)
+	}
+	if filter.Limit > 0 {
+		query += "\n\tLIMIT " + arg(filter.Limit)
+	}
+	return query, args, nil
+}
+
+// escapeLike escapes the LIKE wildcards so a prefix only matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
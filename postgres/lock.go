@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Advisory lock keys taken by the background jobs
+const (
+	ActivationLockKey      int64 = 74600001
+	OperatorRefreshLockKey int64 = 74600002
+	PortabilityLockKey     int64 = 74600003
+)
+
+type advisoryLock struct {
+	db  *sql.DB
+	key int64
+	log *log.Logger
+}
+
+// NewAdvisoryLock returns a lock backed by a postgres session level advisory lock,
+// so only one replica at a time holds it
+func NewAdvisoryLock(db *sql.DB, log *log.Logger, key int64) *advisoryLock {
+	return &advisoryLock{
+		db:  db,
+		key: key,
+		log: log,
+	}
+}
+
+func (l advisoryLock) TryLock(ctx context.Context) (func(), bool, error) {
+	// advisory locks belong to a session, so lock and unlock must use the same connection
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		l.log.Errorf("could not get db connection for advisory lock: %v", err)
+		return nil, false, err
+	}
+	var acquired bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&acquired)
+	if err != nil {
+		l.log.Errorf("could not take advisory lock %v: %v", l.key, err)
+		conn.Close()
+		return nil, false, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+	unlock := func() {
+		// unlock even when ctx is done, otherwise the lock stays with the pooled connection
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, l.key)
+		if err != nil {
+			l.log.Errorf("could not release advisory lock %v: %v", l.key, err)
+		}
+		conn.Close()
+	}
+	return unlock, true, nil
+}
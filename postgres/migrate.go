@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/migrate"
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrationLockKey is the advisory lock key held while migrating, so replicas starting at the same
+// time run the migrations once, one after another
+const MigrationLockKey int64 = 74600004
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations returns the migrations embedded from postgres/migrations, ordered by version
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Read(migrationFiles, "migrations")
+}
+
+type migrator struct {
+	db         *sql.DB
+	log        *log.Logger
+	migrations []migrate.Migration
+}
+
+// NewMigrator returns a migrator for the embedded migrations. Every migration runs in its own
+// transaction, together with recording it in the schema_migrations table.
+func NewMigrator(db *sql.DB, log *log.Logger) (*migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, log: log, migrations: migrations}, nil
+}
+
+// Up applies every migration which is not applied yet, in order, and returns how many it applied
+func (m migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			m.log.Infof("applying migration %d_%v", migration.Version, migration.Name)
+			err := m.run(ctx, conn, migration.Up, `INSERT INTO schema_migrations(version, name, applied_at) VALUES($1, $2, $3)`,
+				migration.Version, migration.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("could not apply migration %d_%v: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns how many it reverted
+func (m migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			m.log.Infof("reverting migration %d_%v", migration.Version, migration.Name)
+			err := m.run(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("could not revert migration %d_%v: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status returns every migration with when it was applied
+func (m migrator) Status(ctx context.Context) ([]migrate.State, error) {
+	var states []migrate.State
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]time.Time) error {
+		for _, migration := range m.migrations {
+			states = append(states, migrate.State{Version: migration.Version, Name: migration.Name, AppliedAt: done[migration.Version]})
+		}
+		return nil
+	})
+	return states, err
+}
+
+// locked runs fn holding the migration lock, with the versions applied so far. The lock is waited
+// for, so a replica starting while another one migrates continues once the schema is up to date.
+func (m migrator) locked(ctx context.Context, fn func(conn *sql.Conn, done map[int64]time.Time) error) error {
+	// advisory locks belong to a session, so lock, migrations and unlock must use the same connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		m.log.Errorf("could not get db connection for migrating: %v", err)
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, MigrationLockKey); err != nil {
+		m.log.Errorf("could not take migration lock: %v", err)
+		return err
+	}
+	defer func() {
+		// unlock even when ctx is done, otherwise the lock stays with the pooled connection
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, MigrationLockKey); err != nil {
+			m.log.Errorf("could not release migration lock: %v", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations(
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`)
+	if err != nil {
+		m.log.Errorf("could not create schema_migrations table: %v", err)
+		return err
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		m.log.Errorf("could not read applied migrations: %v", err)
+		return err
+	}
+	defer rows.Close()
+	done := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return err
+		}
+		done[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	for version := range done {
+		if !m.known(version) {
+			m.log.Warnf("database has migration %d applied which this build does not know, it is newer than this build", version)
+		}
+	}
+	return fn(conn, done)
+}
+
+// run executes a migration and records it in one transaction
+func (m migrator) run(ctx context.Context, conn *sql.Conn, migration string, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
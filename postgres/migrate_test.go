@@ -0,0 +1,21 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations_Embedded(t *testing.T) {
+	migrations, err := Migrations()
+
+	assert.Nil(t, err)
+	assert.NotEmpty(t, migrations)
+	for i, migration := range migrations {
+		// versions are consecutive, so two branches adding the same version cannot both be merged unnoticed
+		assert.EqualValues(t, i+1, migration.Version)
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+	assert.EqualValues(t, "create_subscription", migrations[0].Name)
+}
@@ -6,4 +6,5 @@ CREATE TABLE IF NOT EXISTS subscription(
     created_at TIMESTAMP NOT NULL,
     modified_at TIMESTAMP NOT NULL,
     PRIMARY KEY (msisdn)
-);
\ No newline at end of file
+);
+CREATE INDEX IF NOT EXISTS subscription_status_activate_at_idx ON subscription (status, activate_at);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS subscription_history(
+    id BIGSERIAL PRIMARY KEY,
+    msisdn VARCHAR(12) NOT NULL REFERENCES subscription(msisdn),
+    action VARCHAR(20) NOT NULL,
+    before JSONB,
+    after JSONB NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS subscription_history_msisdn_changed_at_idx ON subscription_history (msisdn, changed_at DESC, id DESC);
+
+-- history is append-only, rows can never be changed or removed
+CREATE OR REPLACE FUNCTION subscription_history_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'subscription_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS subscription_history_append_only ON subscription_history;
+CREATE TRIGGER subscription_history_append_only
+    BEFORE UPDATE OR DELETE ON subscription_history
+    FOR EACH ROW EXECUTE PROCEDURE subscription_history_append_only();
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS subscription_created_at_idx;
+DROP INDEX IF EXISTS subscription_activate_at_idx;
+DROP INDEX IF EXISTS subscription_modified_at_idx;
+DROP INDEX IF EXISTS subscription_sub_type_idx;
+DROP INDEX IF EXISTS subscription_msisdn_prefix_idx;
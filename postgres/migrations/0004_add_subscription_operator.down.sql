@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS subscription_operator_checked_at_idx;
+ALTER TABLE subscription DROP COLUMN IF EXISTS operator_checked_at;
+ALTER TABLE subscription DROP COLUMN IF EXISTS operator;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS operator_change(
+    id BIGSERIAL PRIMARY KEY,
+    msisdn VARCHAR(12) NOT NULL REFERENCES subscription(msisdn),
+    previous_operator VARCHAR(100) NOT NULL,
+    operator VARCHAR(100) NOT NULL,
+    detected_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS operator_change_detected_at_idx ON operator_change (detected_at, id);
+
+CREATE TABLE IF NOT EXISTS portability_event(
+    id BIGSERIAL PRIMARY KEY,
+    msisdn VARCHAR(12) NOT NULL REFERENCES subscription(msisdn),
+    expected_operator VARCHAR(100) NOT NULL,
+    operator VARCHAR(100) NOT NULL,
+    detected_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS portability_event_detected_at_idx ON portability_event (detected_at, id);
+CREATE INDEX IF NOT EXISTS portability_event_msisdn_idx ON portability_event (msisdn, detected_at DESC, id DESC);
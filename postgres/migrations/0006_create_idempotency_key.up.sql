@@ -0,0 +1,12 @@
+-- requests sent with an Idempotency-Key header, a null status_code means the first request is still running
+CREATE TABLE IF NOT EXISTS idempotency_key(
+    key VARCHAR(255) PRIMARY KEY,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER,
+    content_type VARCHAR(100),
+    response BYTEA,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_expires_at_idx ON idempotency_key (expires_at);
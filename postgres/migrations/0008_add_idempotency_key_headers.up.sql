@@ -0,0 +1,2 @@
+-- response headers replayed with the stored response, e.g. ETag and Location
+ALTER TABLE idempotency_key ADD COLUMN IF NOT EXISTS headers JSONB;
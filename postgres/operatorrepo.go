@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// UpdateOperator stores the operator PTS answered with and when it was checked. A changed
+// operator is recorded as an operator change, so ported numbers can be reported later.
+func (sr subscriptionRepo) UpdateOperator(ctx context.Context, msisdn string, operator string, checkedAt time.Time) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return translateError(err, msisdn)
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullString
+	query := `SELECT operator FROM subscription
+	WHERE msisdn = $1
+	FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, msisdn).Scan(&previous)
+	if err != nil {
+		sr.log.Errorf("could not find the operator to update in db: %v", err)
+		return translateError(err, msisdn)
+	}
+
+	query = `UPDATE subscription
+		SET (operator, operator_checked_at) = ($1, $2)
+		WHERE msisdn = $3`
+	_, err = tx.ExecContext(ctx, query, operator, checkedAt, msisdn)
+	if err != nil {
+		sr.log.Errorf("could not update the operator in db: %v", err)
+		return err
+	}
+
+	if previous.Valid && previous.String != "" && previous.String != operator {
+		query = `INSERT INTO operator_change(msisdn, previous_operator, operator, detected_at)
+		VALUES($1, $2, $3, $4)`
+		_, err = tx.ExecContext(ctx, query, msisdn, previous.String, operator, checkedAt)
+		if err != nil {
+			sr.log.Errorf("could not insert the operator change in db: %v", err)
+			return err
+		}
+		sr.log.Infof("subscription with msisdn %v is ported from %v to %v", msisdn, previous.String, operator)
+	}
+	return tx.Commit()
+}
+
+// FindSubscriptionsWithStaleOperator returns subscriptions, except cancelled ones, whose operator
+// was never checked or last checked before the given time
+func (sr subscriptionRepo) FindSubscriptionsWithStaleOperator(ctx context.Context, checkedBefore time.Time, limit int) ([]model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription
+	WHERE status <> $1 AND (operator_checked_at IS NULL OR operator_checked_at < $2)
+	ORDER BY operator_checked_at NULLS FIRST, msisdn
+	LIMIT $3`
+	rows, err := sr.db.QueryContext(ctx, query, model.StatusCancelled, checkedBefore, limit)
+	if err != nil {
+		sr.log.Errorf("could not query subscriptions with stale operator: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []model.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			sr.log.Errorf("could not scan subscription with stale operator: %v", err)
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// RecordPortedOut stores a ported out event, unless the latest event of the number already
+// reports the same operator and the number has not changed operator since, e.g. ported back and
+// out again. It returns whether the event was recorded.
+func (sr subscriptionRepo) RecordPortedOut(ctx context.Context, event model.PortabilityEvent, detectedAt time.Time) (bool, error) {
+	query := `INSERT INTO portability_event(msisdn, expected_operator, operator, detected_at)
+	SELECT $1, $2, $3, $4
+	WHERE NOT EXISTS (
+		SELECT 1 FROM (
+			SELECT operator, detected_at FROM portability_event
+			WHERE msisdn = $1
+			ORDER BY detected_at DESC, id DESC
+			LIMIT 1
+		) latest
+		WHERE latest.operator = $3
+		AND NOT EXISTS (
+			SELECT 1 FROM operator_change
+			WHERE msisdn = $1 AND detected_at > latest.detected_at
+		)
+	)`
+	result, err := sr.db.ExecContext(ctx, query, event.Msisdn, event.ExpectedOperator, event.Operator, detectedAt)
+	if err != nil {
+		sr.log.Errorf("could not insert the portability event in db: %v", err)
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return inserted == 1, nil
+}
+
+func (sr subscriptionRepo) FindPortabilityEvents(ctx context.Context, from, to time.Time) ([]model.PortabilityEvent, error) {
+	query := `SELECT id, msisdn, expected_operator, operator, detected_at FROM portability_event
+	WHERE detected_at >= $1 AND detected_at < $2
+	ORDER BY detected_at, id`
+	rows, err := sr.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		sr.log.Errorf("could not query portability events: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	events := []model.PortabilityEvent{}
+	for rows.Next() {
+		var (
+			event      model.PortabilityEvent
+			detectedAt time.Time
+		)
+		err := rows.Scan(&event.ID, &event.Msisdn, &event.ExpectedOperator, &event.Operator, &detectedAt)
+		if err != nil {
+			sr.log.Errorf("could not scan portability event: %v", err)
+			return nil, err
+		}
+		event.DetectedAt = detectedAt.Format(time.RFC3339)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (sr subscriptionRepo) FindOperatorChanges(ctx context.Context, from, to time.Time) ([]model.OperatorChange, error) {
+	query := `SELECT id, msisdn, previous_operator, operator, detected_at FROM operator_change
+	WHERE detected_at >= $1 AND detected_at < $2
+	ORDER BY detected_at, id`
+	rows, err := sr.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		sr.log.Errorf("could not query operator changes: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	changes := []model.OperatorChange{}
+	for rows.Next() {
+		var (
+			change     model.OperatorChange
+			detectedAt time.Time
+		)
+		err := rows.Scan(&change.ID, &change.Msisdn, &change.PreviousOperator, &change.Operator, &detectedAt)
+		if err != nil {
+			sr.log.Errorf("could not scan operator change: %v", err)
+			return nil, err
+		}
+		change.DetectedAt = detectedAt.Format(time.RFC3339)
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
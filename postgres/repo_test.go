@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/repotest"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/sirupsen/logrus"
+)
+
+// TestRepo runs the repository behaviour tests against the postgres database at POSTGRES_TEST_URL.
+// Its tables are emptied before every test, so never point it at a database with data to keep.
+func TestRepo(t *testing.T) {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL is not set, e.g. postgres://postgres@localhost:5432/telness_test?sslmode=disable")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	migrator, err := NewMigrator(db, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("could not migrate test database: %v", err)
+	}
+
+	repotest.Run(t, func(t *testing.T) service.SubscriptionRepoInterface {
+		// truncate does not fire the append-only trigger of the history
+		_, err := db.Exec(`TRUNCATE subscription_history, operator_change, portability_event, idempotency_key, subscription`)
+		if err != nil {
+			t.Fatalf("could not empty test database: %v", err)
+		}
+		return NewSubscriptionRepo(db, log)
+	})
+}
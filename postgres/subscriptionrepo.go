@@ -1,13 +1,22 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
+	"github.com/pmadhvi/telness-manager/apperr"
 	"github.com/pmadhvi/telness-manager/model"
 	log "github.com/sirupsen/logrus"
 )
 
+// subscriptionColumns are the columns scanSubscription reads, in order
+const subscriptionColumns = `msisdn, activate_at, sub_type, status, COALESCE(operator, ''), operator_checked_at, created_at, modified_at, version`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type subscriptionRepo struct {
 	db  *sql.DB
 	log *log.Logger
@@ -20,40 +29,118 @@ func NewSubscriptionRepo(db *sql.DB, log *log.Logger) *subscriptionRepo {
 	}
 }
 
-func (sr subscriptionRepo) CreateSubscription(sub model.CreateSubscription) error {
+func scanSubscription(row scanner) (model.Subscription, error) {
+	var (
+		sub               model.Subscription
+		operatorCheckedAt sql.NullTime
+	)
+	err := row.Scan(&sub.Msisdn, &sub.ActivateAt, &sub.SubType, &sub.Status, &sub.Operator, &operatorCheckedAt, &sub.CreatedAt, &sub.ModifiedAt, &sub.Version)
+	if operatorCheckedAt.Valid {
+		sub.OperatorCheckedAt = operatorCheckedAt.Time.Format(time.RFC3339Nano)
+	}
+	return sub, err
+}
+
+func (sr subscriptionRepo) CreateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
 	query := `INSERT INTO subscription(msisdn, activate_at, sub_type, status, created_at, modified_at)
 	VALUES($1, $2, $3, $4, $5, $6)`
-	_, err := sr.db.Exec(query, sub.Msisdn, sub.ActivateAt, sub.SubType, sub.Status, time.Now(), time.Now())
+	_, err = tx.ExecContext(ctx, query, sub.Msisdn, sub.ActivateAt, sub.SubType, sub.Status, now, now)
 	if err != nil {
 		sr.log.Errorf("could not insert the data in db: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	err = insertHistory(ctx, tx, sub.Msisdn, model.HistoryActionCreated, nil, stateOf(sub), sub.Actor, sub.Reason, now)
+	if err != nil {
+		sr.log.Errorf("could not insert the history in db: %v", err)
 		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
-func (sr subscriptionRepo) FindSubscriptionbyID(msisdn string) (model.Subscription, error) {
-	query := `SELECT * FROM subscription
+func (sr subscriptionRepo) FindSubscriptionbyID(ctx context.Context, msisdn string) (model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription
 	WHERE msisdn = $1`
-	var sub model.Subscription
-	row := sr.db.QueryRow(query, msisdn)
-	err := row.Scan(&sub.Msisdn, &sub.ActivateAt, &sub.SubType, &sub.Status, &sub.CreatedAt, &sub.ModifiedAt)
-	if err != nil || err == sql.ErrNoRows {
-		sr.log.Errorf("No rows were returned! %v", err)
-		return model.Subscription{}, err
+	row := sr.db.QueryRowContext(ctx, query, msisdn)
+	sub, err := scanSubscription(row)
+	if err != nil {
+		sr.log.Errorf("could not find subscription with msisdn %v: %v", msisdn, err)
+		return model.Subscription{}, translateError(err, msisdn)
 	}
 	return sub, nil
 }
 
-func (sr subscriptionRepo) UpdateSubscription(sub model.CreateSubscription) error {
-	query := `UPDATE subscription
+func (sr subscriptionRepo) UpdateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	defer tx.Rollback()
+
+	// lock the row so the recorded before values are the ones being overwritten
+	before := model.SubscriptionState{Msisdn: sub.Msisdn}
+	var (
+		activateAt time.Time
+		version    int64
+	)
+	query := `SELECT activate_at, sub_type, status, version FROM subscription
+	WHERE msisdn = $1
+	FOR UPDATE`
+	err = tx.QueryRowContext(ctx, query, sub.Msisdn).Scan(&activateAt, &before.SubType, &before.Status, &version)
+	if err != nil {
+		sr.log.Errorf("could not find the data to update in db: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	if sub.ExpectedVersion != 0 && sub.ExpectedVersion != version {
+		return apperr.VersionMismatch(sub.Msisdn, sub.ExpectedVersion, version)
+	}
+	before.ActivateAt = activateAt.Format(dateLayout)
+
+	now := time.Now()
+	query = `UPDATE subscription
 		SET 
-		(activate_at, sub_type, status, modified_at) = ($1, $2, $3, $4)
+		(activate_at, sub_type, status, modified_at, version) = ($1, $2, $3, $4, version + 1)
 		WHERE msisdn = $5`
-	_, err := sr.db.Exec(query, sub.ActivateAt, sub.SubType, sub.Status, time.Now(), sub.Msisdn)
+	_, err = tx.ExecContext(ctx, query, sub.ActivateAt, sub.SubType, sub.Status, now, sub.Msisdn)
 	if err != nil {
 		sr.log.Errorf("could not update the data in db: %v", err)
 		return err
 	}
+	err = insertHistory(ctx, tx, sub.Msisdn, model.HistoryActionUpdated, &before, stateOf(sub), sub.Actor, sub.Reason, now)
+	if err != nil {
+		sr.log.Errorf("could not insert the history in db: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
 
-	return nil
+func (sr subscriptionRepo) FindDuePendingSubscriptions(ctx context.Context, now time.Time, limit int) ([]model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription
+	WHERE status = $1 AND activate_at <= $2
+	ORDER BY activate_at, msisdn
+	LIMIT $3`
+	rows, err := sr.db.QueryContext(ctx, query, model.StatusPending, now, limit)
+	if err != nil {
+		sr.log.Errorf("could not query due pending subscriptions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var subs []model.Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			sr.log.Errorf("could not scan due pending subscription: %v", err)
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
 }
@@ -0,0 +1,192 @@
+// Package ptsfake is a stand-in for the PTS number service. It answers SearchByNumber the way
+// api.pts.se does from a dataset of numbers, so development and tests do not depend on PTS, and it
+// can be made slow or broken on purpose to see how its callers cope.
+package ptsfake
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// Path is the path of SearchByNumber at PTS, PTS_HOST points at it
+const Path = "/PTSNumberService/Pts_Number_Service.svc/json/SearchByNumber"
+
+// OperatorMissing is the name PTS answers with for a number without operator
+const OperatorMissing = "Operatör saknas"
+
+//go:embed dataset.json
+var defaultDataset []byte
+
+// Faults make a Server misbehave. Rates are between 0 and 1, e.g. 0.1 fails one in ten requests.
+type Faults struct {
+	// Latency is added to every answer
+	Latency time.Duration
+	// ErrorRate is the share of requests answered with ErrorStatus
+	ErrorRate float64
+	// ErrorStatus is the status of failed requests, by default 503
+	ErrorStatus int
+	// MalformedRate is the share of requests answered with a body which is not valid json
+	MalformedRate float64
+}
+
+// Server answers SearchByNumber requests. It is safe for concurrent use.
+type Server struct {
+	mu        sync.Mutex
+	operators map[string]string
+	faults    Faults
+	failNext  []int
+	rand      *rand.Rand
+	requested []string
+}
+
+// New returns a server knowing the operators of the numbers in operators, numbers may be written
+// as +46107500500, 0107500500 or 010-7500500. Other numbers have no operator.
+func New(operators map[string]string) *Server {
+	s := &Server{
+		operators: map[string]string{},
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for number, operator := range operators {
+		s.operators[normalize(number)] = operator
+	}
+	return s
+}
+
+// Default returns a server with the numbers used in the examples and tests of this repository
+func Default() *Server {
+	operators, err := LoadDataset(bytes.NewReader(defaultDataset))
+	if err != nil {
+		panic(fmt.Sprintf("ptsfake: invalid embedded dataset: %v", err))
+	}
+	return New(operators)
+}
+
+// LoadDataset reads a dataset of the form {"+46107500500": "Telness AB"}
+func LoadDataset(r io.Reader) (map[string]string, error) {
+	var operators map[string]string
+	if err := json.NewDecoder(r).Decode(&operators); err != nil {
+		return nil, fmt.Errorf("could not decode dataset: %w", err)
+	}
+	return operators, nil
+}
+
+// SetOperator adds a number to the dataset or changes its operator, e.g. to port it
+func (s *Server) SetOperator(number, operator string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operators[normalize(number)] = operator
+}
+
+// SetFaults changes how the server misbehaves from the next request on
+func (s *Server) SetFaults(faults Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = faults
+}
+
+// FailNext answers the next requests with the given statuses, one status per request, before the
+// faults set by SetFaults apply again
+func (s *Server) FailNext(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext = append(s.failNext, statuses...)
+}
+
+// Requested returns the Number parameter of every request in the order they were received
+func (s *Server) Requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requested...)
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != Path {
+		http.NotFound(rw, req)
+		return
+	}
+	if req.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	number := req.URL.Query().Get("Number")
+	answer := s.answer(number)
+
+	if answer.latency > 0 {
+		select {
+		case <-time.After(answer.latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	switch {
+	case answer.status != 0:
+		// PTS fails with an html page, not with json
+		rw.Header().Set("Content-Type", "text/html")
+		rw.WriteHeader(answer.status)
+		fmt.Fprintf(rw, "<html><body><h1>%d %v</h1></body></html>", answer.status, http.StatusText(answer.status))
+	case answer.malformed:
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		io.WriteString(rw, `{"d":{"Name":"Telness`)
+	case number == "":
+		http.Error(rw, "Number is required", http.StatusBadRequest)
+	default:
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(rw).Encode(model.PtsResponse{D: model.OperatorDetails{Name: answer.operator, Number: number}})
+	}
+}
+
+// answer is how one request is answered
+type answer struct {
+	latency   time.Duration
+	status    int
+	malformed bool
+	operator  string
+}
+
+func (s *Server) answer(number string) answer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requested = append(s.requested, number)
+
+	a := answer{latency: s.faults.Latency, operator: OperatorMissing}
+	if operator, ok := s.operators[normalize(number)]; ok {
+		a.operator = operator
+	}
+	switch {
+	case len(s.failNext) > 0:
+		a.status = s.failNext[0]
+		s.failNext = s.failNext[1:]
+	case s.faults.ErrorRate > 0 && s.rand.Float64() < s.faults.ErrorRate:
+		a.status = s.faults.ErrorStatus
+		if a.status == 0 {
+			a.status = http.StatusServiceUnavailable
+		}
+	case s.faults.MalformedRate > 0 && s.rand.Float64() < s.faults.MalformedRate:
+		a.malformed = true
+	}
+	return a
+}
+
+// normalize turns the ways a swedish number is written into its national digits, e.g. 0107500500
+func normalize(number string) string {
+	number = strings.TrimSpace(number)
+	if strings.HasPrefix(number, "+46") {
+		number = "0" + strings.TrimPrefix(number, "+46")
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+}
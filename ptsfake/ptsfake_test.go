@@ -0,0 +1,91 @@
+package ptsfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func search(s *Server, number string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, Path+"?Number="+number, nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	return rw
+}
+
+func decode(t *testing.T, rw *httptest.ResponseRecorder) model.PtsResponse {
+	var resp model.PtsResponse
+	assert.Nil(t, json.NewDecoder(rw.Body).Decode(&resp))
+	return resp
+}
+
+func TestServer_KnownAndUnknownNumbers(t *testing.T) {
+	t.Parallel()
+	s := New(map[string]string{"+46107500500": "Telness AB"})
+
+	rw := search(s, "010-7500500")
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	assert.EqualValues(t, model.OperatorDetails{Name: "Telness AB", Number: "010-7500500"}, decode(t, rw).D)
+
+	rw = search(s, "070-1234567")
+	assert.EqualValues(t, OperatorMissing, decode(t, rw).D.Name)
+
+	s.SetOperator("0701234567", "Tele2 Sverige AB")
+	rw = search(s, "070-1234567")
+	assert.EqualValues(t, "Tele2 Sverige AB", decode(t, rw).D.Name)
+	assert.EqualValues(t, []string{"010-7500500", "070-1234567", "070-1234567"}, s.Requested())
+}
+
+func TestServer_FailNext(t *testing.T) {
+	t.Parallel()
+	s := New(nil)
+	s.FailNext(http.StatusBadGateway, http.StatusServiceUnavailable)
+
+	assert.EqualValues(t, http.StatusBadGateway, search(s, "010-7500500").Code)
+	assert.EqualValues(t, http.StatusServiceUnavailable, search(s, "010-7500500").Code)
+	assert.EqualValues(t, http.StatusOK, search(s, "010-7500500").Code)
+}
+
+func TestServer_Faults(t *testing.T) {
+	t.Parallel()
+	s := New(nil)
+
+	s.SetFaults(Faults{ErrorRate: 1})
+	assert.EqualValues(t, http.StatusServiceUnavailable, search(s, "010-7500500").Code)
+
+	s.SetFaults(Faults{MalformedRate: 1})
+	rw := search(s, "010-7500500")
+	assert.EqualValues(t, http.StatusOK, rw.Code)
+	var resp model.PtsResponse
+	assert.NotNil(t, json.NewDecoder(rw.Body).Decode(&resp))
+}
+
+func TestServer_BadRequests(t *testing.T) {
+	t.Parallel()
+	s := New(nil)
+
+	assert.EqualValues(t, http.StatusBadRequest, search(s, "").Code)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, Path, nil))
+	assert.EqualValues(t, http.StatusMethodNotAllowed, rw.Code)
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/SearchByNumber", nil))
+	assert.EqualValues(t, http.StatusNotFound, rw.Code)
+}
+
+func TestLoadDataset(t *testing.T) {
+	t.Parallel()
+	operators, err := LoadDataset(strings.NewReader(`{"+46107500500": "Telness AB"}`))
+	assert.Nil(t, err)
+	assert.EqualValues(t, map[string]string{"+46107500500": "Telness AB"}, operators)
+
+	_, err = LoadDataset(strings.NewReader(`["+46107500500"]`))
+	assert.NotNil(t, err)
+
+	assert.EqualValues(t, "Telness AB", decode(t, search(Default(), "010-7500500")).D.Name)
+}
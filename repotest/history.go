@@ -0,0 +1,86 @@
+package repotest
+
+import (
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var historyCases = []testCase{
+	{"history records create and update, newest first", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		update := newSubscription("+46107500500", "2027-02-01", model.StatusCancelled)
+		update.Actor, update.Reason = "support", "customer left"
+		assert.Nil(t, repo.UpdateSubscription(ctx, update))
+
+		history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+
+		assert.Nil(t, err)
+		if assert.Len(t, history, 2) {
+			updated, created := history[0], history[1]
+			assert.EqualValues(t, model.HistoryActionUpdated, updated.Action)
+			assert.EqualValues(t, "+46107500500", updated.Msisdn)
+			assert.EqualValues(t, "support", updated.Actor)
+			assert.EqualValues(t, "customer left", updated.Reason)
+			assert.EqualValues(t, &model.SubscriptionState{Msisdn: "+46107500500", ActivateAt: "2027-01-01", SubType: "pbx", Status: model.StatusPending}, updated.Before)
+			assert.EqualValues(t, &model.SubscriptionState{Msisdn: "+46107500500", ActivateAt: "2027-02-01", SubType: "pbx", Status: model.StatusCancelled}, updated.After)
+			assert.NotEmpty(t, updated.ChangedAt)
+
+			assert.EqualValues(t, model.HistoryActionCreated, created.Action)
+			assert.Nil(t, created.Before)
+			assert.EqualValues(t, model.StatusPending, created.After.Status)
+			assert.EqualValues(t, "repotest", created.Actor)
+			assert.True(t, created.ID < updated.ID, "history ids %d and %d do not increase", created.ID, updated.ID)
+		}
+	}},
+	{"history without actor is recorded as unknown", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		sub := newSubscription("+46107500500", "2027-01-01", model.StatusPending)
+		sub.Actor = ""
+		create(t, repo, sub)
+
+		history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+
+		assert.Nil(t, err)
+		if assert.Len(t, history, 1) {
+			assert.EqualValues(t, "unknown", history[0].Actor)
+		}
+	}},
+	{"history is paged", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		for _, status := range []model.SubStatus{model.StatusActivated, model.StatusPaused, model.StatusCancelled} {
+			assert.Nil(t, repo.UpdateSubscription(ctx, newSubscription("+46107500500", "2027-01-01", status)))
+		}
+
+		page, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 2, 1)
+
+		assert.Nil(t, err)
+		if assert.Len(t, page, 2) {
+			assert.EqualValues(t, model.StatusPaused, page[0].After.Status)
+			assert.EqualValues(t, model.StatusActivated, page[1].After.Status)
+		}
+		page, err = repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 4)
+		assert.Nil(t, err)
+		assert.NotNil(t, page)
+		assert.Len(t, page, 0)
+	}},
+	{"history of a missing subscription is empty", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+
+		assert.Nil(t, err)
+		assert.NotNil(t, history)
+		assert.Len(t, history, 0)
+	}},
+	{"failed update is not in the history", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		update := newSubscription("+46107500500", "2027-01-01", model.StatusActivated)
+		update.ExpectedVersion = 5
+		assert.NotNil(t, repo.UpdateSubscription(ctx, update))
+
+		history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+
+		assert.Nil(t, err)
+		assert.Len(t, history, 1)
+	}},
+}
@@ -0,0 +1,70 @@
+package repotest
+
+import (
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var importCases = []testCase{
+	{"batch create goes on after a failing row", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500501", "2027-01-01", model.StatusPending))
+		subs := []model.CreateSubscription{
+			newSubscription("+46107500500", "2027-01-01", model.StatusPending),
+			newSubscription("+46107500501", "2027-01-01", model.StatusPending),
+			newSubscription("+46107500502", "2027-01-01", model.StatusPending),
+		}
+
+		rowErrs, err := repo.CreateSubscriptions(ctx, subs, false)
+
+		assert.Nil(t, err)
+		if assert.Len(t, rowErrs, 3) {
+			assert.Nil(t, rowErrs[0])
+			assert.EqualValues(t, apperr.KindAlreadyExists, apperr.KindOf(rowErrs[1]), "error %v is not an already exists error", rowErrs[1])
+			assert.Nil(t, rowErrs[2])
+		}
+		find(t, repo, "+46107500500")
+		find(t, repo, "+46107500502")
+		history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+		assert.Nil(t, err)
+		assert.Len(t, history, 1)
+	}},
+	{"atomic batch create creates nothing when a row fails", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500501", "2027-01-01", model.StatusPending))
+		subs := []model.CreateSubscription{
+			newSubscription("+46107500500", "2027-01-01", model.StatusPending),
+			newSubscription("+46107500501", "2027-01-01", model.StatusPending),
+			newSubscription("+46107500502", "2027-01-01", model.StatusPending),
+		}
+
+		rowErrs, err := repo.CreateSubscriptions(ctx, subs, true)
+
+		assert.Nil(t, err)
+		if assert.Len(t, rowErrs, 3) {
+			assert.EqualValues(t, apperr.KindAlreadyExists, apperr.KindOf(rowErrs[1]), "error %v is not an already exists error", rowErrs[1])
+		}
+		_, err = repo.FindSubscriptionbyID(ctx, "+46107500500")
+		assertNotFound(t, err)
+		_, err = repo.FindSubscriptionbyID(ctx, "+46107500502")
+		assertNotFound(t, err)
+		history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+		assert.Nil(t, err)
+		assert.Len(t, history, 0)
+	}},
+	{"atomic batch create creates every row", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		subs := []model.CreateSubscription{
+			newSubscription("+46107500500", "2027-01-01", model.StatusPending),
+			newSubscription("+46107500501", "2027-01-01", model.StatusPending),
+		}
+
+		rowErrs, err := repo.CreateSubscriptions(ctx, subs, true)
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, []error{nil, nil}, rowErrs)
+		find(t, repo, "+46107500500")
+		find(t, repo, "+46107500501")
+	}},
+}
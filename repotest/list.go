@@ -0,0 +1,152 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// listFixture creates subscriptions to list, two of them share an activation date. Msisdns only
+// differ in digits, so their order does not depend on the collation of the database.
+func listFixture(t *testing.T, repo service.SubscriptionRepoInterface) {
+	create(t, repo,
+		newSubscription("+46107500503", "2027-03-01", model.StatusPending),
+		newSubscription("+46107500501", "2027-01-01", model.StatusActivated),
+		newSubscription("+46107500502", "2027-02-01", model.StatusPending),
+		newSubscription("+46107500500", "2027-02-01", model.StatusCancelled),
+		newSubscription("+46107500504", "2027-04-01", model.StatusPending),
+	)
+	cell := newSubscription("+46107500505", "2027-05-01", model.StatusPaused)
+	cell.SubType = "cell"
+	create(t, repo, cell)
+}
+
+func msisdns(subs []model.Subscription) []string {
+	result := []string{}
+	for _, sub := range subs {
+		result = append(result, sub.Msisdn)
+	}
+	return result
+}
+
+func list(t *testing.T, repo service.SubscriptionRepoInterface, filter model.SubscriptionFilter) []string {
+	t.Helper()
+	if filter.Sort == "" {
+		filter.Sort = model.SortByMsisdn
+	}
+	subs, err := repo.ListSubscriptions(ctx, filter)
+	if err != nil {
+		t.Fatalf("could not list subscriptions: %v", err)
+	}
+	return msisdns(subs)
+}
+
+// listAll lists every page of the filter, following the cursor after the last subscription of a page
+func listAll(t *testing.T, repo service.SubscriptionRepoInterface, filter model.SubscriptionFilter) []string {
+	t.Helper()
+	all := []string{}
+	for pages := 0; pages < 10; pages++ {
+		subs, err := repo.ListSubscriptions(ctx, filter)
+		if err != nil {
+			t.Fatalf("could not list subscriptions: %v", err)
+		}
+		all = append(all, msisdns(subs)...)
+		if len(subs) < filter.Limit {
+			return all
+		}
+		last := subs[len(subs)-1]
+		filter.After = &model.ListCursor{Sort: filter.Sort, Order: filter.Order, Value: last.SortValue(filter.Sort), Msisdn: last.Msisdn}
+	}
+	t.Fatalf("listing does not end")
+	return nil
+}
+
+var listCases = []testCase{
+	{"list sorts by msisdn", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		listFixture(t, repo)
+
+		assert.EqualValues(t, []string{"+46107500500", "+46107500501", "+46107500502", "+46107500503", "+46107500504", "+46107500505"}, list(t, repo, model.SubscriptionFilter{}))
+		assert.EqualValues(t, []string{"+46107500505", "+46107500504", "+46107500503"}, list(t, repo, model.SubscriptionFilter{Order: model.OrderDesc, Limit: 3}))
+	}},
+	{"list of nothing is empty", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		subs, err := repo.ListSubscriptions(ctx, model.SubscriptionFilter{Sort: model.SortByMsisdn})
+
+		assert.Nil(t, err)
+		assert.NotNil(t, subs)
+		assert.Len(t, subs, 0)
+	}},
+	{"list sorts by date, ties by msisdn", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		listFixture(t, repo)
+
+		asc := list(t, repo, model.SubscriptionFilter{Sort: model.SortByActivateAt})
+		desc := list(t, repo, model.SubscriptionFilter{Sort: model.SortByActivateAt, Order: model.OrderDesc})
+
+		assert.EqualValues(t, []string{"+46107500501", "+46107500500", "+46107500502", "+46107500503", "+46107500504", "+46107500505"}, asc)
+		assert.EqualValues(t, []string{"+46107500505", "+46107500504", "+46107500503", "+46107500502", "+46107500500", "+46107500501"}, desc)
+	}},
+	{"list filters", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		listFixture(t, repo)
+		date := func(month time.Month) time.Time { return time.Date(2027, month, 1, 0, 0, 0, 0, time.UTC) }
+
+		assert.EqualValues(t, []string{"+46107500502", "+46107500503", "+46107500504"}, list(t, repo, model.SubscriptionFilter{Status: []model.SubStatus{model.StatusPending}}))
+		assert.EqualValues(t, []string{"+46107500500", "+46107500505"}, list(t, repo, model.SubscriptionFilter{Status: []model.SubStatus{model.StatusCancelled, model.StatusPaused}}))
+		assert.EqualValues(t, []string{"+46107500505"}, list(t, repo, model.SubscriptionFilter{SubType: []string{"cell"}}))
+		// from is inclusive, to is exclusive
+		assert.EqualValues(t, []string{"+46107500500", "+46107500502", "+46107500503"}, list(t, repo, model.SubscriptionFilter{ActivateFrom: date(time.February), ActivateTo: date(time.April)}))
+		assert.EqualValues(t, []string{}, list(t, repo, model.SubscriptionFilter{CreatedFrom: time.Now().Add(time.Hour)}))
+		assert.EqualValues(t, 6, len(list(t, repo, model.SubscriptionFilter{CreatedFrom: time.Now().Add(-time.Hour), CreatedTo: time.Now().Add(time.Hour)})))
+	}},
+	{"list by msisdn prefix matches wildcards literally", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		listFixture(t, repo)
+		create(t, repo, newSubscription("+4610750_500", "2027-01-01", model.StatusPending))
+
+		assert.EqualValues(t, []string{"+46107500500", "+46107500501", "+46107500502", "+46107500503", "+46107500504", "+46107500505"}, list(t, repo, model.SubscriptionFilter{MsisdnPrefix: "+4610750050"}))
+		assert.EqualValues(t, []string{"+4610750_500"}, list(t, repo, model.SubscriptionFilter{MsisdnPrefix: "+4610750_"}))
+		assert.EqualValues(t, []string{}, list(t, repo, model.SubscriptionFilter{MsisdnPrefix: "+46%"}))
+	}},
+	{"list pages with a cursor", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		listFixture(t, repo)
+
+		for _, sort := range model.SortFields {
+			for _, order := range []string{model.OrderAsc, model.OrderDesc} {
+				filter := model.SubscriptionFilter{Sort: sort, Order: order}
+				all := list(t, repo, filter)
+				filter.Limit = 2
+				assert.EqualValues(t, all, listAll(t, repo, filter), "pages sorted by %v %v", sort, order)
+			}
+		}
+	}},
+	{"stream returns the list in order", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		listFixture(t, repo)
+		filter := model.SubscriptionFilter{Sort: model.SortByActivateAt, Order: model.OrderDesc, Status: []model.SubStatus{model.StatusPending, model.StatusPaused}}
+		var streamed []model.Subscription
+
+		err := repo.StreamSubscriptions(ctx, filter, func(sub model.Subscription) error {
+			streamed = append(streamed, sub)
+			return nil
+		})
+
+		assert.Nil(t, err)
+		listed, err := repo.ListSubscriptions(ctx, filter)
+		assert.Nil(t, err)
+		assert.EqualValues(t, listed, streamed)
+	}},
+	{"stream stops at an error", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		listFixture(t, repo)
+		calls := 0
+
+		err := repo.StreamSubscriptions(ctx, model.SubscriptionFilter{Sort: model.SortByMsisdn}, func(sub model.Subscription) error {
+			calls++
+			if calls == 2 {
+				return errStop
+			}
+			return nil
+		})
+
+		assert.Equal(t, errStop, err)
+		assert.EqualValues(t, 2, calls)
+	}},
+}
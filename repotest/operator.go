@@ -0,0 +1,67 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var operatorCases = []testCase{
+	{"update operator stores operator and check time", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		created := find(t, repo, "+46107500500")
+		checkedAt := time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC)
+
+		err := repo.UpdateOperator(ctx, "+46107500500", "Telness AB", checkedAt)
+
+		assert.Nil(t, err)
+		sub := find(t, repo, "+46107500500")
+		assert.EqualValues(t, "Telness AB", sub.Operator)
+		assert.True(t, parseTime(t, sub.OperatorCheckedAt).Equal(checkedAt), "operator_checked_at %v", sub.OperatorCheckedAt)
+		// the operator is not a change of the subscription itself
+		assert.EqualValues(t, created.Version, sub.Version)
+		assert.EqualValues(t, created.ModifiedAt, sub.ModifiedAt)
+		history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+		assert.Nil(t, err)
+		assert.Len(t, history, 1)
+	}},
+	{"update operator of missing is not found", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		err := repo.UpdateOperator(ctx, "+46107500500", "Telness AB", time.Now())
+
+		assertNotFound(t, err)
+	}},
+	{"ported out again after porting back is recorded", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		portability, ok := repo.(service.PortabilityRepoInterface)
+		if !ok {
+			t.Skip("repository does not record portability events")
+		}
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusActivated))
+		start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+		// check stores the operator like the reconciler, and records it as ported out unless it is Telness
+		check := func(operator string, hours int) bool {
+			at := start.Add(time.Duration(hours) * time.Hour)
+			assert.Nil(t, repo.UpdateOperator(ctx, "+46107500500", operator, at))
+			if operator == "Telness AB" {
+				return false
+			}
+			event := model.PortabilityEvent{Msisdn: "+46107500500", ExpectedOperator: "Telness AB", Operator: operator}
+			recorded, err := portability.RecordPortedOut(ctx, event, at)
+			assert.Nil(t, err)
+			return recorded
+		}
+
+		check("Telness AB", 0)
+		assert.True(t, check("Tele2 Sverige AB", 1), "ported out")
+		assert.False(t, check("Tele2 Sverige AB", 2), "still ported out")
+		check("Telness AB", 3)
+		assert.True(t, check("Tele2 Sverige AB", 4), "ported out again")
+		assert.False(t, check("Tele2 Sverige AB", 5), "still ported out again")
+
+		events, err := portability.FindPortabilityEvents(ctx, start, start.Add(24*time.Hour))
+		assert.Nil(t, err)
+		assert.Len(t, events, 2)
+	}},
+}
@@ -0,0 +1,52 @@
+// Package repotest checks that a repository behaves the way the service assumes, e.g. that a missing
+// subscription is a not found error and that created_at never changes. Every implementation of
+// service.SubscriptionRepoInterface runs the same tests with one call to Run from its own tests:
+//
+//	func TestRepo(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) service.SubscriptionRepoInterface {
+//			return NewSubscriptionRepo()
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/service"
+)
+
+// NewRepo returns an empty repository for one test. Tests run one after another, so a repository
+// on a shared database can be emptied instead of created.
+type NewRepo func(t *testing.T) service.SubscriptionRepoInterface
+
+type testCase struct {
+	name string
+	test func(t *testing.T, repo service.SubscriptionRepoInterface)
+}
+
+// Run runs every behaviour test against a repository returned by newRepo
+func Run(t *testing.T, newRepo NewRepo) {
+	for _, tc := range testCases() {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepo(t))
+		})
+	}
+}
+
+func testCases() []testCase {
+	var cases []testCase
+	cases = append(cases, subscriptionCases...)
+	cases = append(cases, historyCases...)
+	cases = append(cases, importCases...)
+	cases = append(cases, listCases...)
+	cases = append(cases, operatorCases...)
+	return cases
+}
+
+var ctx = context.Background()
+
+// errStop is returned by a stream callback to stop the stream
+var errStop = errors.New("stop")
@@ -0,0 +1,149 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSubscription(msisdn, activateAt string, status model.SubStatus) model.CreateSubscription {
+	return model.CreateSubscription{Msisdn: msisdn, ActivateAt: activateAt, SubType: "pbx", Status: status, Actor: "repotest"}
+}
+
+// create creates the subscriptions and fails the test when one cannot be created
+func create(t *testing.T, repo service.SubscriptionRepoInterface, subs ...model.CreateSubscription) {
+	t.Helper()
+	for _, sub := range subs {
+		if err := repo.CreateSubscription(ctx, sub); err != nil {
+			t.Fatalf("could not create subscription %v: %v", sub.Msisdn, err)
+		}
+	}
+}
+
+func find(t *testing.T, repo service.SubscriptionRepoInterface, msisdn string) model.Subscription {
+	t.Helper()
+	sub, err := repo.FindSubscriptionbyID(ctx, msisdn)
+	if err != nil {
+		t.Fatalf("could not find subscription %v: %v", msisdn, err)
+	}
+	return sub
+}
+
+// parseTime parses a time returned by the repository, which must be RFC3339
+func parseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		t.Fatalf("time %q is not RFC3339: %v", value, err)
+	}
+	return parsed
+}
+
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+	assert.EqualValues(t, apperr.KindNotFound, apperr.KindOf(err), "error %v is not a not found error", err)
+	assert.EqualValues(t, apperr.CodeSubscriptionNotFound, apperr.CodeOf(err))
+}
+
+var subscriptionCases = []testCase{
+	{"create then find", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		before := time.Now().Add(-time.Minute)
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+
+		sub := find(t, repo, "+46107500500")
+
+		assert.EqualValues(t, "+46107500500", sub.Msisdn)
+		assert.True(t, parseTime(t, sub.ActivateAt).Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)), "activate_at %v", sub.ActivateAt)
+		assert.EqualValues(t, "pbx", sub.SubType)
+		assert.EqualValues(t, model.StatusPending, sub.Status)
+		assert.EqualValues(t, 1, sub.Version)
+		assert.Empty(t, sub.Operator)
+		assert.Empty(t, sub.OperatorCheckedAt)
+		assert.True(t, parseTime(t, sub.CreatedAt).After(before), "created_at %v is not set to now", sub.CreatedAt)
+		assert.EqualValues(t, sub.CreatedAt, sub.ModifiedAt)
+	}},
+	{"find missing is not found", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		_, err := repo.FindSubscriptionbyID(ctx, "+46107500500")
+
+		assertNotFound(t, err)
+	}},
+	{"create duplicate already exists", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+
+		err := repo.CreateSubscription(ctx, newSubscription("+46107500500", "2027-02-01", model.StatusCancelled))
+
+		assert.EqualValues(t, apperr.KindAlreadyExists, apperr.KindOf(err), "error %v is not an already exists error", err)
+		assert.EqualValues(t, apperr.CodeSubscriptionExists, apperr.CodeOf(err))
+		sub := find(t, repo, "+46107500500")
+		assert.EqualValues(t, model.StatusPending, sub.Status)
+	}},
+	{"update changes the subscription", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		created := find(t, repo, "+46107500500")
+		update := newSubscription("+46107500500", "2027-02-01", model.StatusActivated)
+		update.SubType = "cell"
+
+		err := repo.UpdateSubscription(ctx, update)
+
+		assert.Nil(t, err)
+		sub := find(t, repo, "+46107500500")
+		assert.True(t, parseTime(t, sub.ActivateAt).Equal(time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC)), "activate_at %v", sub.ActivateAt)
+		assert.EqualValues(t, "cell", sub.SubType)
+		assert.EqualValues(t, model.StatusActivated, sub.Status)
+		assert.EqualValues(t, 2, sub.Version)
+		assert.False(t, parseTime(t, sub.ModifiedAt).Before(parseTime(t, created.ModifiedAt)), "modified_at %v went back", sub.ModifiedAt)
+	}},
+	{"update never changes created_at", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		created := find(t, repo, "+46107500500")
+
+		for _, status := range []model.SubStatus{model.StatusActivated, model.StatusPaused, model.StatusCancelled} {
+			time.Sleep(time.Millisecond)
+			err := repo.UpdateSubscription(ctx, newSubscription("+46107500500", "2027-01-01", status))
+			assert.Nil(t, err)
+		}
+
+		sub := find(t, repo, "+46107500500")
+		assert.EqualValues(t, created.CreatedAt, sub.CreatedAt)
+		assert.True(t, parseTime(t, sub.ModifiedAt).After(parseTime(t, sub.CreatedAt)), "modified_at %v is not after created_at %v", sub.ModifiedAt, sub.CreatedAt)
+	}},
+	{"update missing is not found", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		err := repo.UpdateSubscription(ctx, newSubscription("+46107500500", "2027-01-01", model.StatusActivated))
+
+		assertNotFound(t, err)
+		_, err = repo.FindSubscriptionbyID(ctx, "+46107500500")
+		assertNotFound(t, err)
+	}},
+	{"update with expected version", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		update := newSubscription("+46107500500", "2027-01-01", model.StatusActivated)
+		update.ExpectedVersion = 1
+
+		err := repo.UpdateSubscription(ctx, update)
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, 2, find(t, repo, "+46107500500").Version)
+	}},
+	{"update with stale version is a version mismatch", func(t *testing.T, repo service.SubscriptionRepoInterface) {
+		create(t, repo, newSubscription("+46107500500", "2027-01-01", model.StatusPending))
+		create(t, repo, newSubscription("+46107500501", "2027-01-01", model.StatusPending))
+		update := newSubscription("+46107500500", "2027-01-01", model.StatusActivated)
+		update.ExpectedVersion = 1
+		assert.Nil(t, repo.UpdateSubscription(ctx, update))
+
+		update.Status = model.StatusCancelled
+		err := repo.UpdateSubscription(ctx, update)
+
+		assert.EqualValues(t, apperr.KindPreconditionFailed, apperr.KindOf(err), "error %v is not a precondition failed error", err)
+		assert.EqualValues(t, apperr.CodeVersionMismatch, apperr.CodeOf(err))
+		sub := find(t, repo, "+46107500500")
+		assert.EqualValues(t, model.StatusActivated, sub.Status)
+		assert.EqualValues(t, 2, sub.Version)
+		// versions belong to a subscription, not to the repository
+		assert.EqualValues(t, 1, find(t, repo, "+46107500501").Version)
+	}},
+}
@@ -0,0 +1,466 @@
+// Package sdk is a Go client for the subscription api of telness-manager, so services calling the
+// api do not have to build the requests by hand. It uses the /api/v2/subscriptions routes.
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 2
+	defaultBackoff    = 200 * time.Millisecond
+)
+
+// Client calls the subscription api. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	auth       Authenticator
+	actor      string
+	maxRetries int
+	backoff    time.Duration
+	// validateOnly makes the api check changes without making them
+	validateOnly bool
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the http client requests are sent with, by default one with a 10s timeout
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithAuth adds credentials to every request
+func WithAuth(auth Authenticator) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithActor sets who makes the changes, it is recorded in the subscription history
+func WithActor(actor string) Option {
+	return func(c *Client) {
+		c.actor = actor
+	}
+}
+
+// WithRetries sets how often a request failing with a network error or 502, 503 or 504 is retried,
+// waiting backoff before the first retry and twice as long before every next one. Zero retries
+// turns retrying off, by default a request is retried twice.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.backoff = backoff
+	}
+}
+
+// WithValidateOnly makes the api only check every change and answer with the subscription as it
+// would be, nothing is changed. Every change the client makes can be checked, Import answers with
+// the result of every row without creating them.
+func WithValidateOnly() Option {
+	return func(c *Client) {
+		c.validateOnly = true
+	}
+}
+
+// ErrVersionRequired is returned by a change without the version it is based on. Pass the version
+// of the subscription the change is based on, or Force() to change it whatever its version.
+var ErrVersionRequired = errors.New("sdk: the version the change is based on is required, use sdk.Force() to change any version")
+
+// anyVersion is the version sent as If-Match: *
+const anyVersion int64 = -1
+
+// Force is passed as version to change a subscription whatever its version, overwriting changes
+// made by others in the meantime
+func Force() int64 {
+	return anyVersion
+}
+
+// Authenticator adds credentials to a request before it is sent
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// AuthenticatorFunc lets a function be used as Authenticator
+type AuthenticatorFunc func(req *http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// BearerToken authenticates requests with an Authorization: Bearer header
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// NewClient returns a client for the api at baseURL, e.g. http://localhost:9000
+func NewClient(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		maxRetries: defaultMaxRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// ListOptions are the criteria to list subscriptions by, zero values are not filtered on
+type ListOptions struct {
+	Status       []model.SubStatus
+	SubType      []string
+	ActivateFrom time.Time
+	ActivateTo   time.Time
+	CreatedFrom  time.Time
+	CreatedTo    time.Time
+	MsisdnPrefix string
+	Sort         string
+	Order        string
+	Limit        int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	for _, status := range o.Status {
+		query.Add("status", string(status))
+	}
+	for _, subType := range o.SubType {
+		query.Add("sub_type", subType)
+	}
+	dates := []struct {
+		name  string
+		value time.Time
+	}{
+		{"activate_from", o.ActivateFrom},
+		{"activate_to", o.ActivateTo},
+		{"created_from", o.CreatedFrom},
+		{"created_to", o.CreatedTo},
+	}
+	for _, date := range dates {
+		if !date.value.IsZero() {
+			query.Set(date.name, date.value.Format(time.RFC3339))
+		}
+	}
+	values := map[string]string{"msisdn_prefix": o.MsisdnPrefix, "sort": o.Sort, "order": o.Order, "cursor": o.Cursor}
+	for name, value := range values {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return query
+}
+
+// Create creates a subscription
+func (c *Client) Create(ctx context.Context, sub model.CreateSubscription) (model.Subscription, error) {
+	var created model.Subscription
+	err := c.do(ctx, http.MethodPost, "/api/v2/subscriptions", nil, sub, 0, &created)
+	return created, err
+}
+
+// Get finds the subscription with given msisdn
+func (c *Client) Get(ctx context.Context, msisdn string) (model.Subscription, error) {
+	var sub model.Subscription
+	err := c.do(ctx, http.MethodGet, subscriptionPath(msisdn), nil, nil, 0, &sub)
+	return sub, err
+}
+
+// Update replaces activate_at, sub_type and status of the subscription. sub.ExpectedVersion is the
+// version the update is based on, the update fails with a version_mismatch error if the
+// subscription was changed since. It is required, Force() overwrites any version.
+func (c *Client) Update(ctx context.Context, sub model.CreateSubscription) (model.Subscription, error) {
+	var updated model.Subscription
+	err := c.do(ctx, http.MethodPut, subscriptionPath(sub.Msisdn), nil, sub, sub.ExpectedVersion, &updated)
+	return updated, err
+}
+
+// SetStatus moves the subscription to a new status. The change fails with a version_mismatch error
+// if the subscription was changed since version. The version is required, Force() changes any
+// version.
+func (c *Client) SetStatus(ctx context.Context, msisdn string, status model.SubStatus, version int64) (model.Subscription, error) {
+	var updated model.Subscription
+	err := c.do(ctx, http.MethodPut, subscriptionPath(msisdn)+"/status", nil, model.StatusChange{Status: status}, version, &updated)
+	return updated, err
+}
+
+// SetActivationDate changes the activation date of a pending subscription, date is of format
+// 2006-01-02. The version works like for SetStatus.
+func (c *Client) SetActivationDate(ctx context.Context, msisdn string, date string, version int64) (model.Subscription, error) {
+	var updated model.Subscription
+	err := c.do(ctx, http.MethodPut, subscriptionPath(msisdn)+"/activation", nil, model.ActivationChange{ActivateAt: date}, version, &updated)
+	return updated, err
+}
+
+// List returns one page of subscriptions matching the options
+func (c *Client) List(ctx context.Context, options ListOptions) (model.SubscriptionPage, error) {
+	var page model.SubscriptionPage
+	err := c.do(ctx, http.MethodGet, "/api/v2/subscriptions", options.query(), nil, 0, &page)
+	return page, err
+}
+
+// Export calls fn with every subscription matching the options, in the order of the options. The
+// subscriptions are read while the api streams them, so an export of all subscriptions does not have
+// to fit in memory. Limit and Cursor are not used. With withOperator the stored operator of every
+// subscription is set, PTS is not asked. An error returned by fn stops the export and is returned.
+func (c *Client) Export(ctx context.Context, options ListOptions, withOperator bool, fn func(sub model.Subscription) error) error {
+	query := options.query()
+	query.Del("limit")
+	query.Del("cursor")
+	if withOperator {
+		query.Set("include_operator", "true")
+	}
+	header := http.Header{}
+	header.Set("Accept", "application/x-ndjson")
+	target := c.baseURL + "/api/v2/subscriptions/export?" + query.Encode()
+	var response *http.Response
+	err := c.retry(ctx, func() error {
+		resp, err := c.send(ctx, http.MethodGet, target, header, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= 300 {
+			return decodeResponse(resp, nil)
+		}
+		response = resp
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var sub model.Subscription
+		err := decoder.Decode(&sub)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// the api aborts the response when the export fails after it started
+			return fmt.Errorf("could not read export: %w", err)
+		}
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+}
+
+// History returns one page of the changes made to the subscription, newest change first.
+// A zero limit uses the default page size of the api.
+func (c *Client) History(ctx context.Context, msisdn string, limit, offset int) (model.HistoryPage, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	var page model.HistoryPage
+	err := c.do(ctx, http.MethodGet, subscriptionPath(msisdn)+"/history", query, nil, 0, &page)
+	return page, err
+}
+
+// ImportOptions change how an import is done
+type ImportOptions struct {
+	// ValidateOnly only validates the rows, nothing is created
+	ValidateOnly bool
+	// Atomic creates every row or none of them
+	Atomic bool
+}
+
+// Import creates the subscriptions of a csv or ndjson file at once and returns the result of every
+// row, contentType is text/csv or application/x-ndjson. Rows which fail do not make Import return
+// an error, they are reported in the result.
+func (c *Client) Import(ctx context.Context, data io.Reader, contentType string, options ImportOptions) (model.ImportResult, error) {
+	body, err := ioutil.ReadAll(data)
+	if err != nil {
+		return model.ImportResult{}, err
+	}
+	query := url.Values{}
+	if options.ValidateOnly {
+		query.Set("validate_only", "true")
+	}
+	if options.Atomic {
+		query.Set("atomic", "true")
+	}
+	var result model.ImportResult
+	err = c.do(ctx, http.MethodPost, "/api/v2/subscriptions/import", query, rawBody{contentType: contentType, data: body}, 0, &result)
+	return result, err
+}
+
+// rawBody is a request body sent as it is instead of encoded as json
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+func subscriptionPath(msisdn string) string {
+	return "/api/v2/subscriptions/" + url.PathEscape(msisdn)
+}
+
+// do sends a request and decodes the response into result, retrying it when it failed on the way.
+// Changes are sent with an Idempotency-Key, so a retry of a change which did reach the api is not
+// applied twice.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, version int64, result interface{}) error {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	var reqBody []byte
+	switch b := body.(type) {
+	case nil:
+	case rawBody:
+		reqBody = b.data
+		header.Set("Content-Type", b.contentType)
+	default:
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+		header.Set("Content-Type", "application/json")
+	}
+	if method != http.MethodGet {
+		key, err := idempotencyKey()
+		if err != nil {
+			return err
+		}
+		header.Set("Idempotency-Key", key)
+		if c.actor != "" {
+			header.Set("X-Actor", c.actor)
+		}
+		if method != http.MethodPost {
+			switch version {
+			case 0:
+				return ErrVersionRequired
+			case anyVersion:
+				header.Set("If-Match", "*")
+			default:
+				header.Set("If-Match", fmt.Sprintf(`"%d"`, version))
+			}
+		}
+		if c.validateOnly {
+			checked := url.Values{"validate_only": {"true"}}
+			for name, values := range query {
+				checked[name] = values
+			}
+			query = checked
+		}
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	return c.retry(ctx, func() error {
+		response, err := c.send(ctx, method, target, header, reqBody)
+		if err != nil {
+			return err
+		}
+		return decodeResponse(response, result)
+	})
+}
+
+// retry runs attempt until it succeeds, fails with an error which is not retryable or the retries
+// are used up, waiting longer before every retry
+func (c *Client) retry(ctx context.Context, attempt func() error) error {
+	backoff := c.backoff
+	for retries := 0; ; retries++ {
+		err := attempt()
+		if retries >= c.maxRetries || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target string, header http.Header, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("could not authenticate request: %w", err)
+		}
+	}
+	response, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &networkError{err: err}
+	}
+	return response, nil
+}
+
+func decodeResponse(response *http.Response, result interface{}) error {
+	defer response.Body.Close()
+	respBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return &networkError{err: err}
+	}
+	if response.StatusCode >= 300 {
+		return newError(response.StatusCode, respBody)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	return nil
+}
+
+// networkError is a request which failed on the way, before an answer of the api was read
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string {
+	return e.err.Error()
+}
+
+func (e *networkError) Unwrap() error {
+	return e.err
+}
+
+func idempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
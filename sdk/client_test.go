@@ -0,0 +1,375 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/handlers"
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const msisdn = "+46107500500"
+
+var ctx = context.Background()
+
+// setupServer starts the api in process, wrap can put a handler in front of it
+func setupServer(t *testing.T, wrap func(http.Handler) http.Handler) (*httptest.Server, *mock.DbMock) {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	db := &mock.DbMock{}
+	db.SetOperator = func(msisdn string, operator string, checkedAt time.Time) error {
+		return nil
+	}
+	pts := &mock.ClientMock{}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+	subsvc := service.SubscriptionSvc{Log: log, SubscriptionRepo: db, PtsClient: pts}
+	var handler http.Handler = handlers.Server{Log: log, SubscriptionService: subsvc}.Router()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts, db
+}
+
+func mockSubscription(db *mock.DbMock, status model.SubStatus, activateAt string) {
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{
+			Msisdn:     msisdn,
+			ActivateAt: activateAt,
+			SubType:    "cell",
+			Status:     status,
+			Operator:   "Telness AB",
+			Version:    3,
+		}, nil
+	}
+}
+
+func TestClient_Get(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+
+	sub, err := NewClient(ts.URL).Get(ctx, msisdn)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, msisdn, sub.Msisdn)
+	assert.EqualValues(t, model.StatusActivated, sub.Status)
+	assert.EqualValues(t, 3, sub.Version)
+}
+
+func TestClient_GetNotFound(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{}, apperr.NotFound(apperr.CodeSubscriptionNotFound, nil, "subscription with msisdn %v not found", msisdn)
+	}
+
+	_, err := NewClient(ts.URL).Get(ctx, msisdn)
+
+	var apiErr *Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.EqualValues(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.True(t, errors.Is(err, apperr.ErrNotFound))
+	assert.EqualValues(t, apperr.CodeSubscriptionNotFound, apperr.CodeOf(err))
+}
+
+func TestClient_CreateValidationError(t *testing.T) {
+	t.Parallel()
+	ts, _ := setupServer(t, nil)
+
+	_, err := NewClient(ts.URL).Create(ctx, model.CreateSubscription{Msisdn: msisdn})
+
+	assert.True(t, errors.Is(err, apperr.ErrValidation))
+	var apiErr *Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.EqualValues(t, apperr.CodeValidationFailed, apiErr.Code)
+	assert.Len(t, apiErr.Fields, 3)
+}
+
+func TestClient_SetStatus(t *testing.T) {
+	t.Parallel()
+	var ifMatch, actor string
+	ts, db := setupServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			ifMatch, actor = req.Header.Get("If-Match"), req.Header.Get("X-Actor")
+			next.ServeHTTP(rw, req)
+		})
+	})
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+	var updated model.CreateSubscription
+	db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+
+	_, err := NewClient(ts.URL, WithActor("billing")).SetStatus(ctx, msisdn, model.StatusPaused, 3)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, model.StatusPaused, updated.Status)
+	assert.EqualValues(t, "billing", updated.Actor)
+	assert.EqualValues(t, `"3"`, ifMatch)
+	assert.EqualValues(t, "billing", actor)
+}
+
+func TestClient_SetStatusInvalidTransition(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	mockSubscription(db, model.StatusCancelled, "2021-10-11")
+
+	_, err := NewClient(ts.URL).SetStatus(ctx, msisdn, model.StatusActivated, 3)
+
+	assert.True(t, errors.Is(err, apperr.ErrInvalidTransition))
+}
+
+func TestClient_SetActivationDateVersionMismatch(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	mockSubscription(db, model.StatusPending, tomorrow)
+
+	_, err := NewClient(ts.URL).SetActivationDate(ctx, msisdn, tomorrow, 2)
+
+	var apiErr *Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.EqualValues(t, http.StatusPreconditionFailed, apiErr.StatusCode)
+	assert.True(t, errors.Is(err, apperr.ErrPreconditionFailed))
+	assert.EqualValues(t, apperr.CodeVersionMismatch, apperr.CodeOf(err))
+}
+
+func TestClient_ChangeRequiresVersion(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	ts, db := setupServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			next.ServeHTTP(rw, req)
+		})
+	})
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+	c := NewClient(ts.URL)
+
+	_, err := c.SetStatus(ctx, msisdn, model.StatusPaused, 0)
+	assert.Equal(t, ErrVersionRequired, err)
+	_, err = c.Update(ctx, model.CreateSubscription{Msisdn: msisdn, ActivateAt: "2021-10-11", SubType: "cell", Status: model.StatusPaused})
+	assert.Equal(t, ErrVersionRequired, err)
+	assert.EqualValues(t, 0, calls)
+	db.AssertNotCalled(t, "UpdateSubscription")
+}
+
+func TestClient_ForceChangesAnyVersion(t *testing.T) {
+	t.Parallel()
+	var ifMatch string
+	ts, db := setupServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			ifMatch = req.Header.Get("If-Match")
+			next.ServeHTTP(rw, req)
+		})
+	})
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+	db.Update = func(sub model.CreateSubscription) error {
+		return nil
+	}
+
+	_, err := NewClient(ts.URL).SetStatus(ctx, msisdn, model.StatusPaused, Force())
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "*", ifMatch)
+}
+
+func TestClient_ValidateOnly(t *testing.T) {
+	t.Parallel()
+	var query string
+	ts, db := setupServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			query = req.URL.RawQuery
+			next.ServeHTTP(rw, req)
+		})
+	})
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+	c := NewClient(ts.URL, WithValidateOnly())
+
+	sub, err := c.SetStatus(ctx, msisdn, model.StatusPaused, 3)
+	assert.Nil(t, err)
+	assert.EqualValues(t, model.StatusPaused, sub.Status)
+	assert.EqualValues(t, "validate_only=true", query)
+
+	_, err = c.SetStatus(ctx, msisdn, model.StatusPending, 3)
+	assert.True(t, errors.Is(err, apperr.ErrInvalidTransition))
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	_, err = c.Create(ctx, model.CreateSubscription{Msisdn: msisdn, ActivateAt: tomorrow, SubType: "cell", Status: model.StatusPending})
+	assert.True(t, errors.Is(err, apperr.ErrAlreadyExists))
+	db.AssertNotCalled(t, "UpdateSubscription")
+	db.AssertNotCalled(t, "CreateSubscription")
+}
+
+func TestClient_List(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	var filter model.SubscriptionFilter
+	db.List = func(f model.SubscriptionFilter) ([]model.Subscription, error) {
+		filter = f
+		return []model.Subscription{{Msisdn: msisdn, Status: model.StatusPending}}, nil
+	}
+
+	page, err := NewClient(ts.URL).List(ctx, ListOptions{
+		Status: []model.SubStatus{model.StatusPending, model.StatusPaused},
+		Sort:   model.SortByMsisdn,
+		Limit:  10,
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, page.Subscriptions, 1)
+	assert.EqualValues(t, []model.SubStatus{model.StatusPending, model.StatusPaused}, filter.Status)
+	assert.EqualValues(t, model.SortByMsisdn, filter.Sort)
+}
+
+func TestClient_Export(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	var filter model.SubscriptionFilter
+	db.List = func(f model.SubscriptionFilter) ([]model.Subscription, error) {
+		filter = f
+		return []model.Subscription{
+			{Msisdn: msisdn, Status: model.StatusActivated, Operator: "Telness AB", Version: 2},
+			{Msisdn: "+46107500501", Status: model.StatusActivated, Version: 1},
+		}, nil
+	}
+	var exported []model.Subscription
+
+	err := NewClient(ts.URL).Export(ctx, ListOptions{Status: []model.SubStatus{model.StatusActivated}, Limit: 1}, true, func(sub model.Subscription) error {
+		exported = append(exported, sub)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, []model.SubStatus{model.StatusActivated}, filter.Status)
+	assert.Len(t, exported, 2)
+	assert.EqualValues(t, "Telness AB", exported[0].Operator)
+	assert.EqualValues(t, 2, exported[0].Version)
+	assert.EqualValues(t, "+46107500501", exported[1].Msisdn)
+
+	stop := errors.New("stop")
+	err = NewClient(ts.URL).Export(ctx, ListOptions{}, false, func(sub model.Subscription) error {
+		return stop
+	})
+	assert.True(t, errors.Is(err, stop))
+}
+
+func TestClient_History(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+	db.FindHistory = func(msisdn string, limit, offset int) ([]model.SubscriptionHistory, error) {
+		assert.EqualValues(t, 5, offset)
+		return []model.SubscriptionHistory{{ID: 1, Msisdn: msisdn, Action: model.HistoryActionCreated}}, nil
+	}
+
+	page, err := NewClient(ts.URL).History(ctx, msisdn, 10, 5)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, msisdn, page.Msisdn)
+	assert.Len(t, page.History, 1)
+}
+
+func TestClient_Import(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, nil)
+	var atomicImport bool
+	db.CreateBatch = func(subs []model.CreateSubscription, atomic bool) ([]error, error) {
+		atomicImport = atomic
+		return make([]error, len(subs)), nil
+	}
+	date := time.Now().AddDate(0, 1, 0).Format("2006-01-02")
+	data := "msisdn,activate_at,sub_type,status\n" + msisdn + "," + date + ",pbx,pending\n+46107500501,2020-01-01,pbx,pending\n"
+
+	result, err := NewClient(ts.URL).Import(ctx, strings.NewReader(data), "text/csv", ImportOptions{})
+
+	assert.Nil(t, err)
+	assert.False(t, atomicImport)
+	assert.EqualValues(t, 2, result.Total)
+	assert.EqualValues(t, 1, result.Created)
+	assert.EqualValues(t, 1, result.Failed)
+	assert.EqualValues(t, model.ImportRowInvalid, result.Rows[1].Status)
+	assert.EqualValues(t, "/activate_at", result.Rows[1].Errors[0].Pointer)
+}
+
+func TestClient_RetriesUnavailable(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	keys := map[string]bool{}
+	ts, db := setupServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			keys[req.Header.Get("Idempotency-Key")] = true
+			if atomic.AddInt32(&calls, 1) < 3 {
+				rw.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	})
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+	db.Update = func(sub model.CreateSubscription) error {
+		return nil
+	}
+
+	_, err := NewClient(ts.URL, WithRetries(2, time.Millisecond)).SetStatus(ctx, msisdn, model.StatusPaused, 3)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, calls)
+	// every retry is sent with the same key, so the api applies the change once
+	assert.Len(t, keys, 1)
+}
+
+func TestClient_GivesUpAfterRetries(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	ts, _ := setupServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			rw.WriteHeader(http.StatusBadGateway)
+		})
+	})
+
+	_, err := NewClient(ts.URL, WithRetries(1, time.Millisecond)).Get(ctx, msisdn)
+
+	assert.True(t, errors.Is(err, apperr.ErrUpstreamUnavailable))
+	assert.EqualValues(t, 2, calls)
+}
+
+func TestClient_Auth(t *testing.T) {
+	t.Parallel()
+	ts, db := setupServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") != "Bearer secret" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	})
+	mockSubscription(db, model.StatusActivated, "2021-10-11")
+
+	_, err := NewClient(ts.URL).Get(ctx, msisdn)
+	var apiErr *Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.EqualValues(t, http.StatusUnauthorized, apiErr.StatusCode)
+
+	_, err = NewClient(ts.URL, WithAuth(BearerToken("secret"))).Get(ctx, msisdn)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,101 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// Error is an error response of the api, decoded from its problem details. It carries the kind
+// and code of the error the api returned, so errors.Is(err, apperr.ErrNotFound), apperr.KindOf
+// and apperr.CodeOf work on it the same way as inside the service.
+type Error struct {
+	StatusCode int
+	Kind       apperr.Kind
+	Code       string
+	Detail     string
+	Fields     []model.ProblemField
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %v: %v", e.StatusCode, e.Code, e.Detail)
+}
+
+func (e *Error) ErrorKind() apperr.Kind {
+	return e.Kind
+}
+
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// Is makes errors.Is(err, apperr.ErrNotFound) and the like match any error of the same kind
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*apperr.Error)
+	return ok && t.Code == "" && t.Kind == e.Kind
+}
+
+// newError decodes an error response, answers which are not problem details, e.g. from a proxy,
+// get the status text as detail
+func newError(statusCode int, body []byte) *Error {
+	var problem model.Problem
+	if err := json.Unmarshal(body, &problem); err != nil || problem.Code == "" {
+		problem = model.Problem{Detail: http.StatusText(statusCode), Code: apperr.CodeInternal}
+		if statusCode < 500 {
+			problem.Code = apperr.CodeBadRequest
+		}
+	}
+	return &Error{
+		StatusCode: statusCode,
+		Kind:       kindOf(statusCode, problem.Code),
+		Code:       problem.Code,
+		Detail:     problem.Detail,
+		Fields:     problem.Errors,
+	}
+}
+
+// kindOf maps the status code of an error response back to the kind of error, the opposite of
+// errorStatus in package handlers
+func kindOf(statusCode int, code string) apperr.Kind {
+	switch statusCode {
+	case http.StatusNotFound:
+		return apperr.KindNotFound
+	case http.StatusConflict:
+		switch code {
+		case apperr.CodeSubscriptionExists:
+			return apperr.KindAlreadyExists
+		case apperr.CodeInvalidTransition:
+			return apperr.KindInvalidTransition
+		}
+		return apperr.KindConflict
+	case http.StatusPreconditionFailed:
+		return apperr.KindPreconditionFailed
+	case http.StatusPreconditionRequired:
+		return apperr.KindPreconditionMissing
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		return apperr.KindValidation
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return apperr.KindUpstreamUnavailable
+	}
+	return apperr.KindInternal
+}
+
+// retryable reports whether a request failing with err may succeed when sent again
+func retryable(err error) bool {
+	var netErr *networkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// Export calls write for every subscription matching the filter, in the order of the filter. The
+// subscriptions are streamed from the repository, they are never all held in memory. Limit and
+// cursor of the filter are ignored, an export has every matching subscription.
+//
+// With withOperator the operator from storage is exported with its operator status, stale when it
+// was confirmed longer than OperatorMaxAge ago. PTS is not asked, an export must not turn into one
+// PTS call per row while the rows are streamed; keeping the operators fresh is left to the
+// OperatorRefresher.
+func (s SubscriptionSvc) Export(ctx context.Context, filter model.SubscriptionFilter, withOperator bool, write func(model.Subscription) error) error {
+	if filter.Sort == "" {
+		filter.Sort = model.SortByCreatedAt
+	}
+	if filter.Order == "" {
+		filter.Order = model.OrderAsc
+	}
+	filter.Limit, filter.After = 0, nil
+	err := validateFilter(filter)
+	if err != nil {
+		s.Log.Errorf("Could not export subscriptions: %v", err)
+		return err
+	}
+	exported := 0
+	err = s.SubscriptionRepo.StreamSubscriptions(ctx, filter, func(sub model.Subscription) error {
+		if withOperator {
+			sub = s.storedOperator(sub)
+		}
+		exported++
+		return write(sub)
+	})
+	if err != nil {
+		s.Log.Errorf("Could not export subscriptions after %d rows due to error: %v", exported, err)
+		return err
+	}
+	s.Log.Infof("exported %d subscriptions", exported)
+	return nil
+}
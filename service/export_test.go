@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func mockExport(db *mock.DbMock, subs ...model.Subscription) *model.SubscriptionFilter {
+	var listed model.SubscriptionFilter
+	db.List = func(filter model.SubscriptionFilter) ([]model.Subscription, error) {
+		listed = filter
+		return subs, nil
+	}
+	return &listed
+}
+
+func TestSubscriptionSvc_Export(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	listed := mockExport(db, model.Subscription{Msisdn: msisdn, Operator: "Telia Sverige AB"}, model.Subscription{Msisdn: "+46107500501"})
+	var exported []model.Subscription
+	err := s.Export(ctx, model.SubscriptionFilter{Limit: 10, After: &model.ListCursor{}}, false, func(sub model.Subscription) error {
+		exported = append(exported, sub)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, exported, 2)
+	assert.EqualValues(t, "Telia Sverige AB", exported[0].Operator)
+	assert.EqualValues(t, model.SortByCreatedAt, listed.Sort)
+	assert.EqualValues(t, model.OrderAsc, listed.Order)
+	assert.EqualValues(t, 0, listed.Limit)
+	assert.Nil(t, listed.After)
+}
+
+func TestSubscriptionSvc_Export_WithOperator(t *testing.T) {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	s.OperatorMaxAge = 24 * time.Hour
+	recently := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+	longAgo := time.Now().Add(-48 * time.Hour).Format(time.RFC3339Nano)
+	mockExport(db,
+		model.Subscription{Msisdn: msisdn, Operator: "Telness AB", OperatorCheckedAt: recently},
+		model.Subscription{Msisdn: "+46107500501", Operator: "Tele2", OperatorCheckedAt: longAgo},
+		model.Subscription{Msisdn: "+46107500502"})
+	var exported []model.Subscription
+	err := s.Export(ctx, model.SubscriptionFilter{}, true, func(sub model.Subscription) error {
+		exported = append(exported, sub)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "Telness AB", exported[0].Operator)
+	assert.EqualValues(t, model.OperatorStatusOK, exported[0].OperatorStatus)
+	assert.EqualValues(t, "Tele2", exported[1].Operator)
+	assert.EqualValues(t, model.OperatorStatusStale, exported[1].OperatorStatus)
+	assert.EqualValues(t, model.OperatorStatusUnknown, exported[2].OperatorStatus)
+	pts.AssertNotCalled(t, "GetOperatorDetails")
+	db.AssertNotCalled(t, "UpdateOperator")
+}
+
+func TestSubscriptionSvc_Export_InvalidSort(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	mockExport(db)
+	err := s.Export(ctx, model.SubscriptionFilter{Sort: "operator"}, false, func(sub model.Subscription) error {
+		return nil
+	})
+
+	assert.True(t, errors.Is(err, apperr.ErrValidation))
+}
+
+func TestSubscriptionSvc_Export_WriteFails(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	mockExport(db, model.Subscription{Msisdn: msisdn}, model.Subscription{Msisdn: "+46107500501"})
+	written := 0
+	err := s.Export(ctx, model.SubscriptionFilter{}, false, func(sub model.Subscription) error {
+		written++
+		return errors.New("broken pipe")
+	})
+
+	assert.EqualError(t, err, "broken pipe")
+	assert.EqualValues(t, 1, written)
+}
@@ -0,0 +1,16 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// IdempotencyRepoInterface stores the responses of requests sent with an Idempotency-Key, so a retry
+// gets the stored response instead of being run twice
+type IdempotencyRepoInterface interface {
+	ReserveIdempotencyKey(ctx context.Context, key, requestHash string, now, expiresAt time.Time) (model.IdempotentResponse, bool, error)
+	CompleteIdempotencyKey(ctx context.Context, key string, response model.IdempotentResponse) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
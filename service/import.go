@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// ImportBatchSize is how many subscriptions of an import are inserted per transaction
+const ImportBatchSize = 100
+
+// Import creates many subscriptions at once and returns the error of every subscription, nil for
+// the ones created. The requests must be validated already. Subscriptions are inserted in batches
+// of ImportBatchSize, each in its own transaction, and a failing subscription does not stop the
+// others. With atomic all of them are inserted in one transaction and none is created when one
+// fails, the others then get an import_row_skipped error.
+//
+// Operators are not looked up at PTS, an import must not turn into one PTS call per row. The
+// OperatorRefresher stores them later.
+func (s SubscriptionSvc) Import(ctx context.Context, subs []model.CreateSubscription, atomic bool) []error {
+	if atomic {
+		rowErrs, err := s.SubscriptionRepo.CreateSubscriptions(ctx, subs, true)
+		if err != nil {
+			s.Log.Errorf("Could not import subscriptions due to error: %v", err)
+			return fill(make([]error, len(subs)), err)
+		}
+		for i, rowErr := range rowErrs {
+			if rowErr != nil {
+				s.Log.Errorf("Could not import subscriptions, row %d failed: %v", i+1, rowErr)
+				failed := rowErrs[i]
+				fill(rowErrs, apperr.Conflict(apperr.CodeImportRowSkipped, "not created, row %d failed and the import is all or nothing", i+1))
+				rowErrs[i] = failed
+				return rowErrs
+			}
+		}
+		return rowErrs
+	}
+
+	errs := make([]error, 0, len(subs))
+	for start := 0; start < len(subs); start += ImportBatchSize {
+		end := start + ImportBatchSize
+		if end > len(subs) {
+			end = len(subs)
+		}
+		rowErrs, err := s.SubscriptionRepo.CreateSubscriptions(ctx, subs[start:end], false)
+		if err != nil {
+			s.Log.Errorf("Could not import subscriptions %d to %d due to error: %v", start+1, end, err)
+			rowErrs = fill(make([]error, end-start), err)
+		}
+		errs = append(errs, rowErrs...)
+	}
+	return errs
+}
+
+// fill sets every element of errs to err and returns errs
+func fill(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func importRequests(n int) []model.CreateSubscription {
+	subs := make([]model.CreateSubscription, n)
+	for i := range subs {
+		subs[i] = model.CreateSubscription{Msisdn: msisdn, ActivateAt: now, SubType: "pbx", Status: model.StatusPending}
+	}
+	return subs
+}
+
+func TestSubscriptionSvc_Import_Batches(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	var batches []int
+	db.CreateBatch = func(subs []model.CreateSubscription, atomic bool) ([]error, error) {
+		assert.False(t, atomic)
+		batches = append(batches, len(subs))
+		errs := make([]error, len(subs))
+		if len(batches) == 2 {
+			errs[0] = apperr.Conflict(apperr.CodeSubscriptionExists, "subscription exists")
+		}
+		return errs, nil
+	}
+	errs := s.Import(ctx, importRequests(ImportBatchSize*2+1), false)
+
+	assert.EqualValues(t, []int{ImportBatchSize, ImportBatchSize, 1}, batches)
+	assert.Len(t, errs, ImportBatchSize*2+1)
+	for i, err := range errs {
+		if i == ImportBatchSize {
+			assert.EqualValues(t, apperr.CodeSubscriptionExists, apperr.CodeOf(err))
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+}
+
+func TestSubscriptionSvc_Import_FailedBatch(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	calls := 0
+	db.CreateBatch = func(subs []model.CreateSubscription, atomic bool) ([]error, error) {
+		calls++
+		if calls == 1 {
+			return make([]error, len(subs)), apperr.UpstreamUnavailable(apperr.CodeDatabaseUnavailable, errors.New("connection reset"), "database is unavailable")
+		}
+		return make([]error, len(subs)), nil
+	}
+	errs := s.Import(ctx, importRequests(ImportBatchSize+1), false)
+
+	assert.EqualValues(t, 2, calls)
+	assert.NotNil(t, errs[0])
+	assert.NotNil(t, errs[ImportBatchSize-1])
+	assert.Nil(t, errs[ImportBatchSize])
+}
+
+func TestSubscriptionSvc_Import_AtomicSkipsOthers(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	calls := 0
+	db.CreateBatch = func(subs []model.CreateSubscription, atomic bool) ([]error, error) {
+		calls++
+		assert.True(t, atomic)
+		errs := make([]error, len(subs))
+		errs[1] = apperr.Conflict(apperr.CodeSubscriptionExists, "subscription exists")
+		return errs, nil
+	}
+	errs := s.Import(ctx, importRequests(ImportBatchSize+1), true)
+
+	assert.EqualValues(t, 1, calls)
+	assert.EqualValues(t, apperr.CodeImportRowSkipped, apperr.CodeOf(errs[0]))
+	assert.EqualValues(t, apperr.CodeSubscriptionExists, apperr.CodeOf(errs[1]))
+	assert.EqualValues(t, apperr.CodeImportRowSkipped, apperr.CodeOf(errs[ImportBatchSize]))
+}
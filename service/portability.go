@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+	log "github.com/sirupsen/logrus"
+)
+
+type PortabilityRepoInterface interface {
+	RecordPortedOut(ctx context.Context, event model.PortabilityEvent, detectedAt time.Time) (bool, error)
+	FindPortabilityEvents(ctx context.Context, from, to time.Time) ([]model.PortabilityEvent, error)
+	FindOperatorChanges(ctx context.Context, from, to time.Time) ([]model.OperatorChange, error)
+}
+
+// PortedOutNotifier is told about every newly detected ported out number
+type PortedOutNotifier interface {
+	NotifyPortedOut(ctx context.Context, event model.PortabilityEvent) error
+}
+
+// PortabilityReconciler regularly compares the PTS operator of every activated subscription with the
+// expected operator, and records the numbers which are ported out. It can optionally move ported out
+// subscriptions to PortedOutStatus and notify a PortedOutNotifier.
+type PortabilityReconciler struct {
+	Log              *log.Logger
+	SubscriptionSvc  SubscriptionSvc
+	Repo             PortabilityRepoInterface
+	Locker           Locker
+	Interval         time.Duration
+	ExpectedOperator string
+	PortedOutStatus  model.SubStatus
+	Notifier         PortedOutNotifier
+	BatchSize        int
+
+	mu     sync.Mutex
+	status model.JobStatus
+}
+
+func NewPortabilityReconciler(log *log.Logger, svc SubscriptionSvc, repo PortabilityRepoInterface, locker Locker, interval time.Duration, expectedOperator string) *PortabilityReconciler {
+	return &PortabilityReconciler{
+		Log:              log,
+		SubscriptionSvc:  svc,
+		Repo:             repo,
+		Locker:           locker,
+		Interval:         interval,
+		ExpectedOperator: expectedOperator,
+		BatchSize:        100,
+		status:           model.JobStatus{Interval: interval.String()},
+	}
+}
+
+// Run reconciles every interval until ctx is done
+func (p *PortabilityReconciler) Run(ctx context.Context) {
+	p.setRunning(true)
+	defer p.setRunning(false)
+	p.Log.Infof("Portability reconciler started with interval %v, expecting operator %v", p.Interval, p.ExpectedOperator)
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		p.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			p.Log.Info("Portability reconciler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce checks every activated subscription and returns how many were newly found ported out
+func (p *PortabilityReconciler) RunOnce(ctx context.Context) (int, error) {
+	unlock, acquired, err := p.Locker.TryLock(ctx)
+	if err != nil {
+		p.Log.Errorf("Portability reconciler could not take lock: %v", err)
+		p.finishRun(0, 0, err)
+		return 0, err
+	}
+	if !acquired {
+		p.Log.Debug("Portability reconciler lock is held by another replica, skipping run")
+		p.mu.Lock()
+		p.status.SkippedRuns++
+		p.mu.Unlock()
+		return 0, nil
+	}
+	defer unlock()
+
+	var (
+		portedOut int
+		failed    int
+	)
+	filter := model.SubscriptionFilter{
+		Status: []model.SubStatus{model.StatusActivated},
+		Sort:   model.SortByMsisdn,
+		Order:  model.OrderAsc,
+		Limit:  p.BatchSize,
+	}
+	for {
+		subs, err := p.SubscriptionSvc.SubscriptionRepo.ListSubscriptions(ctx, filter)
+		if err != nil {
+			p.Log.Errorf("Portability reconciler could not list activated subscriptions: %v", err)
+			p.finishRun(portedOut, failed, err)
+			return portedOut, err
+		}
+		for _, sub := range subs {
+			recorded, err := p.reconcile(ctx, sub)
+			if err != nil {
+				// PTS is most likely down, the remaining numbers are checked by the next run
+				p.Log.Errorf("Portability reconciler stopping run at msisdn %v: %v", sub.Msisdn, err)
+				p.finishRun(portedOut, failed+1, err)
+				return portedOut, err
+			}
+			if recorded {
+				portedOut++
+			}
+		}
+		if len(subs) < p.BatchSize {
+			break
+		}
+		last := subs[len(subs)-1]
+		filter.After = &model.ListCursor{Sort: filter.Sort, Order: filter.Order, Value: last.Msisdn, Msisdn: last.Msisdn}
+	}
+	if portedOut > 0 {
+		p.Log.Infof("Portability reconciler run finished: %d numbers newly ported out", portedOut)
+	}
+	p.finishRun(portedOut, failed, nil)
+	return portedOut, nil
+}
+
+// reconcile checks one subscription and returns whether it was newly recorded as ported out
+func (p *PortabilityReconciler) reconcile(ctx context.Context, sub model.Subscription) (bool, error) {
+	ptsResponse, err := p.SubscriptionSvc.PtsClient.GetOperatorDetails(ctx, sub.Msisdn)
+	if err != nil {
+		return false, err
+	}
+	operator := ptsResponse.D.Name
+	now := timeNow()
+	if operator != sub.Operator {
+		err = p.SubscriptionSvc.SubscriptionRepo.UpdateOperator(ctx, sub.Msisdn, operator, now)
+		if err != nil {
+			p.Log.Errorf("Portability reconciler could not store operator for msisdn %v: %v", sub.Msisdn, err)
+		}
+	}
+	if operator == p.ExpectedOperator {
+		return false, nil
+	}
+
+	event := model.PortabilityEvent{
+		Msisdn:           sub.Msisdn,
+		ExpectedOperator: p.ExpectedOperator,
+		Operator:         operator,
+		DetectedAt:       now.Format(time.RFC3339),
+	}
+	recorded, err := p.Repo.RecordPortedOut(ctx, event, now)
+	if err != nil {
+		return false, err
+	}
+	if !recorded {
+		return false, nil
+	}
+	p.Log.Warnf("Portability reconciler found msisdn %v ported out to %v", sub.Msisdn, operator)
+
+	if p.PortedOutStatus != "" {
+		_, err := p.SubscriptionSvc.Update(ctx, model.CreateSubscription{
+			Msisdn:     sub.Msisdn,
+			ActivateAt: sub.ActivateAt,
+			SubType:    sub.SubType,
+			Status:     p.PortedOutStatus,
+			Actor:      "portability-reconciler",
+			Reason:     "number ported out to " + operator,
+		})
+		if err != nil {
+			p.Log.Errorf("Portability reconciler could not change status of msisdn %v to %v: %v", sub.Msisdn, p.PortedOutStatus, err)
+		}
+	}
+	if p.Notifier != nil {
+		err := p.Notifier.NotifyPortedOut(ctx, event)
+		if err != nil {
+			p.Log.Errorf("Portability reconciler could not notify about msisdn %v: %v", sub.Msisdn, err)
+		}
+	}
+	return true, nil
+}
+
+// Report returns the ported out numbers and operator changes detected from (inclusive) to (exclusive)
+func (p *PortabilityReconciler) Report(ctx context.Context, from, to time.Time) (model.PortabilityReport, error) {
+	events, err := p.Repo.FindPortabilityEvents(ctx, from, to)
+	if err != nil {
+		p.Log.Errorf("Could not find portability events due to error: %v", err)
+		return model.PortabilityReport{}, err
+	}
+	changes, err := p.Repo.FindOperatorChanges(ctx, from, to)
+	if err != nil {
+		p.Log.Errorf("Could not find operator changes due to error: %v", err)
+		return model.PortabilityReport{}, err
+	}
+	return model.PortabilityReport{
+		From:            from.Format(time.RFC3339),
+		To:              to.Format(time.RFC3339),
+		PortedOut:       events,
+		OperatorChanges: changes,
+	}, nil
+}
+
+// Status returns a snapshot of what the reconciler has done so far
+func (p *PortabilityReconciler) Status() model.JobStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *PortabilityReconciler) setRunning(running bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Running = running
+}
+
+func (p *PortabilityReconciler) finishRun(processed, failed int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Runs++
+	p.status.LastRunAt = timeNow().Format(time.RFC3339)
+	p.status.LastProcessed = processed
+	p.status.TotalProcessed += processed
+	p.status.TotalFailed += failed
+	p.status.LastError = ""
+	if err != nil {
+		p.status.LastError = err.Error()
+	}
+}
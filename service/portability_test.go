@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPortabilityReconciler() (*PortabilityReconciler, *mock.DbMock, *mock.ClientMock, *mock.NotifierMock) {
+	log := logrus.New()
+	log.SetOutput(os.Stdout)
+	svc, db, pts := setupSubscriptionSvc()
+	notifier := &mock.NotifierMock{}
+	p := NewPortabilityReconciler(log, svc, db, &mock.LockMock{}, time.Hour, "Telness AB")
+	p.Notifier = notifier
+	return p, db, pts, notifier
+}
+
+func TestPortabilityReconciler_RunOnce_RecordsPortedOut(t *testing.T) {
+	t.Parallel()
+	p, db, pts, notifier := setupPortabilityReconciler()
+	p.PortedOutStatus = model.StatusPaused
+	active := map[string]model.Subscription{
+		"+46107500500": {Msisdn: "+46107500500", ActivateAt: now, SubType: "cell", Status: model.StatusActivated, Operator: "Telness AB"},
+		"+46107500501": {Msisdn: "+46107500501", ActivateAt: now, SubType: "pbx", Status: model.StatusActivated, Operator: "Telness AB"},
+	}
+	db.List = func(filter model.SubscriptionFilter) ([]model.Subscription, error) {
+		assert.EqualValues(t, []model.SubStatus{model.StatusActivated}, filter.Status)
+		return []model.Subscription{active["+46107500500"], active["+46107500501"]}, nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		if msisdn == "+46107500501" {
+			return model.PtsResponse{D: model.OperatorDetails{Name: "Tele2 Sverige AB"}}, nil
+		}
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+	var recorded []model.PortabilityEvent
+	db.PortedOut = func(event model.PortabilityEvent, detectedAt time.Time) (bool, error) {
+		recorded = append(recorded, event)
+		return true, nil
+	}
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return active[msisdn], nil
+	}
+	var updated model.CreateSubscription
+	db.Update = func(sub model.CreateSubscription) error {
+		updated = sub
+		return nil
+	}
+	var notified []model.PortabilityEvent
+	notifier.Notify = func(event model.PortabilityEvent) error {
+		notified = append(notified, event)
+		return nil
+	}
+
+	portedOut, err := p.RunOnce(ctx)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, portedOut)
+	assert.Len(t, recorded, 1)
+	assert.EqualValues(t, "+46107500501", recorded[0].Msisdn)
+	assert.EqualValues(t, "Tele2 Sverige AB", recorded[0].Operator)
+	assert.EqualValues(t, "Telness AB", recorded[0].ExpectedOperator)
+	assert.EqualValues(t, "+46107500501", updated.Msisdn)
+	assert.EqualValues(t, model.StatusPaused, updated.Status)
+	assert.Len(t, notified, 1)
+}
+
+func TestPortabilityReconciler_RunOnce_AlreadyRecorded(t *testing.T) {
+	t.Parallel()
+	p, db, pts, notifier := setupPortabilityReconciler()
+	db.List = func(filter model.SubscriptionFilter) ([]model.Subscription, error) {
+		return []model.Subscription{{Msisdn: msisdn, Status: model.StatusActivated, Operator: "Tele2 Sverige AB"}}, nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Tele2 Sverige AB"}}, nil
+	}
+	db.PortedOut = func(event model.PortabilityEvent, detectedAt time.Time) (bool, error) {
+		return false, nil
+	}
+
+	portedOut, err := p.RunOnce(ctx)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, portedOut)
+	notifier.AssertNotCalled(t, "NotifyPortedOut")
+}
+
+func TestPortabilityReconciler_RunOnce_StopsWhenPtsFails(t *testing.T) {
+	t.Parallel()
+	p, db, pts, _ := setupPortabilityReconciler()
+	db.List = func(filter model.SubscriptionFilter) ([]model.Subscription, error) {
+		return []model.Subscription{{Msisdn: msisdn, Status: model.StatusActivated}}, nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts timeout")
+	}
+
+	_, err := p.RunOnce(ctx)
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, "pts timeout", p.Status().LastError)
+}
+
+func TestPortabilityReconciler_Report(t *testing.T) {
+	t.Parallel()
+	p, db, _, _ := setupPortabilityReconciler()
+	from := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	db.FindPorted = func(f, tt time.Time) ([]model.PortabilityEvent, error) {
+		assert.EqualValues(t, from, f)
+		assert.EqualValues(t, to, tt)
+		return []model.PortabilityEvent{{Msisdn: msisdn, Operator: "Tele2 Sverige AB"}}, nil
+	}
+	db.FindChanges = func(f, tt time.Time) ([]model.OperatorChange, error) {
+		return []model.OperatorChange{{Msisdn: msisdn, PreviousOperator: "Telness AB", Operator: "Tele2 Sverige AB"}}, nil
+	}
+
+	report, err := p.Report(ctx, from, to)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "2021-10-01T00:00:00Z", report.From)
+	assert.Len(t, report.PortedOut, 1)
+	assert.Len(t, report.OperatorChanges, 1)
+}
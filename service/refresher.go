@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+	log "github.com/sirupsen/logrus"
+)
+
+type OperatorRefreshRepoInterface interface {
+	FindSubscriptionsWithStaleOperator(ctx context.Context, checkedBefore time.Time, limit int) ([]model.Subscription, error)
+	UpdateOperator(ctx context.Context, msisdn string, operator string, checkedAt time.Time) error
+}
+
+// OperatorRefresher regularly asks PTS again for the operator of subscriptions whose stored
+// operator is older than MaxAge, so stored operators can be shown without live PTS calls
+type OperatorRefresher struct {
+	Log       *log.Logger
+	Repo      OperatorRefreshRepoInterface
+	PtsClient PtsClientInterface
+	Locker    Locker
+	Interval  time.Duration
+	MaxAge    time.Duration
+	BatchSize int
+
+	mu     sync.Mutex
+	status model.JobStatus
+}
+
+func NewOperatorRefresher(log *log.Logger, repo OperatorRefreshRepoInterface, ptsClient PtsClientInterface, locker Locker, interval, maxAge time.Duration) *OperatorRefresher {
+	return &OperatorRefresher{
+		Log:       log,
+		Repo:      repo,
+		PtsClient: ptsClient,
+		Locker:    locker,
+		Interval:  interval,
+		MaxAge:    maxAge,
+		BatchSize: 100,
+		status:    model.JobStatus{Interval: interval.String()},
+	}
+}
+
+// Run refreshes stale operators every interval until ctx is done
+func (r *OperatorRefresher) Run(ctx context.Context) {
+	r.setRunning(true)
+	defer r.setRunning(false)
+	r.Log.Infof("Operator refresher started with interval %v and max age %v", r.Interval, r.MaxAge)
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		r.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			r.Log.Info("Operator refresher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce refreshes the operator of all subscriptions checked longer than MaxAge ago and
+// returns how many were refreshed. The run stops at the first failing PTS lookup, PTS is
+// most likely down and the remaining rows are picked up by the next run.
+func (r *OperatorRefresher) RunOnce(ctx context.Context) (int, error) {
+	unlock, acquired, err := r.Locker.TryLock(ctx)
+	if err != nil {
+		r.Log.Errorf("Operator refresher could not take lock: %v", err)
+		r.finishRun(0, 0, err)
+		return 0, err
+	}
+	if !acquired {
+		r.Log.Debug("Operator refresher lock is held by another replica, skipping run")
+		r.mu.Lock()
+		r.status.SkippedRuns++
+		r.mu.Unlock()
+		return 0, nil
+	}
+	defer unlock()
+
+	var (
+		refreshed int
+		failed    int
+	)
+	checkedBefore := timeNow().Add(-r.MaxAge)
+	for {
+		stale, err := r.Repo.FindSubscriptionsWithStaleOperator(ctx, checkedBefore, r.BatchSize)
+		if err != nil {
+			r.Log.Errorf("Operator refresher could not find subscriptions with stale operator: %v", err)
+			r.finishRun(refreshed, failed, err)
+			return refreshed, err
+		}
+		for _, sub := range stale {
+			ptsResponse, err := r.PtsClient.GetOperatorDetails(ctx, sub.Msisdn)
+			if err != nil {
+				r.Log.Errorf("Operator refresher could not find operator for msisdn %v, stopping run: %v", sub.Msisdn, err)
+				r.finishRun(refreshed, failed+1, err)
+				return refreshed, err
+			}
+			err = r.Repo.UpdateOperator(ctx, sub.Msisdn, ptsResponse.D.Name, timeNow())
+			if err != nil {
+				r.Log.Errorf("Operator refresher could not store operator for msisdn %v: %v", sub.Msisdn, err)
+				failed++
+				continue
+			}
+			if sub.Operator != "" && sub.Operator != ptsResponse.D.Name {
+				r.Log.Infof("Operator refresher found msisdn %v ported from %v to %v", sub.Msisdn, sub.Operator, ptsResponse.D.Name)
+			}
+			refreshed++
+		}
+		// refreshed rows are not stale anymore, a batch which is not full is the last one
+		if len(stale) < r.BatchSize || failed > 0 {
+			break
+		}
+	}
+	if refreshed > 0 || failed > 0 {
+		r.Log.Infof("Operator refresher run finished: %d refreshed, %d failed", refreshed, failed)
+	}
+	r.finishRun(refreshed, failed, nil)
+	return refreshed, nil
+}
+
+// Status returns a snapshot of what the refresher has done so far
+func (r *OperatorRefresher) Status() model.JobStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func (r *OperatorRefresher) setRunning(running bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Running = running
+}
+
+func (r *OperatorRefresher) finishRun(processed, failed int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.Runs++
+	r.status.LastRunAt = timeNow().Format(time.RFC3339)
+	r.status.LastProcessed = processed
+	r.status.TotalProcessed += processed
+	r.status.TotalFailed += failed
+	r.status.LastError = ""
+	if err != nil {
+		r.status.LastError = err.Error()
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupOperatorRefresher() (*OperatorRefresher, *mock.DbMock, *mock.ClientMock) {
+	log := logrus.New()
+	log.SetOutput(os.Stdout)
+	db := &mock.DbMock{}
+	pts := &mock.ClientMock{}
+	return NewOperatorRefresher(log, db, pts, &mock.LockMock{}, time.Minute, 24*time.Hour), db, pts
+}
+
+func TestOperatorRefresher_RunOnce_RefreshesStaleOperators(t *testing.T) {
+	t.Parallel()
+	r, db, pts := setupOperatorRefresher()
+	stale := []model.Subscription{
+		{Msisdn: "+46107500500", Status: model.StatusActivated, Operator: "Telness AB"},
+		{Msisdn: "+46107500501", Status: model.StatusPending},
+	}
+	db.FindStale = func(checkedBefore time.Time, limit int) ([]model.Subscription, error) {
+		assert.WithinDuration(t, time.Now().Add(-24*time.Hour), checkedBefore, time.Minute)
+		return stale, nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Tele2 Sverige AB"}}, nil
+	}
+	stored := map[string]string{}
+	db.SetOperator = func(msisdn string, operator string, checkedAt time.Time) error {
+		stored[msisdn] = operator
+		return nil
+	}
+
+	refreshed, err := r.RunOnce(ctx)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, refreshed)
+	assert.EqualValues(t, "Tele2 Sverige AB", stored["+46107500500"])
+	assert.EqualValues(t, "Tele2 Sverige AB", stored["+46107500501"])
+	assert.EqualValues(t, 2, r.Status().TotalProcessed)
+}
+
+func TestOperatorRefresher_RunOnce_StopsWhenPtsFails(t *testing.T) {
+	t.Parallel()
+	r, db, pts := setupOperatorRefresher()
+	db.FindStale = func(checkedBefore time.Time, limit int) ([]model.Subscription, error) {
+		return []model.Subscription{{Msisdn: "+46107500500"}, {Msisdn: "+46107500501"}}, nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts circuit breaker is open")
+	}
+
+	refreshed, err := r.RunOnce(ctx)
+
+	assert.NotNil(t, err)
+	assert.EqualValues(t, 0, refreshed)
+	pts.AssertCallCount(t, "GetOperatorDetails", 1)
+	db.AssertNotCalled(t, "UpdateOperator")
+	assert.EqualValues(t, "pts circuit breaker is open", r.Status().LastError)
+}
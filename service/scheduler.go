@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+	log "github.com/sirupsen/logrus"
+)
+
+type ActivationRepoInterface interface {
+	FindDuePendingSubscriptions(ctx context.Context, now time.Time, limit int) ([]model.Subscription, error)
+}
+
+// Locker makes sure only one replica runs a job at a time
+type Locker interface {
+	// TryLock returns acquired false without error when another replica holds the lock
+	TryLock(ctx context.Context) (unlock func(), acquired bool, err error)
+}
+
+// Scheduler regularly moves pending subscriptions whose activate_at is reached to activated
+type Scheduler struct {
+	Log             *log.Logger
+	SubscriptionSvc SubscriptionSvc
+	ActivationRepo  ActivationRepoInterface
+	Locker          Locker
+	Interval        time.Duration
+	BatchSize       int
+
+	mu     sync.Mutex
+	status model.SchedulerStatus
+}
+
+func NewScheduler(log *log.Logger, svc SubscriptionSvc, repo ActivationRepoInterface, locker Locker, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		Log:             log,
+		SubscriptionSvc: svc,
+		ActivationRepo:  repo,
+		Locker:          locker,
+		Interval:        interval,
+		BatchSize:       100,
+		status: model.SchedulerStatus{
+			Interval:             interval.String(),
+			LastActivatedMsisdns: []string{},
+		},
+	}
+}
+
+// Run activates due subscriptions every interval until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	s.setRunning(true)
+	defer s.setRunning(false)
+	s.Log.Infof("Activation scheduler started with interval %v", s.Interval)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			s.Log.Info("Activation scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce activates all pending subscriptions whose activation date is reached and returns how many were activated
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	unlock, acquired, err := s.Locker.TryLock(ctx)
+	if err != nil {
+		s.Log.Errorf("Activation scheduler could not take lock: %v", err)
+		s.finishRun(nil, 0, err)
+		return 0, err
+	}
+	if !acquired {
+		s.Log.Debug("Activation scheduler lock is held by another replica, skipping run")
+		s.mu.Lock()
+		s.status.SkippedRuns++
+		s.mu.Unlock()
+		return 0, nil
+	}
+	defer unlock()
+
+	var (
+		activated []string
+		failed    int
+	)
+	for {
+		due, err := s.ActivationRepo.FindDuePendingSubscriptions(ctx, timeNow(), s.BatchSize)
+		if err != nil {
+			s.Log.Errorf("Activation scheduler could not find due subscriptions: %v", err)
+			s.finishRun(activated, failed, err)
+			return len(activated), err
+		}
+		progressed := false
+		for _, sub := range due {
+			_, err := s.SubscriptionSvc.Update(ctx, model.CreateSubscription{
+				Msisdn:     sub.Msisdn,
+				ActivateAt: sub.ActivateAt,
+				SubType:    sub.SubType,
+				Status:     model.StatusActivated,
+				Actor:      "activation-scheduler",
+				Reason:     "activate_at reached",
+			})
+			if err != nil {
+				s.Log.Errorf("Activation scheduler could not activate subscription with msisdn %v: %v", sub.Msisdn, err)
+				failed++
+				continue
+			}
+			s.Log.Infof("Activation scheduler activated subscription with msisdn %v", sub.Msisdn)
+			activated = append(activated, sub.Msisdn)
+			progressed = true
+		}
+		// stop when the last batch was not full or nothing could be activated, failing rows would be fetched again
+		if len(due) < s.BatchSize || !progressed {
+			break
+		}
+	}
+	if len(activated) > 0 || failed > 0 {
+		s.Log.Infof("Activation scheduler run finished: %d activated, %d failed", len(activated), failed)
+	}
+	s.finishRun(activated, failed, nil)
+	return len(activated), nil
+}
+
+// Status returns a snapshot of what the scheduler has done so far
+func (s *Scheduler) Status() model.SchedulerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.LastActivatedMsisdns = append([]string{}, s.status.LastActivatedMsisdns...)
+	return status
+}
+
+func (s *Scheduler) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Running = running
+}
+
+func (s *Scheduler) finishRun(activated []string, failed int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Runs++
+	s.status.LastRunAt = timeNow().Format(time.RFC3339)
+	s.status.LastActivated = len(activated)
+	s.status.LastActivatedMsisdns = append([]string{}, activated...)
+	s.status.TotalActivated += len(activated)
+	s.status.TotalFailed += failed
+	s.status.LastError = ""
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
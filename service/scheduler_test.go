@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/mock"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupScheduler() (*Scheduler, *mock.DbMock, *mock.ClientMock, *mock.LockMock) {
+	log := logrus.New()
+	log.SetOutput(os.Stdout)
+	svc, db, pts := setupSubscriptionSvc()
+	lock := &mock.LockMock{}
+	return NewScheduler(log, svc, db, lock, time.Minute), db, pts, lock
+}
+
+func TestScheduler_RunOnce_ActivatesDueSubscriptions(t *testing.T) {
+	t.Parallel()
+	s, db, pts, lock := setupScheduler()
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	stored := map[string]model.Subscription{
+		"+46107500500": {Msisdn: "+46107500500", ActivateAt: yesterday, SubType: "cell", Status: model.StatusPending},
+		"+46107500501": {Msisdn: "+46107500501", ActivateAt: yesterday, SubType: "pbx", Status: model.StatusPending},
+	}
+	unlocked := false
+	lock.Acquire = func() (func(), bool, error) {
+		return func() { unlocked = true }, true, nil
+	}
+	db.FindDue = func(now time.Time, limit int) ([]model.Subscription, error) {
+		var due []model.Subscription
+		for _, sub := range stored {
+			if sub.Status == model.StatusPending {
+				due = append(due, sub)
+			}
+		}
+		return due, nil
+	}
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return stored[msisdn], nil
+	}
+	db.Update = func(sub model.CreateSubscription) error {
+		found := stored[sub.Msisdn]
+		found.Status = sub.Status
+		stored[sub.Msisdn] = found
+		return nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+
+	activated, err := s.RunOnce(ctx)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2, activated)
+	assert.True(t, unlocked)
+	assert.EqualValues(t, model.StatusActivated, stored["+46107500500"].Status)
+	assert.EqualValues(t, model.StatusActivated, stored["+46107500501"].Status)
+	status := s.Status()
+	assert.EqualValues(t, 1, status.Runs)
+	assert.EqualValues(t, 2, status.TotalActivated)
+	assert.ElementsMatch(t, []string{"+46107500500", "+46107500501"}, status.LastActivatedMsisdns)
+}
+
+func TestScheduler_RunOnce_SkipsWhenLockIsHeld(t *testing.T) {
+	t.Parallel()
+	s, db, _, lock := setupScheduler()
+	lock.Acquire = func() (func(), bool, error) {
+		return nil, false, nil
+	}
+
+	activated, err := s.RunOnce(ctx)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, activated)
+	lock.AssertCallCount(t, "TryLock", 1)
+	db.AssertNotCalled(t, "FindDuePendingSubscriptions")
+	assert.EqualValues(t, 1, s.Status().SkippedRuns)
+	assert.EqualValues(t, 0, s.Status().Runs)
+}
+
+func TestScheduler_RunOnce_ReportsFailures(t *testing.T) {
+	t.Parallel()
+	s, db, _, _ := setupScheduler()
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	db.FindDue = func(now time.Time, limit int) ([]model.Subscription, error) {
+		return []model.Subscription{{Msisdn: msisdn, ActivateAt: yesterday, SubType: "cell", Status: model.StatusPending}}, nil
+	}
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{Msisdn: msisdn, ActivateAt: yesterday, SubType: "cell", Status: model.StatusPending}, nil
+	}
+	db.Update = func(sub model.CreateSubscription) error {
+		return errors.New("db is down")
+	}
+
+	activated, err := s.RunOnce(ctx)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, activated)
+	assert.EqualValues(t, 1, s.Status().TotalFailed)
+}
@@ -1,67 +1,275 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
 	"github.com/pmadhvi/telness-manager/model"
 	log "github.com/sirupsen/logrus"
 )
 
 type SubscriptionRepoInterface interface {
-	CreateSubscription(sub model.CreateSubscription) error
-	FindSubscriptionbyID(id string) (model.Subscription, error)
-	UpdateSubscription(sub model.CreateSubscription) error
+	CreateSubscription(ctx context.Context, sub model.CreateSubscription) error
+	CreateSubscriptions(ctx context.Context, subs []model.CreateSubscription, atomic bool) ([]error, error)
+	FindSubscriptionbyID(ctx context.Context, id string) (model.Subscription, error)
+	UpdateSubscription(ctx context.Context, sub model.CreateSubscription) error
+	FindSubscriptionHistory(ctx context.Context, msisdn string, limit, offset int) ([]model.SubscriptionHistory, error)
+	ListSubscriptions(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error)
+	StreamSubscriptions(ctx context.Context, filter model.SubscriptionFilter, fn func(model.Subscription) error) error
+	UpdateOperator(ctx context.Context, msisdn string, operator string, checkedAt time.Time) error
 }
 
 type PtsClientInterface interface {
-	GetOperatorDetails(msisdn string) (model.PtsResponse, error)
+	GetOperatorDetails(ctx context.Context, msisdn string) (model.PtsResponse, error)
 }
 
 type SubscriptionSvc struct {
 	Log              *log.Logger
 	SubscriptionRepo SubscriptionRepoInterface
 	PtsClient        PtsClientInterface
+	// OperatorMaxAge is how long a stored operator counts as confirmed, by default 24h
+	OperatorMaxAge time.Duration
 }
 
-func (s SubscriptionSvc) Create(subreq model.CreateSubscription) (model.Subscription, error) {
-	err := s.SubscriptionRepo.CreateSubscription(subreq)
+// defaultOperatorMaxAge is the OperatorMaxAge of a service without one
+const defaultOperatorMaxAge = 24 * time.Hour
+
+func (s SubscriptionSvc) Create(ctx context.Context, subreq model.CreateSubscription) (model.Subscription, error) {
+	if subreq.ValidateOnly {
+		return s.validateCreate(ctx, subreq)
+	}
+	err := s.SubscriptionRepo.CreateSubscription(ctx, subreq)
 	if err != nil {
 		s.Log.Errorf("Could not create subscription due to error: %v", err)
 		return model.Subscription{}, err
 	}
-	sub, err := s.FindbyID(subreq.Msisdn)
+	sub, err := s.FindbyID(ctx, subreq.Msisdn)
 	if err != nil {
 		s.Log.Errorf("Could not find created subscription due to error: %v", err)
 		return model.Subscription{}, err
 	}
+	// the operator found for a new subscription is stored with it, later the OperatorRefresher keeps it up to date
+	if sub.OperatorStatus == model.OperatorStatusOK {
+		checkedAt := timeNow()
+		if err := s.SubscriptionRepo.UpdateOperator(ctx, sub.Msisdn, sub.Operator, checkedAt); err != nil {
+			s.Log.Errorf("Could not store operator for subscription with msisdn %v due to error: %v", sub.Msisdn, err)
+		} else {
+			sub.OperatorCheckedAt = checkedAt.Format(time.RFC3339Nano)
+		}
+	}
 	return sub, nil
 }
 
-func (s SubscriptionSvc) FindbyID(msisdn string) (model.Subscription, error) {
-	var sub model.Subscription
-	sub, err := s.SubscriptionRepo.FindSubscriptionbyID(msisdn)
+// validateCreate checks that the subscription can be created and returns it as it would be stored
+func (s SubscriptionSvc) validateCreate(ctx context.Context, subreq model.CreateSubscription) (model.Subscription, error) {
+	_, err := s.SubscriptionRepo.FindSubscriptionbyID(ctx, subreq.Msisdn)
+	switch {
+	case err == nil:
+		return model.Subscription{}, apperr.AlreadyExists(apperr.CodeSubscriptionExists, nil, "subscription with msisdn %v already exists", subreq.Msisdn)
+	case !errors.Is(err, apperr.ErrNotFound):
+		s.Log.Errorf("Could not check subscription to create due to error: %v", err)
+		return model.Subscription{}, err
+	}
+	return model.Subscription{
+		Msisdn:     subreq.Msisdn,
+		ActivateAt: subreq.ActivateAt,
+		SubType:    subreq.SubType,
+		Status:     subreq.Status,
+	}, nil
+}
+
+// FindbyID returns the subscription enriched with its operator. The operator lookup is best-effort,
+// when PTS cannot be reached the last known operator from storage is returned. The operator found
+// is not stored, a read never writes; keeping the stored operators up to date is left to the
+// OperatorRefresher.
+func (s SubscriptionSvc) FindbyID(ctx context.Context, msisdn string) (model.Subscription, error) {
+	sub, err := s.SubscriptionRepo.FindSubscriptionbyID(ctx, msisdn)
 	if err != nil {
 		s.Log.Errorf("Could not find subscription by id %v due to error: %v", msisdn, err)
 		return model.Subscription{}, err
 	}
-	var ptsResponse model.PtsResponse
-	ptsResponse, err = s.PtsClient.GetOperatorDetails(msisdn)
+	return s.lookupOperator(ctx, sub), nil
+}
+
+// lookupOperator sets the operator of the subscription as found at PTS. When PTS cannot be reached
+// the last known operator from storage is kept and marked stale.
+func (s SubscriptionSvc) lookupOperator(ctx context.Context, sub model.Subscription) model.Subscription {
+	ptsResponse, err := s.PtsClient.GetOperatorDetails(ctx, sub.Msisdn)
 	if err != nil {
-		s.Log.Errorf("Could not find operator details for subscription with msisdn %v due to error: %v", msisdn, err)
-		return sub, err
+		s.Log.Warnf("Could not find operator details for subscription with msisdn %v due to error: %v", sub.Msisdn, err)
+		sub.OperatorStatus = model.OperatorStatusUnknown
+		if sub.Operator != "" {
+			sub.OperatorStatus = model.OperatorStatusStale
+		}
+		return sub
 	}
 	sub.Operator = ptsResponse.D.Name
-	return sub, nil
+	sub.OperatorStatus = model.OperatorStatusOK
+	return sub
 }
 
-func (s SubscriptionSvc) Update(subreq model.CreateSubscription) (model.Subscription, error) {
-	err := s.SubscriptionRepo.UpdateSubscription(subreq)
+// storedOperator sets the operator status of the operator from storage: ok when PTS confirmed it
+// less than OperatorMaxAge ago, stale when longer ago and unknown when no operator is known
+func (s SubscriptionSvc) storedOperator(sub model.Subscription) model.Subscription {
+	maxAge := s.OperatorMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultOperatorMaxAge
+	}
+	sub.OperatorStatus = model.OperatorStatusUnknown
+	if sub.Operator == "" {
+		return sub
+	}
+	sub.OperatorStatus = model.OperatorStatusStale
+	checkedAt, err := time.Parse(time.RFC3339Nano, sub.OperatorCheckedAt)
+	if err == nil && timeNow().Sub(checkedAt) < maxAge {
+		sub.OperatorStatus = model.OperatorStatusOK
+	}
+	return sub
+}
+
+func (s SubscriptionSvc) Update(ctx context.Context, subreq model.CreateSubscription) (model.Subscription, error) {
+	current, err := s.SubscriptionRepo.FindSubscriptionbyID(ctx, subreq.Msisdn)
+	if err != nil {
+		s.Log.Errorf("Could not find subscription to update due to error: %v", err)
+		return model.Subscription{}, err
+	}
+	// fail early on a stale version, the repository checks it again while the row is locked
+	if subreq.ExpectedVersion != 0 && subreq.ExpectedVersion != current.Version {
+		err = apperr.VersionMismatch(subreq.Msisdn, subreq.ExpectedVersion, current.Version)
+		s.Log.Errorf("Could not update subscription with msisdn %v: %v", subreq.Msisdn, err)
+		return model.Subscription{}, err
+	}
+	err = checkTransition(current, subreq.Status)
+	if err != nil {
+		s.Log.Errorf("Could not update subscription with msisdn %v: %v", subreq.Msisdn, err)
+		return model.Subscription{}, err
+	}
+	if subreq.ValidateOnly {
+		current.ActivateAt = subreq.ActivateAt
+		current.SubType = subreq.SubType
+		current.Status = subreq.Status
+		return current, nil
+	}
+	// the transition was checked on the version read above, a change made since must not be
+	// overwritten, also when the caller changes any version
+	if subreq.ExpectedVersion == 0 {
+		subreq.ExpectedVersion = current.Version
+	}
+	err = s.SubscriptionRepo.UpdateSubscription(ctx, subreq)
 	if err != nil {
 		s.Log.Errorf("Could not update subscription due to error: %v", err)
 		return model.Subscription{}, err
 	}
-	sub, err := s.FindbyID(subreq.Msisdn)
+	sub, err := s.FindbyID(ctx, subreq.Msisdn)
 	if err != nil {
 		s.Log.Errorf("Could not find updated subscription due to error: %v", err)
 		return model.Subscription{}, err
 	}
 	return sub, nil
 }
+
+// AllowedTransitions returns the status of the subscription with given msisdn and the statuses it
+// can move to right now, from one read of the repository
+func (s SubscriptionSvc) AllowedTransitions(ctx context.Context, msisdn string) (model.AllowedTransitions, error) {
+	sub, err := s.SubscriptionRepo.FindSubscriptionbyID(ctx, msisdn)
+	if err != nil {
+		s.Log.Errorf("Could not find subscription by id %v due to error: %v", msisdn, err)
+		return model.AllowedTransitions{}, err
+	}
+	return model.AllowedTransitions{
+		Msisdn:  sub.Msisdn,
+		Status:  sub.Status,
+		Allowed: AllowedTransitions(sub),
+	}, nil
+}
+
+// Transitions returns the complete status transition table
+func (s SubscriptionSvc) Transitions() map[model.SubStatus][]model.SubStatus {
+	return Transitions()
+}
+
+// History returns one page of the changes made to the subscription with given msisdn, newest first
+func (s SubscriptionSvc) History(ctx context.Context, msisdn string, limit, offset int) (model.HistoryPage, error) {
+	_, err := s.SubscriptionRepo.FindSubscriptionbyID(ctx, msisdn)
+	if err != nil {
+		s.Log.Errorf("Could not find subscription by id %v due to error: %v", msisdn, err)
+		return model.HistoryPage{}, err
+	}
+	// fetch one extra entry to know if there is a next page
+	history, err := s.SubscriptionRepo.FindSubscriptionHistory(ctx, msisdn, limit+1, offset)
+	if err != nil {
+		s.Log.Errorf("Could not find history for subscription %v due to error: %v", msisdn, err)
+		return model.HistoryPage{}, err
+	}
+	page := model.HistoryPage{
+		Msisdn:  msisdn,
+		History: history,
+		Limit:   limit,
+		Offset:  offset,
+	}
+	if len(history) > limit {
+		page.History = history[:limit]
+		page.HasMore = true
+	}
+	return page, nil
+}
+
+// List returns one page of subscriptions matching the filter. Operator details are not looked up
+// for listed subscriptions, a page must not turn into one PTS call per row.
+func (s SubscriptionSvc) List(ctx context.Context, filter model.SubscriptionFilter) (model.SubscriptionPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = model.SortByCreatedAt
+	}
+	if filter.Order == "" {
+		filter.Order = model.OrderAsc
+	}
+	err := validateFilter(filter)
+	if err == nil && filter.Limit < 1 {
+		err = apperr.Validation("limit must be positive")
+	}
+	if err != nil {
+		s.Log.Errorf("Could not list subscriptions: %v", err)
+		return model.SubscriptionPage{}, err
+	}
+	limit := filter.Limit
+	// fetch one extra subscription to know if there is a next page
+	filter.Limit = limit + 1
+	subs, err := s.SubscriptionRepo.ListSubscriptions(ctx, filter)
+	if err != nil {
+		s.Log.Errorf("Could not list subscriptions due to error: %v", err)
+		return model.SubscriptionPage{}, err
+	}
+	page := model.SubscriptionPage{Subscriptions: subs}
+	if len(subs) > limit {
+		page.Subscriptions = subs[:limit]
+		last := page.Subscriptions[limit-1]
+		page.NextCursor = model.ListCursor{
+			Sort:   filter.Sort,
+			Order:  filter.Order,
+			Value:  last.SortValue(filter.Sort),
+			Msisdn: last.Msisdn,
+		}.Encode()
+	}
+	return page, nil
+}
+
+func validateFilter(filter model.SubscriptionFilter) error {
+	validSort := false
+	for _, field := range model.SortFields {
+		if filter.Sort == field {
+			validSort = true
+		}
+	}
+	if !validSort {
+		return apperr.Validation("cannot sort by %q", filter.Sort)
+	}
+	if filter.Order != model.OrderAsc && filter.Order != model.OrderDesc {
+		return apperr.Validation("order must be %v or %v", model.OrderAsc, model.OrderDesc)
+	}
+	if filter.After != nil && (filter.After.Sort != filter.Sort || filter.After.Order != filter.Order) {
+		return apperr.Validation("cursor was created for another sort order")
+	}
+	return nil
+}
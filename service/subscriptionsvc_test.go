@@ -1,9 +1,11 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"os"
 
+	"github.com/pmadhvi/telness-manager/apperr"
 	"github.com/pmadhvi/telness-manager/mock"
 	"github.com/pmadhvi/telness-manager/model"
 	"github.com/sirupsen/logrus"
@@ -14,23 +16,32 @@ import (
 )
 
 var (
+	ctx    = context.Background()
 	msisdn = "+46107500500"
 	now    = time.Now().Format("2006-01-02")
 )
 
-func setupSubscriptionSvc() SubscriptionSvc {
+// setupSubscriptionSvc returns a service on mocks of its own, so tests using it can run in parallel
+func setupSubscriptionSvc() (SubscriptionSvc, *mock.DbMock, *mock.ClientMock) {
 	log := logrus.New()
 	log.SetOutput(os.Stdout)
+	db := &mock.DbMock{}
+	db.SetOperator = func(msisdn string, operator string, checkedAt time.Time) error {
+		return nil
+	}
+	pts := &mock.ClientMock{}
 
 	return SubscriptionSvc{
 		Log:              log,
-		SubscriptionRepo: &mock.DbMock{},
-		PtsClient:        &mock.ClientMock{},
-	}
+		SubscriptionRepo: db,
+		PtsClient:        pts,
+	}, db, pts
 }
+
 func TestSubscriptionSvc_FindbyID_Success(t *testing.T) {
-	s := setupSubscriptionSvc()
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
 		return model.Subscription{
 			Msisdn:     msisdn,
 			ActivateAt: now,
@@ -40,12 +51,12 @@ func TestSubscriptionSvc_FindbyID_Success(t *testing.T) {
 			ModifiedAt: now,
 		}, nil
 	}
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
 		return model.PtsResponse{
 			D: model.OperatorDetails{Name: "Telness AB"},
 		}, nil
 	}
-	got, err := s.FindbyID(msisdn)
+	got, err := s.FindbyID(ctx, msisdn)
 	assert.NotNil(t, got)
 	assert.Nil(t, err)
 	assert.EqualValues(t, msisdn, got.Msisdn)
@@ -55,21 +66,66 @@ func TestSubscriptionSvc_FindbyID_Success(t *testing.T) {
 	assert.EqualValues(t, "Telness AB", got.Operator)
 }
 
+func TestSubscriptionSvc_FindbyID_DoesNotStoreOperator(t *testing.T) {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{Msisdn: msisdn, Status: "activated", Operator: "Telia Sverige AB"}, nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{D: model.OperatorDetails{Name: "Telness AB"}}, nil
+	}
+	got, err := s.FindbyID(ctx, msisdn)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, "Telness AB", got.Operator)
+	assert.EqualValues(t, model.OperatorStatusOK, got.OperatorStatus)
+	db.AssertNotCalled(t, "UpdateOperator")
+}
+
+func TestSubscriptionSvc_FindbyID_PtsUnavailable(t *testing.T) {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		return model.PtsResponse{}, errors.New("pts timeout")
+	}
+	tests := []struct {
+		storedOperator string
+		wantStatus     string
+	}{
+		{"Telness AB", model.OperatorStatusStale},
+		{"", model.OperatorStatusUnknown},
+	}
+	for _, tt := range tests {
+		db.FindByID = func(msisdn string) (model.Subscription, error) {
+			return model.Subscription{Msisdn: msisdn, Status: "activated", Operator: tt.storedOperator}, nil
+		}
+		got, err := s.FindbyID(ctx, msisdn)
+
+		assert.Nil(t, err)
+		assert.EqualValues(t, msisdn, got.Msisdn)
+		assert.EqualValues(t, tt.storedOperator, got.Operator)
+		assert.EqualValues(t, tt.wantStatus, got.OperatorStatus)
+	}
+}
+
 func TestSubscriptionSvc_FindbyID_NotFound(t *testing.T) {
-	s := setupSubscriptionSvc()
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
 		return model.Subscription{}, errors.New("subscription not found")
 	}
-	_, err := s.FindbyID(msisdn)
+	_, err := s.FindbyID(ctx, msisdn)
 	assert.NotNil(t, err)
 }
 
 func TestSubscriptionSvc_Update_Success(t *testing.T) {
-	s := setupSubscriptionSvc()
-	mock.Update = func(sub model.CreateSubscription) error {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	db.Update = func(sub model.CreateSubscription) error {
 		return nil
 	}
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
 		return model.Subscription{
 			Msisdn:     msisdn,
 			ActivateAt: now,
@@ -80,7 +136,7 @@ func TestSubscriptionSvc_Update_Success(t *testing.T) {
 			ModifiedAt: now,
 		}, nil
 	}
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
 		return model.PtsResponse{
 			D: model.OperatorDetails{Name: "Telness AB"},
 		}, nil
@@ -91,7 +147,7 @@ func TestSubscriptionSvc_Update_Success(t *testing.T) {
 		SubType:    "pbx",
 		Status:     "activated",
 	}
-	got, err := s.Update(request)
+	got, err := s.Update(ctx, request)
 
 	assert.NotNil(t, got)
 	assert.Nil(t, err)
@@ -103,8 +159,9 @@ func TestSubscriptionSvc_Update_Success(t *testing.T) {
 }
 
 func TestSubscriptionSvc_Update_Fail(t *testing.T) {
-	s := setupSubscriptionSvc()
-	mock.Update = func(sub model.CreateSubscription) error {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	db.Update = func(sub model.CreateSubscription) error {
 		return errors.New("cannot update this subscription")
 	}
 	request := model.CreateSubscription{
@@ -113,17 +170,18 @@ func TestSubscriptionSvc_Update_Fail(t *testing.T) {
 		SubType:    "cell",
 		Status:     "activated",
 	}
-	_, err := s.Update(request)
+	_, err := s.Update(ctx, request)
 
 	assert.NotNil(t, err)
 }
 
 func TestSubscriptionSvc_Create_Success(t *testing.T) {
-	s := setupSubscriptionSvc()
-	mock.Create = func(sub model.CreateSubscription) error {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	db.Create = func(sub model.CreateSubscription) error {
 		return nil
 	}
-	mock.FindByID = func(msisdn string) (model.Subscription, error) {
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
 		return model.Subscription{
 			Msisdn:     msisdn,
 			ActivateAt: now,
@@ -134,7 +192,7 @@ func TestSubscriptionSvc_Create_Success(t *testing.T) {
 			ModifiedAt: now,
 		}, nil
 	}
-	mock.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
 		return model.PtsResponse{
 			D: model.OperatorDetails{Name: "Telness AB"},
 		}, nil
@@ -145,7 +203,7 @@ func TestSubscriptionSvc_Create_Success(t *testing.T) {
 		SubType:    "cell",
 		Status:     "pending",
 	}
-	got, err := s.Create(request)
+	got, err := s.Create(ctx, request)
 
 	assert.NotNil(t, got)
 	assert.Nil(t, err)
@@ -154,11 +212,13 @@ func TestSubscriptionSvc_Create_Success(t *testing.T) {
 	assert.EqualValues(t, "cell", got.SubType)
 	assert.EqualValues(t, "pending", got.Status)
 	assert.EqualValues(t, "Telness AB", got.Operator)
+	db.AssertCalled(t, "UpdateOperator")
 }
 
 func TestSubscriptionSvc_Create_Fail(t *testing.T) {
-	s := setupSubscriptionSvc()
-	mock.Create = func(sub model.CreateSubscription) error {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	db.Create = func(sub model.CreateSubscription) error {
 		return errors.New("cannot create this subscription")
 	}
 	request := model.CreateSubscription{
@@ -167,7 +227,153 @@ func TestSubscriptionSvc_Create_Fail(t *testing.T) {
 		SubType:    "pbx",
 		Status:     "activated",
 	}
-	_, err := s.Create(request)
+	_, err := s.Create(ctx, request)
 
 	assert.NotNil(t, err)
 }
+
+func TestSubscriptionSvc_History_Success(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{Msisdn: msisdn, Status: "paused"}, nil
+	}
+	db.FindHistory = func(msisdn string, limit, offset int) ([]model.SubscriptionHistory, error) {
+		assert.EqualValues(t, 3, limit)
+		assert.EqualValues(t, 4, offset)
+		return []model.SubscriptionHistory{
+			{ID: 3, Msisdn: msisdn, Action: "updated", Actor: "support", Reason: "customer request"},
+			{ID: 2, Msisdn: msisdn, Action: "updated", Actor: "api"},
+			{ID: 1, Msisdn: msisdn, Action: "created", Actor: "api"},
+		}, nil
+	}
+	got, err := s.History(ctx, msisdn, 2, 4)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, msisdn, got.Msisdn)
+	assert.Len(t, got.History, 2)
+	assert.True(t, got.HasMore)
+	assert.EqualValues(t, "support", got.History[0].Actor)
+}
+
+func TestSubscriptionSvc_History_NotFound(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{}, errors.New("subscription not found")
+	}
+	_, err := s.History(ctx, msisdn, 50, 0)
+	assert.NotNil(t, err)
+}
+
+func TestSubscriptionSvc_Update_AnyVersionLosesRace(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	assert.Nil(t, db.CreateSubscription(ctx, model.CreateSubscription{Msisdn: msisdn, ActivateAt: now, SubType: "cell", Status: model.StatusActivated}))
+	stale, err := db.FindSubscriptionbyID(ctx, msisdn)
+	assert.Nil(t, err)
+	// the subscription is cancelled after the service read it
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return stale, nil
+	}
+	assert.Nil(t, db.UpdateSubscription(ctx, model.CreateSubscription{Msisdn: msisdn, ActivateAt: now, SubType: "cell", Status: model.StatusCancelled}))
+
+	_, err = s.Update(ctx, model.CreateSubscription{Msisdn: msisdn, ActivateAt: now, SubType: "cell", Status: model.StatusPaused})
+
+	assert.True(t, errors.Is(err, apperr.ErrPreconditionFailed))
+	db.FindByID = nil
+	stored, err := db.FindSubscriptionbyID(ctx, msisdn)
+	assert.Nil(t, err)
+	assert.EqualValues(t, model.StatusCancelled, stored.Status)
+}
+
+func TestSubscriptionSvc_AllowedTransitions_ReadsOnce(t *testing.T) {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{Msisdn: msisdn, ActivateAt: now, Status: model.StatusPaused}, nil
+	}
+	got, err := s.AllowedTransitions(ctx, msisdn)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, msisdn, got.Msisdn)
+	assert.EqualValues(t, model.StatusPaused, got.Status)
+	assert.NotEmpty(t, got.Allowed)
+	db.AssertCallCount(t, "FindSubscriptionbyID", 1)
+	db.AssertNotCalled(t, "UpdateOperator")
+	pts.AssertNotCalled(t, "GetOperatorDetails")
+}
+
+func TestSubscriptionSvc_List_NextCursor(t *testing.T) {
+	t.Parallel()
+	s, db, pts := setupSubscriptionSvc()
+	db.List = func(filter model.SubscriptionFilter) ([]model.Subscription, error) {
+		assert.EqualValues(t, 3, filter.Limit)
+		assert.EqualValues(t, model.SortByCreatedAt, filter.Sort)
+		assert.EqualValues(t, model.OrderAsc, filter.Order)
+		return []model.Subscription{
+			{Msisdn: "+46107500500", CreatedAt: "2021-10-10T10:00:00Z"},
+			{Msisdn: "+46107500501", CreatedAt: "2021-10-11T10:00:00Z"},
+			{Msisdn: "+46107500502", CreatedAt: "2021-10-12T10:00:00Z"},
+		}, nil
+	}
+	pts.GetOperator = func(msisdn string) (model.PtsResponse, error) {
+		t.Fatal("listing must not look up operators")
+		return model.PtsResponse{}, nil
+	}
+	got, err := s.List(ctx, model.SubscriptionFilter{Limit: 2})
+
+	assert.Nil(t, err)
+	assert.Len(t, got.Subscriptions, 2)
+	cursor, err := model.DecodeCursor(got.NextCursor)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "+46107500501", cursor.Msisdn)
+	assert.EqualValues(t, "2021-10-11T10:00:00Z", cursor.Value)
+}
+
+func TestSubscriptionSvc_List_LastPage(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	db.List = func(filter model.SubscriptionFilter) ([]model.Subscription, error) {
+		return []model.Subscription{{Msisdn: "+46107500500"}}, nil
+	}
+	got, err := s.List(ctx, model.SubscriptionFilter{Sort: model.SortByMsisdn, Order: model.OrderDesc, Limit: 2})
+
+	assert.Nil(t, err)
+	assert.Len(t, got.Subscriptions, 1)
+	assert.Empty(t, got.NextCursor)
+}
+
+func TestSubscriptionSvc_List_InvalidFilter(t *testing.T) {
+	t.Parallel()
+	s, _, _ := setupSubscriptionSvc()
+	tests := []model.SubscriptionFilter{
+		{Sort: "operator", Limit: 10},
+		{Order: "up", Limit: 10},
+		{Limit: 0},
+		{Sort: model.SortByMsisdn, Limit: 10, After: &model.ListCursor{Sort: model.SortByCreatedAt, Order: model.OrderAsc, Msisdn: msisdn}},
+	}
+	for _, filter := range tests {
+		_, err := s.List(ctx, filter)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestSubscriptionSvc_Update_VersionMismatch(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	updated := false
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{Msisdn: msisdn, ActivateAt: now, SubType: "cell", Status: "activated", Version: 3}, nil
+	}
+	db.Update = func(sub model.CreateSubscription) error {
+		updated = true
+		return nil
+	}
+	request := model.CreateSubscription{Msisdn: msisdn, ActivateAt: now, SubType: "pbx", Status: "activated", ExpectedVersion: 2}
+
+	_, err := s.Update(ctx, request)
+
+	assert.True(t, errors.Is(err, apperr.ErrPreconditionFailed))
+	assert.False(t, updated)
+}
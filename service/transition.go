@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// timeNow is used to evaluate transition guards, tests can replace it to freeze the clock
+var timeNow = time.Now
+
+// transitions defines for each subscription status the statuses it is allowed to move to.
+// A status without any outgoing transition is terminal.
+var transitions = map[model.SubStatus][]model.SubStatus{
+	model.StatusPending:   {model.StatusActivated, model.StatusCancelled},
+	model.StatusActivated: {model.StatusPaused, model.StatusCancelled},
+	model.StatusPaused:    {model.StatusActivated, model.StatusCancelled},
+	model.StatusCancelled: {},
+}
+
+// InvalidTransitionError is returned when a subscription is asked to move to a status
+// which is not allowed from its current status
+type InvalidTransitionError struct {
+	From   model.SubStatus
+	To     model.SubStatus
+	Reason string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("status cannot change from %v to %v: %v", e.From, e.To, e.Reason)
+	}
+	return fmt.Sprintf("status cannot change from %v to %v", e.From, e.To)
+}
+
+func (e *InvalidTransitionError) ErrorKind() apperr.Kind {
+	return apperr.KindInvalidTransition
+}
+
+func (e *InvalidTransitionError) ErrorCode() string {
+	return apperr.CodeInvalidTransition
+}
+
+// Is makes errors.Is(err, apperr.ErrInvalidTransition) match
+func (e *InvalidTransitionError) Is(target error) bool {
+	return target == apperr.ErrInvalidTransition
+}
+
+// Transitions returns a copy of the transition table
+func Transitions() map[model.SubStatus][]model.SubStatus {
+	table := make(map[model.SubStatus][]model.SubStatus, len(transitions))
+	for from, to := range transitions {
+		table[from] = append([]model.SubStatus{}, to...)
+	}
+	return table
+}
+
+// IsTerminal reports whether a subscription in the given status can never change status again
+func IsTerminal(status model.SubStatus) bool {
+	next, ok := transitions[status]
+	return ok && len(next) == 0
+}
+
+// AllowedTransitions returns the statuses the given subscription can move to right now,
+// taking the guard conditions into account
+func AllowedTransitions(sub model.Subscription) []model.SubStatus {
+	allowed := []model.SubStatus{}
+	for _, to := range transitions[sub.Status] {
+		if checkTransition(sub, to) == nil {
+			allowed = append(allowed, to)
+		}
+	}
+	return allowed
+}
+
+// checkTransition validates that the subscription can move from its current status to the
+// requested one. Keeping the same status is always allowed so other fields can be updated.
+func checkTransition(sub model.Subscription, to model.SubStatus) error {
+	if sub.Status == to {
+		return nil
+	}
+	allowed := false
+	for _, next := range transitions[sub.Status] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		if IsTerminal(sub.Status) {
+			return &InvalidTransitionError{From: sub.Status, To: to, Reason: fmt.Sprintf("%v is a terminal status", sub.Status)}
+		}
+		return &InvalidTransitionError{From: sub.Status, To: to}
+	}
+
+	// a pending subscription can only be activated once its activation date is reached
+	if sub.Status == model.StatusPending && to == model.StatusActivated {
+		activateAt, err := ParseDate(sub.ActivateAt)
+		if err != nil {
+			return &InvalidTransitionError{From: sub.Status, To: to, Reason: fmt.Sprintf("activate_at %q could not be parsed", sub.ActivateAt)}
+		}
+		if timeNow().Before(activateAt) {
+			return &InvalidTransitionError{From: sub.Status, To: to, Reason: fmt.Sprintf("activate_at %v is not reached yet", activateAt.Format("2006-01-02"))}
+		}
+	}
+	return nil
+}
+
+// ParseDate parses a date as sent by clients (2006-01-02) or as read from the database (RFC3339)
+func ParseDate(date string) (time.Time, error) {
+	parsed, err := time.Parse("2006-01-02", date)
+	if err == nil {
+		return parsed, nil
+	}
+	return time.Parse(time.RFC3339, date)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// freezeTime makes timeNow return now until the test finishes. Tests using it must not be parallel,
+// the parallel tests read timeNow.
+func freezeTime(t *testing.T, now time.Time) {
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+func TestCheckTransition(t *testing.T) {
+	// a fixed clock, so the cases do not change when the test runs around midnight
+	freezeTime(t, time.Date(2026, 5, 1, 23, 59, 59, 0, time.UTC))
+	today := "2026-05-01"
+	tomorrow := "2026-05-02"
+	tests := []struct {
+		name       string
+		from       model.SubStatus
+		activateAt string
+		to         model.SubStatus
+		allowed    bool
+	}{
+		{"pending to activated when activation date reached", model.StatusPending, today, model.StatusActivated, true},
+		{"pending to activated before activation date", model.StatusPending, tomorrow, model.StatusActivated, false},
+		{"pending to activated with stored timestamp", model.StatusPending, "2021-10-17T00:00:00Z", model.StatusActivated, true},
+		{"pending to paused", model.StatusPending, today, model.StatusPaused, false},
+		{"pending to cancelled", model.StatusPending, tomorrow, model.StatusCancelled, true},
+		{"activated to paused", model.StatusActivated, today, model.StatusPaused, true},
+		{"paused to activated", model.StatusPaused, today, model.StatusActivated, true},
+		{"activated to pending", model.StatusActivated, today, model.StatusPending, false},
+		{"cancelled to activated", model.StatusCancelled, today, model.StatusActivated, false},
+		{"cancelled stays cancelled", model.StatusCancelled, today, model.StatusCancelled, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := model.Subscription{Msisdn: msisdn, Status: tt.from, ActivateAt: tt.activateAt}
+			err := checkTransition(sub, tt.to)
+			if tt.allowed {
+				assert.Nil(t, err)
+				return
+			}
+			var transitionErr *InvalidTransitionError
+			assert.True(t, errors.As(err, &transitionErr))
+			assert.EqualValues(t, tt.from, transitionErr.From)
+			assert.EqualValues(t, tt.to, transitionErr.To)
+		})
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	t.Parallel()
+	assert.True(t, IsTerminal(model.StatusCancelled))
+	assert.False(t, IsTerminal(model.StatusPending))
+	assert.False(t, IsTerminal(model.StatusActivated))
+	assert.False(t, IsTerminal(model.StatusPaused))
+}
+
+func TestAllowedTransitions(t *testing.T) {
+	t.Parallel()
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+	sub := model.Subscription{Msisdn: msisdn, Status: model.StatusPending, ActivateAt: tomorrow}
+	assert.EqualValues(t, []model.SubStatus{model.StatusCancelled}, AllowedTransitions(sub))
+
+	sub.Status = model.StatusCancelled
+	assert.Empty(t, AllowedTransitions(sub))
+}
+
+func TestSubscriptionSvc_Update_InvalidTransition(t *testing.T) {
+	t.Parallel()
+	s, db, _ := setupSubscriptionSvc()
+	updated := false
+	db.FindByID = func(msisdn string) (model.Subscription, error) {
+		return model.Subscription{
+			Msisdn:     msisdn,
+			ActivateAt: now,
+			SubType:    "cell",
+			Status:     "cancelled",
+		}, nil
+	}
+	db.Update = func(sub model.CreateSubscription) error {
+		updated = true
+		return nil
+	}
+	request := model.CreateSubscription{
+		Msisdn:     msisdn,
+		ActivateAt: now,
+		SubType:    "cell",
+		Status:     "activated",
+	}
+	_, err := s.Update(ctx, request)
+
+	var transitionErr *InvalidTransitionError
+	assert.True(t, errors.As(err, &transitionErr))
+	assert.True(t, errors.Is(err, apperr.ErrInvalidTransition))
+	assert.EqualValues(t, apperr.KindInvalidTransition, apperr.KindOf(err))
+	assert.False(t, updated)
+}
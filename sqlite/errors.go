@@ -0,0 +1,30 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pmadhvi/telness-manager/apperr"
+)
+
+// translateError turns an error from a query on the subscription with given msisdn into a
+// domain error. Errors without a domain meaning are returned as they are.
+func translateError(err error, msisdn string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperr.NotFound(apperr.CodeSubscriptionNotFound, err, "subscription with msisdn %v not found", msisdn)
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch {
+		case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+			return apperr.AlreadyExists(apperr.CodeSubscriptionExists, err, "subscription with msisdn %v already exists", msisdn)
+		case sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked:
+			return apperr.UpstreamUnavailable(apperr.CodeDatabaseUnavailable, err, "database is unavailable")
+		}
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// CreateSubscriptions inserts a batch of subscriptions in one transaction and returns the error of
+// every row, nil for the rows inserted. A failing row is rolled back to its savepoint and the other
+// rows are inserted anyway, unless atomic is set: then the batch stops at the first failing row and
+// nothing is inserted. The returned error is set when the batch as a whole failed.
+func (sr subscriptionRepo) CreateSubscriptions(ctx context.Context, subs []model.CreateSubscription, atomic bool) ([]error, error) {
+	rowErrs := make([]error, len(subs))
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return rowErrs, translateError(err, "")
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for i, sub := range subs {
+		if !atomic {
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT import_row`); err != nil {
+				return rowErrs, translateError(err, sub.Msisdn)
+			}
+		}
+		if err := insertSubscription(ctx, tx, sub, now); err != nil {
+			sr.log.Errorf("could not import subscription with msisdn %v: %v", sub.Msisdn, err)
+			rowErrs[i] = translateError(err, sub.Msisdn)
+			if atomic {
+				return rowErrs, nil
+			}
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row`); err != nil {
+				return rowErrs, translateError(err, sub.Msisdn)
+			}
+			continue
+		}
+		if !atomic {
+			if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row`); err != nil {
+				return rowErrs, translateError(err, sub.Msisdn)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		sr.log.Errorf("could not commit imported subscriptions: %v", err)
+		return rowErrs, translateError(err, "")
+	}
+	return rowErrs, nil
+}
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// sortColumns maps the allowed sort fields to their column, so user input never ends up in the query
+var sortColumns = map[string]string{
+	model.SortByMsisdn:     "msisdn",
+	model.SortByActivateAt: "activate_at",
+	model.SortByCreatedAt:  "created_at",
+	model.SortByModifiedAt: "modified_at",
+}
+
+func (sr subscriptionRepo) ListSubscriptions(ctx context.Context, filter model.SubscriptionFilter) ([]model.Subscription, error) {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		sr.log.Errorf("could not build list query: %v", err)
+		return nil, err
+	}
+	subs, err := sr.query(ctx, query, args...)
+	if err != nil {
+		sr.log.Errorf("could not list subscriptions: %v", err)
+	}
+	return subs, err
+}
+
+// StreamSubscriptions calls fn for every subscription matching the filter, in the order of the
+// filter. sqlite steps through the rows as they are read, so memory use does not grow with the
+// number of subscriptions. fn must not use the repository, with :memory: the stream holds the only
+// connection. An error returned by fn stops the stream and is returned as it is.
+func (sr subscriptionRepo) StreamSubscriptions(ctx context.Context, filter model.SubscriptionFilter, fn func(model.Subscription) error) error {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		sr.log.Errorf("could not build export query: %v", err)
+		return err
+	}
+	rows, err := sr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		sr.log.Errorf("could not query exported subscriptions: %v", err)
+		return translateError(err, "")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			sr.log.Errorf("could not scan exported subscription: %v", err)
+			return err
+		}
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// listQuery builds the query and its arguments for the filter, sorted by the sort column and msisdn
+func listQuery(filter model.SubscriptionFilter) (string, []interface{}, error) {
+	column, ok := sortColumns[filter.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("cannot sort by %q", filter.Sort)
+	}
+	direction, compare := "ASC", ">"
+	if filter.Order == model.OrderDesc {
+		direction, compare = "DESC", "<"
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if len(filter.Status) > 0 {
+		for _, status := range filter.Status {
+			args = append(args, status)
+		}
+		where = append(where, fmt.Sprintf("status IN (%s)", placeholders(len(filter.Status))))
+	}
+	if len(filter.SubType) > 0 {
+		for _, subType := range filter.SubType {
+			args = append(args, subType)
+		}
+		where = append(where, fmt.Sprintf("sub_type IN (%s)", placeholders(len(filter.SubType))))
+	}
+	times := []struct {
+		condition string
+		value     time.Time
+	}{
+		{"activate_at >= ?", filter.ActivateFrom},
+		{"activate_at < ?", filter.ActivateTo},
+		{"created_at >= ?", filter.CreatedFrom},
+		{"created_at < ?", filter.CreatedTo},
+	}
+	for _, t := range times {
+		if !t.value.IsZero() {
+			where = append(where, t.condition)
+			args = append(args, formatTime(t.value))
+		}
+	}
+	if filter.MsisdnPrefix != "" {
+		where = append(where, `msisdn LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(filter.MsisdnPrefix)+"%")
+	}
+	if filter.After != nil {
+		if column == "msisdn" {
+			where = append(where, fmt.Sprintf("msisdn %s ?", compare))
+			args = append(args, filter.After.Msisdn)
+		} else {
+			value, err := time.Parse(time.RFC3339Nano, filter.After.Value)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid cursor value %q: %v", filter.After.Value, err)
+			}
+			where = append(where, fmt.Sprintf("(%s, msisdn) %s (?, ?)", column, compare))
+			args = append(args, formatTime(value), filter.After.Msisdn)
+		}
+	}
+
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription`
+	if len(where) > 0 {
+		query += "\n\tWHERE " + strings.Join(where, " AND ")
+	}
+	if column == "msisdn" {
+		query += fmt.Sprintf("\n\tORDER BY msisdn %s", direction)
+	} else {
+		query += fmt.Sprintf("\n\tORDER BY %s %s, msisdn %s", column, direction, direction)
+	}
+	if filter.Limit > 0 {
+		query += "\n\tLIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	return query, args, nil
+}
+
+// escapeLike escapes the LIKE wildcards so a prefix only matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,205 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/migrate"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// unversionedSchema is the migration the schema of files created before the migrations were
+// versioned is at, they were created with the tables of migrations 1 to 7 at once
+const unversionedSchema int64 = 7
+
+// Migrations returns the migrations embedded from sqlite/migrations, ordered by version. They have
+// the versions and names of the postgres migrations.
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Read(migrationFiles, "migrations")
+}
+
+type migrator struct {
+	db         *sql.DB
+	log        *log.Logger
+	migrations []migrate.Migration
+}
+
+// NewMigrator returns a migrator for the embedded migrations. sqlite has no advisory locks, every
+// Up, Down or Status runs in one transaction instead, holding the write lock of the file so two
+// processes opening it at the same time do not both migrate it.
+func NewMigrator(db *sql.DB, log *log.Logger) (*migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, log: log, migrations: migrations}, nil
+}
+
+// Up applies every migration which is not applied yet, in order, and returns how many it applied
+func (m migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.locked(ctx, func(tx *sql.Tx, done map[int64]time.Time) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			m.log.Infof("applying migration %d_%v", migration.Version, migration.Name)
+			err := m.run(ctx, tx, migration.Up, `INSERT INTO schema_migrations(version, name, applied_at) VALUES(?, ?, ?)`,
+				migration.Version, migration.Name, formatTime(time.Now()))
+			if err != nil {
+				return fmt.Errorf("could not apply migration %d_%v: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns how many it reverted
+func (m migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.locked(ctx, func(tx *sql.Tx, done map[int64]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+			m.log.Infof("reverting migration %d_%v", migration.Version, migration.Name)
+			err := m.run(ctx, tx, migration.Down, `DELETE FROM schema_migrations WHERE version = ?`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("could not revert migration %d_%v: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reverted, nil
+}
+
+// Status returns every migration with when it was applied
+func (m migrator) Status(ctx context.Context) ([]migrate.State, error) {
+	var states []migrate.State
+	err := m.locked(ctx, func(tx *sql.Tx, done map[int64]time.Time) error {
+		for _, migration := range m.migrations {
+			states = append(states, migrate.State{Version: migration.Version, Name: migration.Name, AppliedAt: done[migration.Version]})
+		}
+		return nil
+	})
+	return states, err
+}
+
+// locked runs fn in a transaction holding the write lock, with the versions applied so far. The
+// transaction is committed when fn succeeds, so the migrations of one call are applied all or none.
+func (m migrator) locked(ctx context.Context, fn func(tx *sql.Tx, done map[int64]time.Time) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		m.log.Errorf("could not begin migration transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var versioned int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&versioned)
+	if err != nil {
+		return err
+	}
+	if versioned == 0 {
+		if err := m.createSchemaMigrations(ctx, tx); err != nil {
+			m.log.Errorf("could not create schema_migrations table: %v", err)
+			return err
+		}
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		m.log.Errorf("could not read applied migrations: %v", err)
+		return err
+	}
+	defer rows.Close()
+	done := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt string
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return err
+		}
+		if done[version], err = time.Parse(timeLayout, appliedAt); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	for version := range done {
+		if !m.known(version) {
+			m.log.Warnf("database has migration %d applied which this build does not know, it is newer than this build", version)
+		}
+	}
+	if err := fn(tx, done); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createSchemaMigrations creates the schema_migrations table. A file created before the migrations
+// were versioned already has the subscription table, it is recorded at the migration its schema is at.
+func (m migrator) createSchemaMigrations(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `CREATE TABLE schema_migrations(
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TEXT NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+	var unversioned int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'subscription'`).Scan(&unversioned)
+	if err != nil || unversioned == 0 {
+		return err
+	}
+	m.log.Infof("recording the schema of the unversioned database as migration %d", unversionedSchema)
+	for _, migration := range m.migrations {
+		if migration.Version > unversionedSchema {
+			break
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations(version, name, applied_at) VALUES(?, ?, ?)`,
+			migration.Version, migration.Name, formatTime(time.Now()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run executes a migration and records it
+func (m migrator) run(ctx context.Context, tx *sql.Tx, migration string, record string, args ...interface{}) error {
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, record, args...)
+	return err
+}
+
+func (m migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pmadhvi/telness-manager/postgres"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// columns returns the columns of every table, e.g. "subscription.version"
+func columns(t *testing.T, db *sql.DB) []string {
+	rows, err := db.Query(`SELECT m.name || '.' || p.name FROM sqlite_master m, pragma_table_info(m.name) p
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' ORDER BY m.name, p.cid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		assert.Nil(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+	return names
+}
+
+func newMigrator(t *testing.T) (*migrator, *sql.DB) {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	m, err := NewMigrator(db, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, db
+}
+
+func TestMigrations_MatchPostgres(t *testing.T) {
+	migrations, err := Migrations()
+	assert.Nil(t, err)
+	pgMigrations, err := postgres.Migrations()
+	assert.Nil(t, err)
+
+	// both backends are at the same schema version, a migration added to one is added to the other
+	assert.Len(t, migrations, len(pgMigrations))
+	for i := range pgMigrations {
+		assert.EqualValues(t, pgMigrations[i].Version, migrations[i].Version)
+		assert.EqualValues(t, pgMigrations[i].Name, migrations[i].Name)
+	}
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	m, db := newMigrator(t)
+
+	applied, err := m.Up(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(m.migrations), applied)
+	migrated := columns(t, db)
+	assert.Contains(t, migrated, "subscription.version")
+	assert.Contains(t, migrated, "subscription.operator_checked_at")
+	applied, err = m.Up(ctx)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, applied)
+
+	reverted, err := m.Down(ctx, 1)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, reverted)
+	assert.NotEqual(t, migrated, columns(t, db))
+	states, err := m.Status(ctx)
+	assert.Nil(t, err)
+	assert.True(t, states[len(states)-1].AppliedAt.IsZero())
+	assert.False(t, states[len(states)-2].AppliedAt.IsZero())
+
+	// every down migration reverts its up migration
+	reverted, err = m.Down(ctx, len(m.migrations))
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(m.migrations)-1, reverted)
+	assert.Equal(t, []string{"schema_migrations.version", "schema_migrations.name", "schema_migrations.applied_at"}, columns(t, db))
+	_, err = m.Up(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, migrated, columns(t, db))
+}
+
+func TestMigrator_UnversionedSchema(t *testing.T) {
+	m, db := newMigrator(t)
+	_, err := m.Up(ctx)
+	assert.Nil(t, err)
+	_, err = m.Down(ctx, len(m.migrations)-int(unversionedSchema))
+	assert.Nil(t, err)
+	// a file created before the migrations were versioned has the tables, but no schema_migrations
+	_, err = db.Exec(`DROP TABLE schema_migrations`)
+	assert.Nil(t, err)
+
+	applied, err := m.Up(ctx)
+
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(m.migrations)-int(unversionedSchema), applied)
+	states, err := m.Status(ctx)
+	assert.Nil(t, err)
+	for _, state := range states {
+		assert.False(t, state.AppliedAt.IsZero(), state.Name)
+	}
+}
@@ -0,0 +1,10 @@
+-- times are stored as text in a fixed width UTC layout, so comparing them as text compares them as times
+CREATE TABLE IF NOT EXISTS subscription(
+    msisdn TEXT NOT NULL PRIMARY KEY,
+    activate_at TEXT NOT NULL,
+    sub_type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    modified_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS subscription_status_activate_at_idx ON subscription (status, activate_at);
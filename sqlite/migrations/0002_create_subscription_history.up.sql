@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS subscription_history(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    msisdn TEXT NOT NULL REFERENCES subscription(msisdn),
+    action TEXT NOT NULL,
+    before TEXT,
+    after TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    changed_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS subscription_history_msisdn_changed_at_idx ON subscription_history (msisdn, changed_at DESC, id DESC);
+
+-- history is append-only, rows can never be changed or removed
+CREATE TRIGGER IF NOT EXISTS subscription_history_no_update BEFORE UPDATE ON subscription_history
+BEGIN
+    SELECT RAISE(ABORT, 'subscription_history is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS subscription_history_no_delete BEFORE DELETE ON subscription_history
+BEGIN
+    SELECT RAISE(ABORT, 'subscription_history is append-only');
+END;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS subscription_created_at_idx;
+DROP INDEX IF EXISTS subscription_activate_at_idx;
+DROP INDEX IF EXISTS subscription_modified_at_idx;
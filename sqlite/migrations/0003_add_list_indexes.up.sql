@@ -0,0 +1,4 @@
+-- indexes supporting the list endpoint, msisdn breaks ties so pagination is stable
+CREATE INDEX IF NOT EXISTS subscription_created_at_idx ON subscription (created_at, msisdn);
+CREATE INDEX IF NOT EXISTS subscription_activate_at_idx ON subscription (activate_at, msisdn);
+CREATE INDEX IF NOT EXISTS subscription_modified_at_idx ON subscription (modified_at, msisdn);
@@ -0,0 +1,7 @@
+-- last operator PTS answered with, returned when PTS cannot be reached
+ALTER TABLE subscription ADD COLUMN operator TEXT;
+
+-- when PTS last confirmed the operator, the operator refresher re-checks rows once this gets old
+ALTER TABLE subscription ADD COLUMN operator_checked_at TEXT;
+
+CREATE INDEX IF NOT EXISTS subscription_operator_checked_at_idx ON subscription (operator_checked_at, msisdn);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS portability_event;
+DROP TABLE IF EXISTS operator_change;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS operator_change(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    msisdn TEXT NOT NULL REFERENCES subscription(msisdn),
+    previous_operator TEXT NOT NULL,
+    operator TEXT NOT NULL,
+    detected_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS operator_change_detected_at_idx ON operator_change (detected_at, id);
+
+CREATE TABLE IF NOT EXISTS portability_event(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    msisdn TEXT NOT NULL REFERENCES subscription(msisdn),
+    expected_operator TEXT NOT NULL,
+    operator TEXT NOT NULL,
+    detected_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS portability_event_detected_at_idx ON portability_event (detected_at, id);
+CREATE INDEX IF NOT EXISTS portability_event_msisdn_idx ON portability_event (msisdn, detected_at DESC, id DESC);
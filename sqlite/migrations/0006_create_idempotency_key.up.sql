@@ -0,0 +1,12 @@
+-- requests sent with an Idempotency-Key header, a null status_code means the first request is still running
+CREATE TABLE IF NOT EXISTS idempotency_key(
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER,
+    content_type TEXT,
+    response BLOB,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_expires_at_idx ON idempotency_key (expires_at);
@@ -0,0 +1 @@
+ALTER TABLE subscription DROP COLUMN version;
@@ -0,0 +1,2 @@
+-- incremented on every update, returned as ETag and checked against If-Match so concurrent updates cannot overwrite each other
+ALTER TABLE subscription ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
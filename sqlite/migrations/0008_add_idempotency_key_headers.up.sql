@@ -0,0 +1,2 @@
+-- response headers replayed with the stored response, e.g. ETag and Location, as a json object
+ALTER TABLE idempotency_key ADD COLUMN headers TEXT;
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/model"
+)
+
+// UpdateOperator stores the operator PTS answered with and when it was checked. A changed
+// operator is recorded as an operator change, so ported numbers can be reported later.
+func (sr subscriptionRepo) UpdateOperator(ctx context.Context, msisdn string, operator string, checkedAt time.Time) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return translateError(err, msisdn)
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT operator FROM subscription WHERE msisdn = ?`, msisdn).Scan(&previous)
+	if err != nil {
+		sr.log.Errorf("could not find the operator to update in db: %v", err)
+		return translateError(err, msisdn)
+	}
+
+	query := `UPDATE subscription
+		SET operator = ?, operator_checked_at = ?
+		WHERE msisdn = ?`
+	_, err = tx.ExecContext(ctx, query, operator, formatTime(checkedAt), msisdn)
+	if err != nil {
+		sr.log.Errorf("could not update the operator in db: %v", err)
+		return translateError(err, msisdn)
+	}
+
+	if previous.Valid && previous.String != "" && previous.String != operator {
+		query = `INSERT INTO operator_change(msisdn, previous_operator, operator, detected_at)
+		VALUES(?, ?, ?, ?)`
+		_, err = tx.ExecContext(ctx, query, msisdn, previous.String, operator, formatTime(checkedAt))
+		if err != nil {
+			sr.log.Errorf("could not insert the operator change in db: %v", err)
+			return err
+		}
+		sr.log.Infof("subscription with msisdn %v is ported from %v to %v", msisdn, previous.String, operator)
+	}
+	return tx.Commit()
+}
+
+// FindSubscriptionsWithStaleOperator returns subscriptions, except cancelled ones, whose operator
+// was never checked or last checked before the given time
+func (sr subscriptionRepo) FindSubscriptionsWithStaleOperator(ctx context.Context, checkedBefore time.Time, limit int) ([]model.Subscription, error) {
+	// sqlite sorts nulls first in ascending order
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription
+	WHERE status <> ? AND (operator_checked_at IS NULL OR operator_checked_at < ?)
+	ORDER BY operator_checked_at, msisdn
+	LIMIT ?`
+	subs, err := sr.query(ctx, query, model.StatusCancelled, formatTime(checkedBefore), limit)
+	if err != nil {
+		sr.log.Errorf("could not query subscriptions with stale operator: %v", err)
+	}
+	return subs, err
+}
+
+// RecordPortedOut stores a ported out event, unless the latest event of the number already
+// reports the same operator and the number has not changed operator since, e.g. ported back and
+// out again. It returns whether the event was recorded.
+func (sr subscriptionRepo) RecordPortedOut(ctx context.Context, event model.PortabilityEvent, detectedAt time.Time) (bool, error) {
+	query := `INSERT INTO portability_event(msisdn, expected_operator, operator, detected_at)
+	SELECT ?1, ?2, ?3, ?4
+	WHERE NOT EXISTS (
+		SELECT 1 FROM (
+			SELECT operator, detected_at FROM portability_event
+			WHERE msisdn = ?1
+			ORDER BY detected_at DESC, id DESC
+			LIMIT 1
+		) latest
+		WHERE latest.operator = ?3
+		AND NOT EXISTS (
+			SELECT 1 FROM operator_change
+			WHERE msisdn = ?1 AND detected_at > latest.detected_at
+		)
+	)`
+	result, err := sr.db.ExecContext(ctx, query, event.Msisdn, event.ExpectedOperator, event.Operator, formatTime(detectedAt))
+	if err != nil {
+		sr.log.Errorf("could not insert the portability event in db: %v", err)
+		return false, translateError(err, event.Msisdn)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return inserted == 1, nil
+}
+
+func (sr subscriptionRepo) FindPortabilityEvents(ctx context.Context, from, to time.Time) ([]model.PortabilityEvent, error) {
+	events := []model.PortabilityEvent{}
+	err := sr.findEvents(ctx, "portability_event", "expected_operator", from, to, func(id int64, msisdn, from, operator, detectedAt string) {
+		events = append(events, model.PortabilityEvent{ID: id, Msisdn: msisdn, ExpectedOperator: from, Operator: operator, DetectedAt: detectedAt})
+	})
+	if err != nil {
+		sr.log.Errorf("could not query portability events: %v", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+func (sr subscriptionRepo) FindOperatorChanges(ctx context.Context, from, to time.Time) ([]model.OperatorChange, error) {
+	changes := []model.OperatorChange{}
+	err := sr.findEvents(ctx, "operator_change", "previous_operator", from, to, func(id int64, msisdn, from, operator, detectedAt string) {
+		changes = append(changes, model.OperatorChange{ID: id, Msisdn: msisdn, PreviousOperator: from, Operator: operator, DetectedAt: detectedAt})
+	})
+	if err != nil {
+		sr.log.Errorf("could not query operator changes: %v", err)
+		return nil, err
+	}
+	return changes, nil
+}
+
+// findEvents calls fn for every row of the operator_change or portability_event table detected in
+// [from, to), fromColumn is the column with the operator before the change
+func (sr subscriptionRepo) findEvents(ctx context.Context, table, fromColumn string, from, to time.Time, fn func(id int64, msisdn, from, operator, detectedAt string)) error {
+	query := `SELECT id, msisdn, ` + fromColumn + `, operator, detected_at FROM ` + table + `
+	WHERE detected_at >= ? AND detected_at < ?
+	ORDER BY detected_at, id`
+	rows, err := sr.db.QueryContext(ctx, query, formatTime(from), formatTime(to))
+	if err != nil {
+		return translateError(err, "")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id                                     int64
+			msisdn, previous, operator, detectedAt string
+		)
+		if err := rows.Scan(&id, &msisdn, &previous, &operator, &detectedAt); err != nil {
+			return err
+		}
+		if detectedAt, err = readEventTime(detectedAt); err != nil {
+			return err
+		}
+		fn(id, msisdn, previous, operator, detectedAt)
+	}
+	return rows.Err()
+}
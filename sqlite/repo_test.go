@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	"github.com/pmadhvi/telness-manager/repotest"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func newRepo(t *testing.T) *subscriptionRepo {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	db, err := Open(":memory:", log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewSubscriptionRepo(db, log)
+}
+
+func newSub(msisdn string) model.CreateSubscription {
+	return model.CreateSubscription{Msisdn: msisdn, ActivateAt: "2027-01-01", SubType: "pbx", Status: model.StatusPending, Actor: "test"}
+}
+
+func TestRepo(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) service.SubscriptionRepoInterface {
+		return newRepo(t)
+	})
+}
+
+func TestUpdate_VersionMismatch(t *testing.T) {
+	repo := newRepo(t)
+	repo.CreateSubscription(ctx, newSub("+46107500500"))
+	update := newSub("+46107500500")
+	update.Status = model.StatusActivated
+	update.ExpectedVersion = 1
+	assert.Nil(t, repo.UpdateSubscription(ctx, update))
+
+	err := repo.UpdateSubscription(ctx, update)
+
+	assert.EqualValues(t, apperr.CodeVersionMismatch, apperr.CodeOf(err))
+	history, err := repo.FindSubscriptionHistory(ctx, "+46107500500", 10, 0)
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	assert.EqualValues(t, "2027-01-01", history[0].Before.ActivateAt)
+	assert.EqualValues(t, model.StatusActivated, history[0].After.Status)
+}
+
+func TestHistoryIsAppendOnly(t *testing.T) {
+	repo := newRepo(t)
+	repo.CreateSubscription(ctx, newSub("+46107500500"))
+
+	_, err := repo.db.Exec(`DELETE FROM subscription_history`)
+
+	assert.NotNil(t, err)
+}
+
+func TestUpdateOperator_RecordsChange(t *testing.T) {
+	repo := newRepo(t)
+	repo.CreateSubscription(ctx, newSub("+46107500500"))
+	checkedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo.UpdateOperator(ctx, "+46107500500", "Telness AB", checkedAt)
+
+	err := repo.UpdateOperator(ctx, "+46107500500", "Telia", checkedAt.Add(time.Hour))
+
+	assert.Nil(t, err)
+	changes, err := repo.FindOperatorChanges(ctx, checkedAt, checkedAt.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, changes, 1)
+	assert.EqualValues(t, "Telness AB", changes[0].PreviousOperator)
+	assert.EqualValues(t, "2026-01-01T13:00:00Z", changes[0].DetectedAt)
+	stale, err := repo.FindSubscriptionsWithStaleOperator(ctx, checkedAt.Add(2*time.Hour), 10)
+	assert.Nil(t, err)
+	assert.Len(t, stale, 1)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	repo := newRepo(t)
+	now := time.Now()
+	_, reserved, err := repo.ReserveIdempotencyKey(ctx, "key", "hash", now, now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.True(t, reserved)
+	repo.CompleteIdempotencyKey(ctx, "key", model.IdempotentResponse{StatusCode: 201, ContentType: "application/json", Headers: map[string]string{"ETag": `"1"`}, Body: []byte("{}")})
+
+	stored, reserved, err := repo.ReserveIdempotencyKey(ctx, "key", "hash", now, now.Add(time.Hour))
+
+	assert.Nil(t, err)
+	assert.False(t, reserved)
+	assert.EqualValues(t, 201, stored.StatusCode)
+	assert.EqualValues(t, map[string]string{"ETag": `"1"`}, stored.Headers)
+	assert.EqualValues(t, "{}", string(stored.Body))
+	// an expired key is taken over
+	_, reserved, _ = repo.ReserveIdempotencyKey(ctx, "key", "other", now.Add(2*time.Hour), now.Add(3*time.Hour))
+	assert.True(t, reserved)
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "telness.db")
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	db, err := Open(path, log)
+	assert.Nil(t, err)
+	assert.Nil(t, NewSubscriptionRepo(db, log).CreateSubscription(ctx, newSub("+46107500500")))
+	db.Close()
+
+	// the migrations are applied only once, the data is still there when the file is opened again
+	db, err = Open(path, log)
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = NewSubscriptionRepo(db, log).FindSubscriptionbyID(ctx, "+46107500500")
+	assert.Nil(t, err)
+}
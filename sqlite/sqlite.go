@@ -0,0 +1,88 @@
+// Package sqlite stores subscriptions in a sqlite database file, so the service can run without a
+// postgres server. It behaves like the postgres repository, but only one replica can use a file.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// timeLayout is how times are stored, fixed width and UTC so text order is time order
+	timeLayout = "2006-01-02T15:04:05.000000000Z"
+	// busyTimeout is how long a statement waits for another connection to finish writing
+	busyTimeout = 5 * time.Second
+)
+
+// Open opens the sqlite database at path, creating the file when it does not exist, and applies the
+// migrations it does not have yet. The path :memory: opens a database which only lives as long as
+// the returned db.
+func Open(path string, log *log.Logger) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_busy_timeout", fmt.Sprint(busyTimeout.Milliseconds()))
+	params.Set("_foreign_keys", "on")
+	// take the write lock when a transaction begins, two transactions upgrading a read lock would deadlock
+	params.Set("_txlock", "immediate")
+	inMemory := path == ":memory:"
+	if !inMemory {
+		params.Set("_journal_mode", "WAL")
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if inMemory {
+		// every connection to :memory: is a database of its own
+		db.SetMaxOpenConns(1)
+	}
+	migrator, err := NewMigrator(db, log)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not migrate sqlite database: %w", err)
+	}
+	return db, nil
+}
+
+// formatTime formats a time the way it is stored
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// readTime turns a stored time into the format times are read from postgres in
+func readTime(value string) (string, error) {
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339Nano), nil
+}
+
+// parseDate parses an activation date the way postgres does, a date or a RFC3339 timestamp, and
+// formats it the way it is stored
+func parseDate(value string) (string, error) {
+	if date, err := time.Parse(dateLayout, value); err == nil {
+		return formatTime(date), nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid input syntax for type timestamp: %q", value)
+	}
+	return formatTime(date), nil
+}
+
+// placeholders returns n comma separated ? placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,272 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pmadhvi/telness-manager/apperr"
+	"github.com/pmadhvi/telness-manager/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// subscriptionColumns are the columns scanSubscription reads, in order
+const subscriptionColumns = `msisdn, activate_at, sub_type, status, COALESCE(operator, ''), operator_checked_at, created_at, modified_at, version`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type subscriptionRepo struct {
+	db  *sql.DB
+	log *log.Logger
+}
+
+// NewSubscriptionRepo returns a repository on a db opened with Open
+func NewSubscriptionRepo(db *sql.DB, log *log.Logger) *subscriptionRepo {
+	return &subscriptionRepo{
+		db:  db,
+		log: log,
+	}
+}
+
+func scanSubscription(row scanner) (model.Subscription, error) {
+	var (
+		sub                               model.Subscription
+		activateAt, createdAt, modifiedAt string
+		operatorCheckedAt                 sql.NullString
+	)
+	err := row.Scan(&sub.Msisdn, &activateAt, &sub.SubType, &sub.Status, &sub.Operator, &operatorCheckedAt, &createdAt, &modifiedAt, &sub.Version)
+	if err != nil {
+		return sub, err
+	}
+	times := []struct {
+		stored string
+		value  *string
+	}{
+		{activateAt, &sub.ActivateAt},
+		{createdAt, &sub.CreatedAt},
+		{modifiedAt, &sub.ModifiedAt},
+		{operatorCheckedAt.String, &sub.OperatorCheckedAt},
+	}
+	for _, t := range times {
+		if t.stored == "" {
+			continue
+		}
+		if *t.value, err = readTime(t.stored); err != nil {
+			return sub, err
+		}
+	}
+	return sub, nil
+}
+
+func (sr subscriptionRepo) CreateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	defer tx.Rollback()
+
+	if err := insertSubscription(ctx, tx, sub, time.Now()); err != nil {
+		sr.log.Errorf("could not insert the data in db: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	return tx.Commit()
+}
+
+// insertSubscription inserts a new subscription together with its created history entry
+func insertSubscription(ctx context.Context, tx *sql.Tx, sub model.CreateSubscription, now time.Time) error {
+	activateAt, err := parseDate(sub.ActivateAt)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO subscription(msisdn, activate_at, sub_type, status, created_at, modified_at)
+	VALUES(?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, sub.Msisdn, activateAt, sub.SubType, sub.Status, formatTime(now), formatTime(now))
+	if err != nil {
+		return err
+	}
+	return insertHistory(ctx, tx, sub.Msisdn, model.HistoryActionCreated, nil, stateOf(sub), sub.Actor, sub.Reason, now)
+}
+
+func (sr subscriptionRepo) FindSubscriptionbyID(ctx context.Context, msisdn string) (model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription
+	WHERE msisdn = ?`
+	sub, err := scanSubscription(sr.db.QueryRowContext(ctx, query, msisdn))
+	if err != nil {
+		sr.log.Errorf("could not find subscription with msisdn %v: %v", msisdn, err)
+		return model.Subscription{}, translateError(err, msisdn)
+	}
+	return sub, nil
+}
+
+func (sr subscriptionRepo) UpdateSubscription(ctx context.Context, sub model.CreateSubscription) error {
+	// transactions begin immediate, so no other connection writes between the select and the update
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		sr.log.Errorf("could not begin transaction: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	defer tx.Rollback()
+
+	before := model.SubscriptionState{Msisdn: sub.Msisdn}
+	var (
+		activateAt string
+		version    int64
+	)
+	query := `SELECT activate_at, sub_type, status, version FROM subscription
+	WHERE msisdn = ?`
+	err = tx.QueryRowContext(ctx, query, sub.Msisdn).Scan(&activateAt, &before.SubType, &before.Status, &version)
+	if err != nil {
+		sr.log.Errorf("could not find the data to update in db: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	if sub.ExpectedVersion != 0 && sub.ExpectedVersion != version {
+		return apperr.VersionMismatch(sub.Msisdn, sub.ExpectedVersion, version)
+	}
+	if len(activateAt) >= len(dateLayout) {
+		before.ActivateAt = activateAt[:len(dateLayout)]
+	}
+
+	newActivateAt, err := parseDate(sub.ActivateAt)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	query = `UPDATE subscription
+		SET activate_at = ?, sub_type = ?, status = ?, modified_at = ?, version = version + 1
+		WHERE msisdn = ?`
+	_, err = tx.ExecContext(ctx, query, newActivateAt, sub.SubType, sub.Status, formatTime(now), sub.Msisdn)
+	if err != nil {
+		sr.log.Errorf("could not update the data in db: %v", err)
+		return translateError(err, sub.Msisdn)
+	}
+	err = insertHistory(ctx, tx, sub.Msisdn, model.HistoryActionUpdated, &before, stateOf(sub), sub.Actor, sub.Reason, now)
+	if err != nil {
+		sr.log.Errorf("could not insert the history in db: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (sr subscriptionRepo) FindDuePendingSubscriptions(ctx context.Context, now time.Time, limit int) ([]model.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscription
+	WHERE status = ? AND activate_at <= ?
+	ORDER BY activate_at, msisdn
+	LIMIT ?`
+	subs, err := sr.query(ctx, query, model.StatusPending, formatTime(now), limit)
+	if err != nil {
+		sr.log.Errorf("could not query due pending subscriptions: %v", err)
+	}
+	return subs, err
+}
+
+// query runs a query selecting subscriptionColumns and returns the subscriptions
+func (sr subscriptionRepo) query(ctx context.Context, query string, args ...interface{}) ([]model.Subscription, error) {
+	rows, err := sr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, translateError(err, "")
+	}
+	defer rows.Close()
+	subs := []model.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// stateOf returns the history snapshot for the values in a create or update request
+func stateOf(sub model.CreateSubscription) *model.SubscriptionState {
+	state := &model.SubscriptionState{
+		Msisdn:     sub.Msisdn,
+		ActivateAt: sub.ActivateAt,
+		SubType:    sub.SubType,
+		Status:     sub.Status,
+	}
+	// store dates the same way whether they came from a client or the database
+	if activateAt, err := time.Parse(time.RFC3339, sub.ActivateAt); err == nil {
+		state.ActivateAt = activateAt.Format(dateLayout)
+	}
+	return state
+}
+
+// insertHistory appends a change to the subscription history, it must run in the same
+// transaction as the change itself
+func insertHistory(ctx context.Context, tx *sql.Tx, msisdn, action string, before, after *model.SubscriptionState, actor, reason string, changedAt time.Time) error {
+	var beforeJSON interface{}
+	if before != nil {
+		data, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		beforeJSON = string(data)
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	if actor == "" {
+		actor = "unknown"
+	}
+	query := `INSERT INTO subscription_history(msisdn, action, before, after, actor, reason, changed_at)
+	VALUES(?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(ctx, query, msisdn, action, beforeJSON, string(afterJSON), actor, reason, formatTime(changedAt))
+	return err
+}
+
+func (sr subscriptionRepo) FindSubscriptionHistory(ctx context.Context, msisdn string, limit, offset int) ([]model.SubscriptionHistory, error) {
+	query := `SELECT id, msisdn, action, before, after, actor, reason, changed_at FROM subscription_history
+	WHERE msisdn = ?
+	ORDER BY changed_at DESC, id DESC
+	LIMIT ? OFFSET ?`
+	rows, err := sr.db.QueryContext(ctx, query, msisdn, limit, offset)
+	if err != nil {
+		sr.log.Errorf("could not query subscription history: %v", err)
+		return nil, translateError(err, msisdn)
+	}
+	defer rows.Close()
+	history := []model.SubscriptionHistory{}
+	for rows.Next() {
+		var (
+			entry      model.SubscriptionHistory
+			beforeJSON sql.NullString
+			afterJSON  string
+			changedAt  string
+		)
+		err := rows.Scan(&entry.ID, &entry.Msisdn, &entry.Action, &beforeJSON, &afterJSON, &entry.Actor, &entry.Reason, &changedAt)
+		if err != nil {
+			sr.log.Errorf("could not scan subscription history: %v", err)
+			return nil, err
+		}
+		if beforeJSON.Valid {
+			entry.Before = &model.SubscriptionState{}
+			if err := json.Unmarshal([]byte(beforeJSON.String), entry.Before); err != nil {
+				return nil, err
+			}
+		}
+		entry.After = &model.SubscriptionState{}
+		if err := json.Unmarshal([]byte(afterJSON), entry.After); err != nil {
+			return nil, err
+		}
+		if entry.ChangedAt, err = readEventTime(changedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+// readEventTime turns a stored time into the second precision format of history and events
+func readEventTime(value string) (string, error) {
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339), nil
+}
@@ -0,0 +1,149 @@
+// Package storage opens the repository the service keeps its subscriptions in. The backend is
+// picked by configuration: postgres for production, sqlite for a single instance without a
+// database server, or memory for development and tests.
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/pmadhvi/telness-manager/memory"
+	"github.com/pmadhvi/telness-manager/migrate"
+	"github.com/pmadhvi/telness-manager/postgres"
+	"github.com/pmadhvi/telness-manager/service"
+	"github.com/pmadhvi/telness-manager/sqlite"
+	log "github.com/sirupsen/logrus"
+)
+
+// The storage backends
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+	Memory   = "memory"
+)
+
+// Repository is everything the service and its background jobs store
+type Repository interface {
+	service.SubscriptionRepoInterface
+	service.ActivationRepoInterface
+	service.OperatorRefreshRepoInterface
+	service.PortabilityRepoInterface
+	service.IdempotencyRepoInterface
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Migrator applies and reverts the schema migrations of a database backend
+type Migrator interface {
+	Up(ctx context.Context) (int, error)
+	Down(ctx context.Context, steps int) (int, error)
+	Status(ctx context.Context) ([]migrate.State, error)
+}
+
+// Config selects and configures the storage backend
+type Config struct {
+	// Backend is Postgres, SQLite or Memory
+	Backend string
+	// PostgresURL is the connection string of the postgres database
+	PostgresURL string
+	// SQLitePath is the sqlite database file, :memory: keeps it in memory
+	SQLitePath string
+}
+
+// ConfigFromEnv reads the configuration from the STORAGE, POSTGRES_* and SQLITE_PATH env variables.
+// Without STORAGE postgres is used.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend: os.Getenv("STORAGE"),
+		PostgresURL: fmt.Sprintf("postgres://%v:%v@%v:%v/%v?sslmode=disable",
+			os.Getenv("POSTGRES_USER"),
+			os.Getenv("POSTGRES_PASSWORD"),
+			os.Getenv("POSTGRES_HOST"),
+			os.Getenv("POSTGRES_PORT"),
+			os.Getenv("POSTGRES_DB")),
+		SQLitePath: os.Getenv("SQLITE_PATH"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = Postgres
+	}
+	if cfg.SQLitePath == "" {
+		cfg.SQLitePath = "telness.db"
+	}
+	return cfg
+}
+
+// Store is an opened storage backend
+type Store struct {
+	Backend string
+	Repo    Repository
+	// DB is the postgres database, nil for the other backends
+	DB *sql.DB
+
+	db    *sql.DB
+	log   *log.Logger
+	mu    sync.Mutex
+	locks map[int64]service.Locker
+}
+
+// Open opens the configured backend
+func Open(cfg Config, log *log.Logger) (*Store, error) {
+	store := &Store{Backend: cfg.Backend, log: log, locks: map[int64]service.Locker{}}
+	switch cfg.Backend {
+	case Postgres:
+		db, err := sql.Open("postgres", cfg.PostgresURL)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to database: %w", err)
+		}
+		store.db, store.DB, store.Repo = db, db, postgres.NewSubscriptionRepo(db, log)
+	case SQLite:
+		db, err := sqlite.Open(cfg.SQLitePath, log)
+		if err != nil {
+			return nil, fmt.Errorf("could not open sqlite database %v: %w", cfg.SQLitePath, err)
+		}
+		store.db, store.Repo = db, sqlite.NewSubscriptionRepo(db, log)
+	case Memory:
+		store.Repo = memory.NewSubscriptionRepo()
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q, use %v, %v or %v", cfg.Backend, Postgres, SQLite, Memory)
+	}
+	return store, nil
+}
+
+// Lock returns the lock with given key, e.g. postgres.ActivationLockKey, which makes sure only one
+// instance runs a job at a time. With postgres it is an advisory lock shared by all replicas, the
+// other backends cannot be shared by replicas so a lock within the process is enough.
+func (s *Store) Lock(key int64) service.Locker {
+	if s.Backend == Postgres {
+		return postgres.NewAdvisoryLock(s.DB, s.log, key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.locks[key]; !ok {
+		s.locks[key] = memory.NewLock()
+	}
+	return s.locks[key]
+}
+
+// Migrator returns the migrator of the database, nil for the memory backend which has no schema.
+// A sqlite file is migrated when it is opened, its migrator is for looking at and reverting them.
+func (s *Store) Migrator() (Migrator, error) {
+	switch s.Backend {
+	case Postgres:
+		return postgres.NewMigrator(s.db, s.log)
+	case SQLite:
+		return sqlite.NewMigrator(s.db, s.log)
+	}
+	return nil, nil
+}
+
+// Close closes the database, if the backend has one
+func (s *Store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}